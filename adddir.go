@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const workspacesRoot = "/workspaces"
+
+// addDirFlag collects repeated --add-dir values.
+type addDirFlag []string
+
+func (f *addDirFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *addDirFlag) Set(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("empty --add-dir value")
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+// addDirRequest is one --add-dir or config entry with the directory that
+// relative paths are resolved against.
+type addDirRequest struct {
+	spec    string
+	baseDir string
+	origin  string
+}
+
+// collectAddDirs orders the requests as global config, project config, then
+// the command line.
+func collectAddDirs(flags []string, cfg userConfig, workDir, homeDir string) []addDirRequest {
+	var requests []addDirRequest
+	for _, spec := range cfg.AddDirs {
+		requests = append(requests, addDirRequest{spec: spec, baseDir: homeDir, origin: cfg.path})
+	}
+	for _, spec := range cfg.project(workDir, homeDir).AddDirs {
+		requests = append(requests, addDirRequest{spec: spec, baseDir: workDir, origin: cfg.path})
+	}
+	for _, spec := range flags {
+		requests = append(requests, addDirRequest{spec: spec, baseDir: workDir, origin: "--add-dir"})
+	}
+	return requests
+}
+
+// resolveAddDirs turns requests into mounts under /workspaces/<basename>.
+// The same directory requested twice is mounted once, read-only if any
+// request asked for that; different directories with the same name get a
+// numeric suffix.
+func resolveAddDirs(requests []addDirRequest, workDir, homeDir string, paths hostPaths) ([]mountSpec, error) {
+	var mounts []mountSpec
+	bySource := map[string]int{}
+	targets := map[string]bool{}
+	for _, req := range requests {
+		src, readOnly, err := parseAddDir(req.spec, req.baseDir, homeDir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", req.origin, err)
+		}
+		if paths.key(src) == paths.key(workDir) {
+			return nil, fmt.Errorf("%s: %s is the workspace itself, which is already mounted at /app", req.origin, src)
+		}
+		if i, seen := bySource[paths.key(src)]; seen {
+			mounts[i].readOnly = mounts[i].readOnly || readOnly
+			continue
+		}
+
+		name := filepath.Base(src)
+		dst := workspacesRoot + "/" + name
+		for n := 2; targets[dst]; n++ {
+			dst = workspacesRoot + "/" + name + "-" + strconv.Itoa(n)
+		}
+		targets[dst] = true
+		bySource[paths.key(src)] = len(mounts)
+		mounts = append(mounts, mountSpec{src: src, dst: dst, readOnly: readOnly})
+	}
+	return mounts, nil
+}
+
+// parseAddDir reads "path[:ro]" (or ":rw"). The path must be an existing
+// directory and follows the same rules as the /app mount.
+func parseAddDir(spec, baseDir, homeDir string) (string, bool, error) {
+	path, readOnly := spec, false
+	if rest, ok := strings.CutSuffix(spec, ":ro"); ok {
+		path, readOnly = rest, true
+	} else if rest, ok := strings.CutSuffix(spec, ":rw"); ok {
+		path = rest
+	}
+
+	path = expandHome(path, homeDir)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	path = filepath.Clean(path)
+
+	if strings.Contains(path, ",") {
+		return "", false, fmt.Errorf("directory contains an unsupported comma: %q", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false, fmt.Errorf("add directory %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return "", false, fmt.Errorf("add directory %s: not a directory", path)
+	}
+	if filepath.Base(path) == string(filepath.Separator) || filepath.Base(path) == "." {
+		return "", false, fmt.Errorf("add directory %s: cannot mount a filesystem root", path)
+	}
+	return path, readOnly, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseAddDir(t *testing.T) {
+	root := t.TempDir()
+	home := filepath.Join(root, "home")
+	work := filepath.Join(root, "src", "app")
+	proto := filepath.Join(root, "src", "proto")
+	docs := filepath.Join(home, "docs")
+	for _, dir := range []string{work, proto, docs} {
+		mustMkdirAll(t, dir)
+	}
+	mustWriteFile(t, filepath.Join(work, "README.md"), "hi")
+
+	for _, tt := range []struct {
+		spec     string
+		want     string
+		readOnly bool
+	}{
+		{"../proto", proto, false},
+		{"../proto:ro", proto, true},
+		{"../proto:rw", proto, false},
+		{proto + ":ro", proto, true},
+		{"~/docs", docs, false},
+	} {
+		got, readOnly, err := parseAddDir(tt.spec, work, home)
+		if err != nil {
+			t.Fatalf("parseAddDir(%q): %v", tt.spec, err)
+		}
+		if got != tt.want || readOnly != tt.readOnly {
+			t.Fatalf("parseAddDir(%q) = %q, %v; want %q, %v", tt.spec, got, readOnly, tt.want, tt.readOnly)
+		}
+	}
+
+	mustMkdirAll(t, filepath.Join(root, "a,b"))
+	for _, spec := range []string{"missing", "README.md", "../../a,b"} {
+		if _, _, err := parseAddDir(spec, work, home); err == nil {
+			t.Fatalf("expected parseAddDir(%q) to fail", spec)
+		}
+	}
+}
+
+func TestResolveAddDirsHandlesCollisions(t *testing.T) {
+	root := t.TempDir()
+	work := filepath.Join(root, "app")
+	first := filepath.Join(root, "one", "shared")
+	second := filepath.Join(root, "two", "shared")
+	third := filepath.Join(root, "three", "shared")
+	for _, dir := range []string{work, first, second, third} {
+		mustMkdirAll(t, dir)
+	}
+
+	requests := []addDirRequest{
+		{spec: first, baseDir: work, origin: "config"},
+		{spec: second + ":ro", baseDir: work, origin: "--add-dir"},
+		{spec: first + ":ro", baseDir: work, origin: "--add-dir"},
+		{spec: third, baseDir: work, origin: "--add-dir"},
+	}
+	mounts, err := resolveAddDirs(requests, work, root, hostPaths{})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	want := []mountSpec{
+		{src: first, dst: "/workspaces/shared", readOnly: true},
+		{src: second, dst: "/workspaces/shared-2", readOnly: true},
+		{src: third, dst: "/workspaces/shared-3", readOnly: false},
+	}
+	if len(mounts) != len(want) {
+		t.Fatalf("mounts = %+v, want %+v", mounts, want)
+	}
+	for i := range want {
+		if mounts[i] != want[i] {
+			t.Fatalf("mount %d = %+v, want %+v", i, mounts[i], want[i])
+		}
+	}
+
+	_, err = resolveAddDirs([]addDirRequest{{spec: ".", baseDir: work, origin: "--add-dir"}}, work, root, hostPaths{})
+	if err == nil || !strings.Contains(err.Error(), "workspace itself") {
+		t.Fatalf("expected the workspace to be rejected, got %v", err)
+	}
+}
+
+func TestCollectAddDirsOrder(t *testing.T) {
+	cfg := userConfig{
+		path:    "/home/me/.config/dockerx/config.yaml",
+		AddDirs: []string{"~/docs"},
+		Projects: map[string]projectConfig{
+			"~/src/app":   {AddDirs: []string{"../proto"}},
+			"~/src/other": {AddDirs: []string{"../unrelated"}},
+		},
+	}
+	got := collectAddDirs([]string{"../extra:ro"}, cfg, "/home/me/src/app", "/home/me")
+	want := []addDirRequest{
+		{spec: "~/docs", baseDir: "/home/me", origin: cfg.path},
+		{spec: "../proto", baseDir: "/home/me/src/app", origin: cfg.path},
+		{spec: "../extra:ro", baseDir: "/home/me/src/app", origin: "--add-dir"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("collectAddDirs = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("request %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestAddDirsInArgsAndPlans(t *testing.T) {
+	plan := launchPlan{
+		image:   "repo/image:latest",
+		workDir: "/home/me/src/app",
+		addDirs: []mountSpec{
+			{src: "/home/me/src/proto", dst: "/workspaces/proto"},
+			{src: "/home/me/design docs", dst: "/workspaces/design docs", readOnly: true},
+		},
+		command: []string{"zsh"},
+	}
+	args, err := buildDockerArgs(plan)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if !containsPair(args, "--mount", "type=bind,src=/home/me/src/proto,dst=/workspaces/proto") ||
+		!containsPair(args, "--mount", "type=bind,src=/home/me/design docs,dst=/workspaces/design docs,readonly") {
+		t.Fatalf("missing add-dir mounts in %v", args)
+	}
+
+	var text bytes.Buffer
+	if err := writePlan(&text, planFormatText, plan, args); err != nil {
+		t.Fatalf("text plan: %v", err)
+	}
+	if !strings.Contains(text.String(), "Additional dirs:\n  - /home/me/src/proto -> /workspaces/proto (rw)\n  - /home/me/design docs -> /workspaces/design docs (ro)\n") {
+		t.Fatalf("text plan missing additional dirs:\n%s", text.String())
+	}
+	if !strings.Contains(text.String(), "'type=bind,src=/home/me/design docs,dst=/workspaces/design docs,readonly'") {
+		t.Fatalf("text plan should quote the mount:\n%s", text.String())
+	}
+
+	var out bytes.Buffer
+	if err := writePlan(&out, planFormatJSON, plan, args); err != nil {
+		t.Fatalf("json plan: %v", err)
+	}
+	var rec planRecord
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil {
+		t.Fatalf("decode plan: %v", err)
+	}
+	if len(rec.AddDirs) != 2 || rec.AddDirs[1].Target != "/workspaces/design docs" || !rec.AddDirs[1].ReadOnly {
+		t.Fatalf("unexpected addDirs in json plan: %+v", rec.AddDirs)
+	}
+}
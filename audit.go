@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const auditChainEnv = "DOCKERX_AUDIT_CHAIN"
+
+// Statuses of launches that ended before docker run.
+const (
+	sessionRefused     = "refused"
+	sessionFailed      = "failed"
+	sessionInterrupted = "interrupted"
+)
+
+// refusedError is a launch dockerx refuses on policy rather than one that
+// failed.
+type refusedError struct{ error }
+
+func (e refusedError) Unwrap() error { return e.error }
+
+// abortedStatus classifies the error that ended a launch before docker run
+// and returns the status and exit code to record for it.
+func abortedStatus(err error) (string, int) {
+	var interrupted exitStatusError
+	var refused refusedError
+	var violation *policyViolation
+	switch {
+	case errors.As(err, &interrupted):
+		return sessionInterrupted, interrupted.code
+	case errors.As(err, &refused), errors.As(err, &violation):
+		return sessionRefused, 1
+	default:
+		return sessionFailed, 1
+	}
+}
+
+// sessionRecord is one line of the session audit log.
+type sessionRecord struct {
+	Version  string        `json:"version"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Project  string        `json:"project"`
+	Image    string        `json:"image"`
+	Digest   string        `json:"digest,omitempty"`
+	Mounts   []mountRecord `json:"mounts"`
+	EnvKeys  []string      `json:"envKeys"`
+	Command  []string      `json:"command"`
+	ExitCode int           `json:"exitCode"`
+	// RiskyChanges are watched host-executed files the session changed.
+	RiskyChanges []riskyChange `json:"riskyChanges,omitempty"`
+	// Recording is the asciicast file written with --record.
+	Recording string `json:"recording,omitempty"`
+	// Status is set when the launch ended before docker run: refused on
+	// policy, failed during setup or interrupted by a signal. Error says why.
+	Status   string `json:"status,omitempty"`
+	Error    string `json:"error,omitempty"`
+	PrevHash string `json:"prevHash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+type mountRecord struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"readOnly"`
+	// Type is "volume" for docker volumes, whose Source is the volume name.
+	Type string `json:"type,omitempty"`
+}
+
+func mountRecords(mounts []mountSpec) []mountRecord {
+	out := make([]mountRecord, 0, len(mounts))
+	for _, m := range mounts {
+		out = append(out, mountRecord{Source: m.src, Target: m.dst, ReadOnly: m.readOnly})
+	}
+	return out
+}
+
+func plannedMountRecords(mounts []plannedMount) []mountRecord {
+	out := make([]mountRecord, 0, len(mounts))
+	for _, m := range mounts {
+		rec := mountRecord{Source: m.src, Target: m.dst, ReadOnly: m.readOnly}
+		if m.volume {
+			rec.Type = "volume"
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func auditLogPath(homeDir string, lookupEnv func(string) string) string {
+	stateHome := lookupEnv("XDG_STATE_HOME")
+	if stateHome == "" {
+		stateHome = filepath.Join(homeDir, ".local", "state")
+	}
+	return filepath.Join(stateHome, "dockerx", "sessions.jsonl")
+}
+
+func auditChainEnabled(lookupEnv func(string) string) bool {
+	switch strings.ToLower(strings.TrimSpace(lookupEnv(auditChainEnv))) {
+	case "1", "true", "yes", "on":
+		return true
+	default:
+		return false
+	}
+}
+
+// appendSessionRecord appends rec to the log at path. With chain set, the
+// record is linked to the previous one by hash so edits and deletions in the
+// middle of the log can be detected by `dockerx history --verify`. Once the
+// log holds a chained record every later record is chained too, even without
+// chain, since an unlinked record would break the chain for verification.
+func appendSessionRecord(path string, rec sessionRecord, chain bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create audit log dir: %w", err)
+	}
+
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	prev, err := lastRecordHash(path)
+	if err != nil {
+		return err
+	}
+	if chain || prev != "" {
+		rec.PrevHash = prev
+		rec.Hash = recordHash(rec)
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encode session record: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	return nil
+}
+
+// recordHash hashes the record with its own hash field cleared.
+func recordHash(rec sessionRecord) string {
+	rec.Hash = ""
+	content, _ := json.Marshal(rec)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func lastRecordHash(path string) (string, error) {
+	records, err := readSessionRecords(path)
+	if err != nil {
+		return "", err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Hash != "" {
+			return records[i].Hash, nil
+		}
+	}
+	return "", nil
+}
+
+func readSessionRecords(path string) ([]sessionRecord, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var records []sessionRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var rec sessionRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return nil, fmt.Errorf("parse audit log line %d: %w", lineNo, err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	return records, nil
+}
+
+// verifySessionChain checks every chained record against its predecessor.
+// Records written before chaining was enabled are skipped, but once the chain
+// starts every later record must carry a valid link.
+func verifySessionChain(records []sessionRecord) error {
+	prev := ""
+	chained := false
+	for i, rec := range records {
+		if rec.Hash == "" {
+			if chained {
+				return fmt.Errorf("record %d is missing its hash", i+1)
+			}
+			continue
+		}
+		if rec.PrevHash != prev {
+			return fmt.Errorf("record %d does not link to the previous record", i+1)
+		}
+		if recordHash(rec) != rec.Hash {
+			return fmt.Errorf("record %d has been modified", i+1)
+		}
+		prev = rec.Hash
+		chained = true
+	}
+	return nil
+}
+
+// lockFile takes an exclusive lock by creating path, waiting briefly for
+// another dockerx process to release it. Locks older than a minute are
+// assumed to be left over from a crashed process.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > time.Minute {
+			_ = os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("lock %s: timed out waiting for another dockerx process", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+type historyFilter struct {
+	project string
+	image   string
+	since   time.Time
+	failed  bool
+	limit   int
+}
+
+func filterSessionRecords(records []sessionRecord, f historyFilter) []sessionRecord {
+	var out []sessionRecord
+	for _, rec := range records {
+		if f.project != "" && rec.Project != f.project {
+			continue
+		}
+		if f.image != "" && !strings.Contains(rec.Image, f.image) {
+			continue
+		}
+		if !f.since.IsZero() && rec.Start.Before(f.since) {
+			continue
+		}
+		if f.failed && rec.ExitCode == 0 {
+			continue
+		}
+		out = append(out, rec)
+	}
+	if f.limit > 0 && len(out) > f.limit {
+		out = out[len(out)-f.limit:]
+	}
+	return out
+}
+
+func runHistory(args []string) int {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	all := flags.Bool("all", false, "Show sessions from every project, not just the current directory")
+	project := flags.String("project", "", "Show sessions for this project path")
+	image := flags.String("image", "", "Show sessions whose image contains this text")
+	since := flags.Duration("since", 0, "Show sessions started within this duration (for example 24h)")
+	failed := flags.Bool("failed", false, "Show only sessions with a non-zero exit code")
+	limit := flags.Int("limit", 20, "Maximum number of sessions to show (0 for all)")
+	asJSON := flags.Bool("json", false, "Print matching records as JSON lines")
+	verify := flags.Bool("verify", false, "Verify the audit log hash chain")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	filter := historyFilter{project: *project, image: *image, failed: *failed, limit: *limit}
+	if *since > 0 {
+		filter.since = time.Now().Add(-*since)
+	}
+	if err := showHistory(os.Stdout, filter, *all, *asJSON, *verify); err != nil {
+		fmt.Fprintf(os.Stderr, "dockerx: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func showHistory(w io.Writer, filter historyFilter, all, asJSON, verify bool) error {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("resolve user home directory: %w", err)
+	}
+	records, err := readSessionRecords(auditLogPath(homeDir, getenv))
+	if err != nil {
+		return err
+	}
+
+	if verify {
+		if err := verifySessionChain(records); err != nil {
+			return fmt.Errorf("audit log verification failed: %w", err)
+		}
+		fmt.Fprintf(w, "Audit log OK (%d records)\n", len(records))
+		return nil
+	}
+
+	switch {
+	case filter.project != "":
+		if filter.project, err = filepath.Abs(filter.project); err != nil {
+			return fmt.Errorf("resolve project path: %w", err)
+		}
+	case !all:
+		if filter.project, err = os.Getwd(); err != nil {
+			return fmt.Errorf("resolve current directory: %w", err)
+		}
+	}
+
+	matches := filterSessionRecords(records, filter)
+	if asJSON {
+		enc := json.NewEncoder(w)
+		for _, rec := range matches {
+			if err := enc.Encode(rec); err != nil {
+				return fmt.Errorf("encode session record: %w", err)
+			}
+		}
+		return nil
+	}
+	printHistory(w, matches, filter.project == "")
+	return nil
+}
+
+func printHistory(w io.Writer, records []sessionRecord, showProject bool) {
+	if len(records) == 0 {
+		fmt.Fprintln(w, "No sessions recorded.")
+		return
+	}
+	for _, rec := range records {
+		duration := rec.End.Sub(rec.Start).Round(time.Second)
+		line := fmt.Sprintf("%s  %8s  exit %-3d  %s", rec.Start.Local().Format("2006-01-02 15:04:05"), duration, rec.ExitCode, rec.Image)
+		if showProject {
+			line += "  " + rec.Project
+		}
+		fmt.Fprintf(w, "%s  %s\n", line, strings.Join(rec.Command, " "))
+		for _, c := range rec.RiskyChanges {
+			fmt.Fprintf(w, "    ! %s %s\n", c.Change, c.Path)
+		}
+		if rec.Recording != "" {
+			fmt.Fprintf(w, "    recording: %s\n", rec.Recording)
+		}
+		if rec.Status != "" {
+			fmt.Fprintf(w, "    %s: %s\n", rec.Status, rec.Error)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendSessionRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dockerx", "sessions.jsonl")
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	rec := sessionRecord{
+		Version:  "v1.2.3",
+		Start:    start,
+		End:      start.Add(time.Minute),
+		Project:  "/work/repo",
+		Image:    "wpkpda/dockerx:latest",
+		Digest:   "sha256:abcd",
+		Mounts:   mountRecords([]mountSpec{{src: "/work/repo", dst: "/app"}}),
+		EnvKeys:  []string{"OPENAI_API_KEY"},
+		Command:  []string{"make", "test"},
+		ExitCode: 2,
+	}
+	if err := appendSessionRecord(path, rec, false); err != nil {
+		t.Fatalf("append record: %v", err)
+	}
+	if err := appendSessionRecord(path, rec, false); err != nil {
+		t.Fatalf("append record: %v", err)
+	}
+
+	records, err := readSessionRecords(path)
+	if err != nil {
+		t.Fatalf("read records: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	got := records[1]
+	if got.Project != "/work/repo" || got.ExitCode != 2 || got.Digest != "sha256:abcd" || got.Hash != "" {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+	if len(got.Mounts) != 1 || got.Mounts[0] != (mountRecord{Source: "/work/repo", Target: "/app"}) {
+		t.Fatalf("unexpected mounts: %+v", got.Mounts)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if strings.Contains(string(content), "prevHash") {
+		t.Fatalf("did not expect chain fields without chaining: %s", content)
+	}
+}
+
+func TestSessionChainDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.jsonl")
+	for i := range 3 {
+		rec := sessionRecord{Project: "/work/repo", Image: "img", ExitCode: i}
+		if err := appendSessionRecord(path, rec, true); err != nil {
+			t.Fatalf("append record: %v", err)
+		}
+	}
+
+	records, err := readSessionRecords(path)
+	if err != nil {
+		t.Fatalf("read records: %v", err)
+	}
+	if err := verifySessionChain(records); err != nil {
+		t.Fatalf("expected valid chain: %v", err)
+	}
+	if records[0].PrevHash != "" || records[1].PrevHash != records[0].Hash {
+		t.Fatalf("unexpected links: %+v", records)
+	}
+
+	modified := append([]sessionRecord(nil), records...)
+	modified[1].ExitCode = 0
+	if err := verifySessionChain(modified); err == nil || !strings.Contains(err.Error(), "record 2") {
+		t.Fatalf("expected modification to be detected, got %v", err)
+	}
+
+	removed := []sessionRecord{records[0], records[2]}
+	if err := verifySessionChain(removed); err == nil {
+		t.Fatal("expected removed record to be detected")
+	}
+
+	unchained := append(append([]sessionRecord(nil), records...), sessionRecord{Project: "/work/repo"})
+	if err := verifySessionChain(unchained); err == nil {
+		t.Fatal("expected unchained record after chain start to be detected")
+	}
+}
+
+func TestSessionChainAllowsLegacyPrefix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.jsonl")
+	if err := appendSessionRecord(path, sessionRecord{Image: "legacy"}, false); err != nil {
+		t.Fatalf("append record: %v", err)
+	}
+	if err := appendSessionRecord(path, sessionRecord{Image: "chained"}, true); err != nil {
+		t.Fatalf("append record: %v", err)
+	}
+
+	records, err := readSessionRecords(path)
+	if err != nil {
+		t.Fatalf("read records: %v", err)
+	}
+	if err := verifySessionChain(records); err != nil {
+		t.Fatalf("expected valid chain: %v", err)
+	}
+}
+
+func TestSessionChainContinuesWhenDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.jsonl")
+	if err := appendSessionRecord(path, sessionRecord{Image: "chained"}, true); err != nil {
+		t.Fatalf("append record: %v", err)
+	}
+	if err := appendSessionRecord(path, sessionRecord{Image: "later"}, false); err != nil {
+		t.Fatalf("append record: %v", err)
+	}
+
+	records, err := readSessionRecords(path)
+	if err != nil {
+		t.Fatalf("read records: %v", err)
+	}
+	if records[1].PrevHash != records[0].Hash {
+		t.Fatalf("record after the chain started was not linked: %+v", records[1])
+	}
+	if err := verifySessionChain(records); err != nil {
+		t.Fatalf("expected valid chain: %v", err)
+	}
+}
+
+func TestFilterSessionRecords(t *testing.T) {
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	records := []sessionRecord{
+		{Project: "/a", Image: "wpkpda/dockerx:latest", Start: base, ExitCode: 0},
+		{Project: "/b", Image: "repo/other:1", Start: base.Add(time.Hour), ExitCode: 1},
+		{Project: "/a", Image: "wpkpda/dockerx:test", Start: base.Add(2 * time.Hour), ExitCode: 2},
+		{Project: "/a", Image: "wpkpda/dockerx:latest", Start: base.Add(3 * time.Hour), ExitCode: 0},
+	}
+
+	if got := filterSessionRecords(records, historyFilter{project: "/a"}); len(got) != 3 {
+		t.Fatalf("expected 3 project records, got %d", len(got))
+	}
+	if got := filterSessionRecords(records, historyFilter{failed: true}); len(got) != 2 {
+		t.Fatalf("expected 2 failed records, got %d", len(got))
+	}
+	if got := filterSessionRecords(records, historyFilter{image: "other"}); len(got) != 1 || got[0].Project != "/b" {
+		t.Fatalf("unexpected image filter result: %+v", got)
+	}
+	if got := filterSessionRecords(records, historyFilter{since: base.Add(90 * time.Minute)}); len(got) != 2 {
+		t.Fatalf("expected 2 recent records, got %d", len(got))
+	}
+	got := filterSessionRecords(records, historyFilter{project: "/a", limit: 2})
+	if len(got) != 2 || got[1].Start != base.Add(3*time.Hour) {
+		t.Fatalf("expected the 2 most recent records, got %+v", got)
+	}
+}
+
+func TestShowHistoryJSON(t *testing.T) {
+	state := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", state)
+	path := filepath.Join(state, "dockerx", "sessions.jsonl")
+	if err := appendSessionRecord(path, sessionRecord{Project: "/a", Image: "img", Command: []string{"zsh"}}, false); err != nil {
+		t.Fatalf("append record: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := showHistory(&out, historyFilter{}, true, true, false); err != nil {
+		t.Fatalf("show history: %v", err)
+	}
+	var rec sessionRecord
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil {
+		t.Fatalf("decode output %q: %v", out.String(), err)
+	}
+	if rec.Project != "/a" || rec.Image != "img" {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+
+	out.Reset()
+	if err := showHistory(&out, historyFilter{}, true, false, true); err != nil {
+		t.Fatalf("verify history: %v", err)
+	}
+	if !strings.Contains(out.String(), "Audit log OK (1 records)") {
+		t.Fatalf("unexpected verify output: %s", out.String())
+	}
+}
+
+func TestAuditLogPath(t *testing.T) {
+	env := map[string]string{}
+	lookup := func(key string) string { return env[key] }
+
+	if got := auditLogPath("/home/me", lookup); got != filepath.Join("/home/me", ".local", "state", "dockerx", "sessions.jsonl") {
+		t.Fatalf("unexpected default path: %s", got)
+	}
+	env["XDG_STATE_HOME"] = "/state"
+	if got := auditLogPath("/home/me", lookup); got != filepath.Join("/state", "dockerx", "sessions.jsonl") {
+		t.Fatalf("unexpected XDG path: %s", got)
+	}
+
+	if auditChainEnabled(lookup) {
+		t.Fatal("did not expect chaining by default")
+	}
+	env[auditChainEnv] = "1"
+	if !auditChainEnabled(lookup) {
+		t.Fatal("expected chaining when enabled")
+	}
+}
+
+func TestLaunchRecordsRefusedSession(t *testing.T) {
+	home := t.TempDir()
+	bin := filepath.Join(t.TempDir(), "bin")
+	mustWriteFile(t, filepath.Join(bin, "docker"), "#!/bin/sh\nexit 1\n")
+	if err := os.Chmod(filepath.Join(bin, "docker"), 0o755); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	t.Setenv("PATH", bin)
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("cannot stand in for docker here")
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, ".state"))
+	t.Chdir(home)
+
+	err := launchDockerx(cliConfig{image: "wpkpda/dockerx:latest", shell: "zsh", command: []string{"make", "test"}})
+	if err == nil {
+		t.Fatal("expected the home directory to be refused")
+	}
+	records, readErr := readSessionRecords(auditLogPath(home, os.Getenv))
+	if readErr != nil || len(records) != 1 {
+		t.Fatalf("records = %+v, %v", records, readErr)
+	}
+	got := records[0]
+	if got.Status != sessionRefused || got.ExitCode != 1 || got.Error != err.Error() || got.Project != home || !slices.Equal(got.Command, []string{"make", "test"}) {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+}
+
+func TestAbortedStatus(t *testing.T) {
+	for _, tt := range []struct {
+		err    error
+		status string
+		code   int
+	}{
+		{exitStatusError{code: 130}, sessionInterrupted, 130},
+		{fmt.Errorf("policy: %w", &policyViolation{image: "x"}), sessionRefused, 1},
+		{refusedError{errors.New("dangerous")}, sessionRefused, 1},
+		{errors.New("pull failed"), sessionFailed, 1},
+	} {
+		if status, code := abortedStatus(tt.err); status != tt.status || code != tt.code {
+			t.Fatalf("abortedStatus(%v) = %s, %d, want %s, %d", tt.err, status, code, tt.status, tt.code)
+		}
+	}
+}
+
+func TestPrintHistoryListsRiskyChanges(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	rec := sessionRecord{
+		Start:        start,
+		End:          start.Add(time.Minute),
+		Image:        "wpkpda/dockerx:latest",
+		Command:      []string{"codex"},
+		RiskyChanges: []riskyChange{{Path: "Makefile", Change: riskyModified}},
+	}
+	var buf bytes.Buffer
+	printHistory(&buf, []sessionRecord{rec}, false)
+	if !strings.Contains(buf.String(), "! modified Makefile") {
+		t.Fatalf("history missing risky change:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bridgeRoot holds the host bridges in the container. Each bridge is a host
+// directory with a socket served by dockerx and a helper script that the
+// container's tools call.
+const bridgeRoot = "/run/dockerx"
+
+// startBridge writes the helper script, if any, into dir and serves handler
+// on a socket of this launch's own, named after socketName, and returns the
+// socket's file name. Launches sharing a warm container share dir, so each
+// serves its own settings on its own socket and points its session there.
+func startBridge(dir, socketName, helperName, helperScript string, handler http.Handler) (string, func(), error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", nil, fmt.Errorf("create bridge dir: %w", err)
+	}
+	if helperName != "" {
+		// A session may be running the helper, so replace it atomically.
+		tmp, err := os.CreateTemp(dir, "."+helperName+"-*")
+		if err != nil {
+			return "", nil, fmt.Errorf("write %s: %w", helperName, err)
+		}
+		_, err = tmp.WriteString(helperScript)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chmod(tmp.Name(), 0o755)
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), filepath.Join(dir, helperName))
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return "", nil, fmt.Errorf("write %s: %w", helperName, err)
+		}
+	}
+	removeStaleSockets(dir)
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", nil, fmt.Errorf("name bridge socket: %w", err)
+	}
+	name := strings.TrimSuffix(socketName, ".sock") + "-" + hex.EncodeToString(suffix) + ".sock"
+	socket := filepath.Join(dir, name)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return "", nil, fmt.Errorf("listen on %s: %w", socket, err)
+	}
+
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	return name, func() {
+		server.Close()
+		os.Remove(socket)
+	}, nil
+}
+
+// removeStaleSockets removes sockets in dir that nothing answers on, left by
+// launches that were killed.
+func removeStaleSockets(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.Type()&fs.ModeSocket == 0 {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			continue
+		}
+		os.Remove(path)
+	}
+}
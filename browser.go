@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const (
+	browserBridgeMount  = bridgeRoot + "/browser"
+	browserBridgeSocket = "browser.sock"
+	browserBridgeHelper = "open-url"
+	// browserBridgeSocketEnv names this launch's socket in the bridge dir.
+	browserBridgeSocketEnv = "DOCKERX_BROWSER_SOCKET"
+	// browserShimPath puts the helper where tools that run xdg-open find it.
+	browserShimPath = "/usr/local/bin/xdg-open"
+)
+
+const browserBridgeHelperScript = `#!/bin/sh
+if [ -z "${1:-}" ]; then
+  echo "usage: $0 URL" >&2
+  exit 2
+fi
+printf '%s' "$1" | curl -sS --fail-with-body --unix-socket "${` + browserBridgeSocketEnv + `:-` + browserBridgeMount + "/" + browserBridgeSocket + `}" --data-binary @- http://dockerx/open
+`
+
+// browserPlan describes the browser-open bridge. dir is the host directory
+// holding the socket and helper, empty until the bridge serves, and socket is
+// the file name this launch serves on.
+type browserPlan struct {
+	domains []string
+	dir     string
+	socket  string
+}
+
+// browserBridge opens URLs from the container in the host browser.
+type browserBridge struct {
+	// domains limits which hosts may be opened; empty allows any public
+	// host.
+	domains []string
+	open    func(rawURL string) error
+	// lookup resolves host names, to refuse names that point at the host
+	// or its network; nil uses the system resolver.
+	lookup func(host string) ([]net.IP, error)
+	log    io.Writer
+}
+
+func (b *browserBridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/open" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 16<<10))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lookup := b.lookup
+	if lookup == nil {
+		lookup = net.LookupIP
+	}
+	target, err := validateBrowserURL(strings.TrimSpace(string(body)), b.domains, lookup)
+	if err != nil {
+		fmt.Fprintf(b.log, "dockerx: refused to open URL from the container: %v\n", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := b.open(target); err != nil {
+		fmt.Fprintf(b.log, "dockerx: open %s: %v\n", target, err)
+		http.Error(w, "host browser failed to open the URL", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, "opened in the host browser")
+}
+
+// validateBrowserURL accepts absolute http and https URLs, optionally only
+// for the given domains and their subdomains. Hosts on the loopback,
+// link-local or private networks are refused unless a domain names them,
+// since the host browser would reach services the container cannot. The URL
+// is re-encoded so the host opener never sees anything the parser did not
+// understand.
+func validateBrowserURL(raw string, domains []string, lookup func(string) ([]net.IP, error)) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q", raw)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("URL scheme %q is not http or https", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("URL %q has no host", raw)
+	}
+	if u.User != nil {
+		return "", fmt.Errorf("URL for %s carries credentials", u.Hostname())
+	}
+	allowed := len(domains) > 0 && domainAllowed(u.Hostname(), domains)
+	if len(domains) > 0 && !allowed {
+		return "", fmt.Errorf("host %q is not in the browser domain allowlist", u.Hostname())
+	}
+	if !allowed && localHost(u.Hostname(), lookup) {
+		return "", fmt.Errorf("host %q is on the host's loopback or local network; list it under browser domains to allow it", u.Hostname())
+	}
+	return u.String(), nil
+}
+
+// localHost reports whether host is localhost, a single-label or .local name,
+// or an address (or a name resolving to one) on a loopback, link-local or
+// private network. A name that does not resolve is left to the browser.
+func localHost(host string, lookup func(string) ([]net.IP, error)) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".local") {
+		return true
+	}
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		if !strings.Contains(host, ".") {
+			return true
+		}
+		resolved, err := lookup(host)
+		if err != nil {
+			return false
+		}
+		ips = resolved
+	}
+	for _, ip := range ips {
+		if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+			return true
+		}
+	}
+	return false
+}
+
+func domainAllowed(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "*."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostOpenURL opens a validated URL with the platform's opener. The URL is
+// passed as a single argument, never through a shell.
+func hostOpenURL(target string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", target)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		cmd = exec.Command("xdg-open", target)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// startBrowserBridge serves b on a socket in dir, next to the helper script,
+// and returns the socket's file name.
+func startBrowserBridge(dir string, b *browserBridge) (string, func(), error) {
+	return startBridge(dir, browserBridgeSocket, browserBridgeHelper, browserBridgeHelperScript, b)
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const defaultBuildFile = "Dockerfile.dockerx"
+const buildImageRepo = "dockerx-local"
+
+// buildFlag implements --build and --build=path. The bare form builds the
+// default Dockerfile.dockerx in the current directory.
+type buildFlag struct {
+	enabled bool
+	path    string
+}
+
+func (b *buildFlag) String() string {
+	if b == nil || !b.enabled {
+		return ""
+	}
+	return b.path
+}
+
+func (b *buildFlag) Set(value string) error {
+	switch value {
+	case "true":
+		b.enabled = true
+		b.path = ""
+	case "false":
+		b.enabled = false
+		b.path = ""
+	default:
+		if strings.TrimSpace(value) == "" {
+			return errors.New("build path cannot be empty")
+		}
+		b.enabled = true
+		b.path = value
+	}
+	return nil
+}
+
+func (b *buildFlag) IsBoolFlag() bool {
+	return true
+}
+
+type buildSpec struct {
+	dockerfile string
+	contextDir string
+	baseImage  string
+	// baseImageID is the local ID of baseImage, or empty when it has not
+	// been pulled yet (as in a dry run).
+	baseImageID string
+	tag         string
+}
+
+func resolveBuildSpec(workDir, path, baseImage, baseImageID string) (buildSpec, error) {
+	dockerfile := path
+	if dockerfile == "" {
+		dockerfile = defaultBuildFile
+	}
+	if !filepath.IsAbs(dockerfile) {
+		dockerfile = filepath.Join(workDir, dockerfile)
+	}
+	info, err := os.Stat(dockerfile)
+	if err != nil {
+		return buildSpec{}, fmt.Errorf("resolve build file: %w", err)
+	}
+	if info.IsDir() {
+		dockerfile = filepath.Join(dockerfile, defaultBuildFile)
+		if _, err := os.Stat(dockerfile); err != nil {
+			return buildSpec{}, fmt.Errorf("resolve build file: %w", err)
+		}
+	}
+
+	spec := buildSpec{
+		dockerfile:  dockerfile,
+		contextDir:  filepath.Dir(dockerfile),
+		baseImage:   baseImage,
+		baseImageID: baseImageID,
+	}
+	hash, err := hashBuildInputs(spec)
+	if err != nil {
+		return buildSpec{}, err
+	}
+	spec.tag = fmt.Sprintf("%s/%s:%s", buildImageRepo, imageNameComponent(filepath.Base(spec.contextDir)), hash[:12])
+	return spec, nil
+}
+
+// hashBuildInputs hashes the Dockerfile, the base image it is built against,
+// and every context file referenced by a COPY or ADD instruction. The base is
+// hashed by reference and local ID, so pulling a new :latest forces a rebuild.
+// Unrelated project files do not affect the tag, so editing code does not.
+func hashBuildInputs(spec buildSpec) (string, error) {
+	content, err := os.ReadFile(spec.dockerfile)
+	if err != nil {
+		return "", fmt.Errorf("read build file: %w", err)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "base %s\n", spec.baseImage)
+	fmt.Fprintf(h, "base-id %s\n", spec.baseImageID)
+	fmt.Fprintf(h, "dockerfile %d\n", len(content))
+	h.Write(content)
+
+	files, err := collectBuildContextFiles(spec.contextDir, parseCopySources(string(content)))
+	if err != nil {
+		return "", err
+	}
+	for _, rel := range files {
+		if err := hashContextFile(h, spec.contextDir, rel); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// parseCopySources returns the context-relative source patterns used by COPY
+// and ADD. Sources copied from other stages or fetched from URLs are skipped.
+func parseCopySources(dockerfile string) []string {
+	var sources []string
+	for _, line := range joinContinuationLines(dockerfile) {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		instruction := strings.ToUpper(fields[0])
+		if instruction != "COPY" && instruction != "ADD" {
+			continue
+		}
+
+		args := fields[1:]
+		fromStage := false
+		for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+			if strings.HasPrefix(args[0], "--from=") {
+				fromStage = true
+			}
+			args = args[1:]
+		}
+		if fromStage || len(args) < 2 {
+			continue
+		}
+
+		if strings.HasPrefix(args[0], "[") {
+			var parts []string
+			for _, p := range strings.Split(strings.Trim(strings.Join(args, " "), "[]"), ",") {
+				parts = append(parts, strings.Trim(strings.TrimSpace(p), `"`))
+			}
+			args = parts
+		}
+		for _, src := range args[:len(args)-1] {
+			if strings.Contains(src, "://") || strings.HasPrefix(src, "git@") {
+				continue
+			}
+			sources = append(sources, src)
+		}
+	}
+	return sources
+}
+
+func joinContinuationLines(content string) []string {
+	var out []string
+	var current strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasSuffix(line, "\\") {
+			current.WriteString(strings.TrimSuffix(line, "\\"))
+			current.WriteString(" ")
+			continue
+		}
+		current.WriteString(line)
+		if current.Len() > 0 {
+			out = append(out, current.String())
+		}
+		current.Reset()
+	}
+	if current.Len() > 0 {
+		out = append(out, current.String())
+	}
+	return out
+}
+
+func collectBuildContextFiles(contextDir string, patterns []string) ([]string, error) {
+	seen := map[string]struct{}{}
+	for _, pattern := range patterns {
+		clean := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(pattern, "/")))
+		if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("build source %q is outside the build context", pattern)
+		}
+		matches, err := filepath.Glob(filepath.Join(contextDir, clean))
+		if err != nil {
+			return nil, fmt.Errorf("match build source %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() {
+					if d.Name() == ".git" {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				rel, err := filepath.Rel(contextDir, path)
+				if err != nil {
+					return err
+				}
+				seen[filepath.ToSlash(rel)] = struct{}{}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("walk build source %q: %w", pattern, err)
+			}
+		}
+	}
+
+	files := make([]string, 0, len(seen))
+	for rel := range seen {
+		files = append(files, rel)
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+func hashContextFile(w io.Writer, contextDir, rel string) error {
+	path := filepath.Join(contextDir, filepath.FromSlash(rel))
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("hash build input %s: %w", rel, err)
+	}
+	fmt.Fprintf(w, "file %s %o %d\n", rel, info.Mode().Perm(), info.Size())
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("hash build input %s: %w", rel, err)
+		}
+		fmt.Fprintf(w, "link %s\n", target)
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("hash build input %s: %w", rel, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("hash build input %s: %w", rel, err)
+	}
+	return nil
+}
+
+// imageNameComponent lowercases a directory name and replaces characters
+// that are not valid in a Docker repository path.
+func imageNameComponent(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '.' || r == '_' || r == '-':
+			if b.Len() > 0 {
+				b.WriteRune(r)
+			}
+		default:
+			if b.Len() > 0 {
+				b.WriteRune('-')
+			}
+		}
+	}
+	out := strings.TrimRight(b.String(), "._-")
+	if out == "" {
+		return "project"
+	}
+	return out
+}
+
+func imageExists(image string) bool {
+	_, ok := imageID(image)
+	return ok
+}
+
+// imageID returns the local ID of image, which changes whenever the tag is
+// pulled or built again.
+func imageID(image string) (string, bool) {
+	cmd := exec.Command("docker", "image", "inspect", "--format", "{{.Id}}", image)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = io.Discard
+	if err := cmd.Run(); err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(stdout.String()), true
+}
+
+func buildImage(spec buildSpec, verbose bool) error {
+	args := []string{
+		"build",
+		"--file", spec.dockerfile,
+		"--tag", spec.tag,
+		"--build-arg", "DOCKERX_IMAGE=" + spec.baseImage,
+		spec.contextDir,
+	}
+	cmd := exec.Command("docker", args...)
+	if verbose {
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("docker build failed: %w", err)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "dockerx: building %s from %s\n", spec.tag, spec.dockerfile)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		fmt.Fprint(os.Stderr, tailLines(output.String(), 20))
+		return fmt.Errorf("docker build failed: %w", err)
+	}
+	return nil
+}
+
+func tailLines(content string, n int) string {
+	lines := splitLines(content)
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return joinLines(lines)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseCopySources(t *testing.T) {
+	dockerfile := `FROM wpkpda/dockerx:latest AS base
+# COPY ignored.txt /ignored
+COPY requirements.txt /tmp/
+ADD --chown=dev:dev scripts/ tools/*.sh /opt/tools/
+COPY --from=base /usr/bin/tool /usr/bin/tool
+ADD https://example.com/archive.tgz /tmp/
+COPY ["config dir", "/etc/app/"]
+RUN pip install \
+  -r /tmp/requirements.txt
+COPY a.txt \
+  b.txt /data/
+`
+	got := parseCopySources(dockerfile)
+	want := []string{"requirements.txt", "scripts/", "tools/*.sh", "config dir", "a.txt", "b.txt"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("unexpected sources:\n got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestHashBuildInputsTracksReferencedFilesOnly(t *testing.T) {
+	dir := t.TempDir()
+	dockerfile := filepath.Join(dir, defaultBuildFile)
+	mustWriteFile(t, dockerfile, "FROM wpkpda/dockerx:latest\nCOPY tools/ /opt/tools/\n")
+	mustWriteFile(t, filepath.Join(dir, "tools", "setup.sh"), "echo one\n")
+	mustWriteFile(t, filepath.Join(dir, "main.go"), "package main\n")
+
+	spec := buildSpec{dockerfile: dockerfile, contextDir: dir, baseImage: "wpkpda/dockerx:latest"}
+	first := mustHashBuildInputs(t, spec)
+
+	mustWriteFile(t, filepath.Join(dir, "main.go"), "package main\n\nfunc main() {}\n")
+	if got := mustHashBuildInputs(t, spec); got != first {
+		t.Fatal("expected unrelated file change to keep the hash")
+	}
+
+	mustWriteFile(t, filepath.Join(dir, "tools", "setup.sh"), "echo two\n")
+	second := mustHashBuildInputs(t, spec)
+	if second == first {
+		t.Fatal("expected COPY input change to change the hash")
+	}
+
+	mustWriteFile(t, dockerfile, "FROM wpkpda/dockerx:latest\nCOPY tools/ /opt/tools/\nRUN true\n")
+	third := mustHashBuildInputs(t, spec)
+	if third == second {
+		t.Fatal("expected Dockerfile change to change the hash")
+	}
+
+	spec.baseImageID = "sha256:1111"
+	fourth := mustHashBuildInputs(t, spec)
+	if fourth == third {
+		t.Fatal("expected a new base image ID to change the hash")
+	}
+
+	spec.baseImage = "wpkpda/dockerx:test"
+	if got := mustHashBuildInputs(t, spec); got == fourth {
+		t.Fatal("expected base image change to change the hash")
+	}
+}
+
+func TestHashBuildInputsRejectsSourcesOutsideContext(t *testing.T) {
+	dir := t.TempDir()
+	dockerfile := filepath.Join(dir, defaultBuildFile)
+	mustWriteFile(t, dockerfile, "FROM scratch\nCOPY ../secret /secret\n")
+
+	_, err := hashBuildInputs(buildSpec{dockerfile: dockerfile, contextDir: dir})
+	if err == nil || !strings.Contains(err.Error(), "outside the build context") {
+		t.Fatalf("expected outside context error, got %v", err)
+	}
+}
+
+func TestResolveBuildSpec(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "My Project")
+	mustWriteFile(t, filepath.Join(dir, defaultBuildFile), "FROM wpkpda/dockerx:latest\n")
+	mustWriteFile(t, filepath.Join(dir, "docker", "Custom.Dockerfile"), "FROM wpkpda/dockerx:latest\n")
+
+	spec, err := resolveBuildSpec(dir, "", "wpkpda/dockerx:latest", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spec.dockerfile != filepath.Join(dir, defaultBuildFile) {
+		t.Fatalf("unexpected dockerfile: %s", spec.dockerfile)
+	}
+	if !strings.HasPrefix(spec.tag, "dockerx-local/my-project:") {
+		t.Fatalf("unexpected tag: %s", spec.tag)
+	}
+
+	spec, err = resolveBuildSpec(dir, "docker/Custom.Dockerfile", "wpkpda/dockerx:latest", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spec.contextDir != filepath.Join(dir, "docker") {
+		t.Fatalf("unexpected context dir: %s", spec.contextDir)
+	}
+
+	if _, err := resolveBuildSpec(dir, "missing.Dockerfile", "wpkpda/dockerx:latest", ""); err == nil {
+		t.Fatal("expected error for missing build file")
+	}
+}
+
+func TestBuildFlag(t *testing.T) {
+	var b buildFlag
+	if err := b.Set("true"); err != nil || !b.enabled || b.path != "" {
+		t.Fatalf("unexpected bare flag state: %+v err=%v", b, err)
+	}
+	if err := b.Set("ci/Dockerfile"); err != nil || !b.enabled || b.path != "ci/Dockerfile" {
+		t.Fatalf("unexpected path flag state: %+v err=%v", b, err)
+	}
+	if err := b.Set("false"); err != nil || b.enabled {
+		t.Fatalf("unexpected disabled flag state: %+v err=%v", b, err)
+	}
+}
+
+func TestImageNameComponent(t *testing.T) {
+	for input, want := range map[string]string{
+		"dockerx":       "dockerx",
+		"My Project":    "my-project",
+		"_private.repo": "private.repo",
+		"!!!":           "project",
+	} {
+		if got := imageNameComponent(input); got != want {
+			t.Fatalf("imageNameComponent(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func mustHashBuildInputs(t *testing.T, spec buildSpec) string {
+	t.Helper()
+	hash, err := hashBuildInputs(spec)
+	if err != nil {
+		t.Fatalf("hash build inputs: %v", err)
+	}
+	return hash
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// userConfig is read from $XDG_CONFIG_HOME/dockerx/config.yaml. It lives
+// outside any project, so a repository cannot use it to widen what its own
+// sessions can reach.
+type userConfig struct {
+	path string
+	// AddDirs are mounted into every session, as with --add-dir.
+	AddDirs []string `yaml:"addDirs"`
+	// Projects holds settings for a single project, keyed by its path.
+	Projects map[string]projectConfig `yaml:"projects"`
+	// GitCredentials controls the host git credential bridge.
+	GitCredentials gitCredentialConfig `yaml:"gitCredentials"`
+	// Browser controls opening URLs from the container in the host browser.
+	Browser browserConfig `yaml:"browser"`
+	// Tools adds tool presets or replaces built-in ones.
+	Tools map[string]toolSpec `yaml:"tools"`
+	// AllowDangerousRoots lists directories that may be mounted even though
+	// they are a home, root or system directory, as with
+	// --allow-dangerous-root.
+	AllowDangerousRoots []string `yaml:"allowDangerousRoots"`
+	// Watch adds workspace paths to the post-session report of host-executed
+	// files; Unwatch drops default ones.
+	Watch   []string `yaml:"watch"`
+	Unwatch []string `yaml:"unwatch"`
+}
+
+type browserConfig struct {
+	// Domains limits the URLs that may be opened to these domains and their
+	// subdomains; empty allows any http or https URL on a public host.
+	// Local and private hosts must be listed to be opened.
+	Domains []string `yaml:"domains"`
+	// Disabled turns the bridge off.
+	Disabled bool `yaml:"disabled"`
+}
+
+type gitCredentialConfig struct {
+	// Hosts may receive host credentials; empty means the defaults.
+	Hosts []string `yaml:"hosts"`
+	// Prompt asks on the host terminal before each credential is released.
+	Prompt bool `yaml:"prompt"`
+	// Disabled turns the bridge off.
+	Disabled bool `yaml:"disabled"`
+}
+
+type projectConfig struct {
+	// AddDirs are mounted when launching from this project. Relative paths
+	// are resolved against the project directory.
+	AddDirs []string `yaml:"addDirs"`
+	// Protect adds workspace paths mounted read-only over /app, relative to
+	// the project; Unprotect drops default ones such as .envrc.
+	Protect   []string `yaml:"protect"`
+	Unprotect []string `yaml:"unprotect"`
+	// Watch and Unwatch adjust the post-session report for this project.
+	Watch   []string `yaml:"watch"`
+	Unwatch []string `yaml:"unwatch"`
+}
+
+func userConfigPath(homeDir string, lookupEnv func(string) string) string {
+	configHome := lookupEnv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configHome, "dockerx", "config.yaml")
+}
+
+// loadUserConfig reads the config at path. A missing file is an empty
+// config; unknown keys are rejected so typos do not silently do nothing.
+func loadUserConfig(path string) (userConfig, error) {
+	cfg := userConfig{path: path}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("read config %s: %w", path, err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// project returns the settings for workDir. Keys may use ~ for the home
+// directory.
+func (c userConfig) project(workDir, homeDir string) projectConfig {
+	for key, project := range c.Projects {
+		if filepath.Clean(expandHome(key, homeDir)) == filepath.Clean(workDir) {
+			return project
+		}
+	}
+	return projectConfig{}
+}
+
+// expandHome replaces a leading ~ with homeDir.
+func expandHome(path, homeDir string) string {
+	if path == "~" {
+		return homeDir
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return filepath.Join(homeDir, rest)
+	}
+	if rest, ok := strings.CutPrefix(path, `~\`); ok {
+		return filepath.Join(homeDir, rest)
+	}
+	return path
+}
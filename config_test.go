@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadUserConfig(t *testing.T) {
+	dir := t.TempDir()
+	missing, err := loadUserConfig(filepath.Join(dir, "missing.yaml"))
+	if err != nil || len(missing.AddDirs) != 0 {
+		t.Fatalf("missing config = %+v, %v", missing, err)
+	}
+
+	empty := filepath.Join(dir, "empty.yaml")
+	mustWriteFile(t, empty, "")
+	if _, err := loadUserConfig(empty); err != nil {
+		t.Fatalf("empty config: %v", err)
+	}
+
+	path := filepath.Join(dir, "config.yaml")
+	mustWriteFile(t, path, "addDirs:\n  - ~/docs:ro\nprojects:\n  ~/src/app:\n    addDirs: [../proto]\ngitCredentials:\n  hosts: [github.com]\n  prompt: true\n")
+	cfg, err := loadUserConfig(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if len(cfg.AddDirs) != 1 || cfg.AddDirs[0] != "~/docs:ro" {
+		t.Fatalf("unexpected addDirs: %+v", cfg.AddDirs)
+	}
+	if git := cfg.GitCredentials; len(git.Hosts) != 1 || !git.Prompt || git.Disabled {
+		t.Fatalf("unexpected gitCredentials: %+v", git)
+	}
+	project := cfg.project("/home/me/src/app", "/home/me")
+	if len(project.AddDirs) != 1 || project.AddDirs[0] != "../proto" {
+		t.Fatalf("unexpected project config: %+v", project)
+	}
+	if other := cfg.project("/home/me/src/other", "/home/me"); len(other.AddDirs) != 0 {
+		t.Fatalf("expected no config for another project: %+v", other)
+	}
+
+	typo := filepath.Join(dir, "typo.yaml")
+	mustWriteFile(t, typo, "addDir:\n  - ~/docs\n")
+	if _, err := loadUserConfig(typo); err == nil || !strings.Contains(err.Error(), "addDir") {
+		t.Fatalf("expected unknown key to be rejected, got %v", err)
+	}
+}
+
+func TestUserConfigPath(t *testing.T) {
+	env := map[string]string{}
+	lookup := func(k string) string { return env[k] }
+	if got, want := userConfigPath("/home/me", lookup), filepath.Join("/home/me", ".config", "dockerx", "config.yaml"); got != want {
+		t.Fatalf("userConfigPath = %q, want %q", got, want)
+	}
+	env["XDG_CONFIG_HOME"] = "/xdg"
+	if got, want := userConfigPath("/home/me", lookup), filepath.Join("/xdg", "dockerx", "config.yaml"); got != want {
+		t.Fatalf("userConfigPath = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	// gitBridgeMount is where the bridge directory appears in the container.
+	gitBridgeMount  = bridgeRoot + "/git"
+	gitBridgeSocket = "credential.sock"
+	gitBridgeHelper = "git-credential-dockerx"
+	// gitBridgeSocketEnv names this launch's socket in the bridge dir.
+	gitBridgeSocketEnv = "DOCKERX_GIT_SOCKET"
+)
+
+// defaultGitCredentialHosts are bridged when the user config does not list
+// any hosts.
+var defaultGitCredentialHosts = []string{"github.com", "gitlab.com", "bitbucket.org"}
+
+// gitBridgeHelperScript is the container side of the bridge. Git only asks
+// helpers to store or erase what it was given, so those are not forwarded
+// and a session cannot write to the host's credential store.
+const gitBridgeHelperScript = `#!/bin/sh
+[ "$1" = get ] || exit 0
+curl -sf --unix-socket "${` + gitBridgeSocketEnv + `:-` + gitBridgeMount + "/" + gitBridgeSocket + `}" --data-binary @- http://dockerx/get || true
+`
+
+// credentialRequestKeys are passed from the container to the host's git;
+// anything else the container sends is dropped.
+var credentialRequestKeys = []string{"protocol", "host", "path", "username"}
+
+// credentialResponseKeys are returned to the container, in this order.
+var credentialResponseKeys = []string{"protocol", "host", "username", "password", "password_expiry_utc", "oauth_refresh_token"}
+
+// gitCredentialPlan describes the git credential bridge. dir is the host
+// directory holding the socket and helper, empty until the bridge serves, and
+// socket is the file name this launch serves on.
+type gitCredentialPlan struct {
+	hosts  []string
+	prompt bool
+	dir    string
+	socket string
+}
+
+// gitCredentialsFileMount adds a read-only ~/.git-credentials to mounts, kept
+// sorted by target, for hosts where the bridge cannot serve. Without it git
+// in the container would have no credentials at all there. ok is false when
+// the file does not exist.
+func gitCredentialsFileMount(mounts []mountSpec, homeDir string, exists func(string) bool) ([]mountSpec, bool) {
+	src := filepath.Join(homeDir, ".git-credentials")
+	if !exists(src) {
+		return mounts, false
+	}
+	mounts = append(slices.Clone(mounts), mountSpec{src: src, dst: containerHome + "/.git-credentials", readOnly: true})
+	slices.SortFunc(mounts, func(a, b mountSpec) int {
+		return strings.Compare(a.dst, b.dst)
+	})
+	return mounts, true
+}
+
+// credentialBridge answers git credential requests from the container with
+// the host's `git credential fill`, for allowed hosts only.
+type credentialBridge struct {
+	hosts []string
+	// confirm asks before releasing a credential; nil releases without
+	// asking.
+	confirm func(host string) bool
+	fill    func(request map[string]string) (map[string]string, error)
+	log     io.Writer
+
+	mu sync.Mutex
+}
+
+func (b *credentialBridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/get" {
+		http.NotFound(w, r)
+		return
+	}
+	request, err := parseCredential(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response, err := b.get(request)
+	if err != nil {
+		fmt.Fprintf(b.log, "dockerx: git credential request denied: %v\n", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_ = writeCredential(w, response, credentialResponseKeys)
+}
+
+func (b *credentialBridge) get(request map[string]string) (map[string]string, error) {
+	host := request["host"]
+	if request["protocol"] != "https" {
+		return nil, fmt.Errorf("protocol %q for %s is not https", request["protocol"], host)
+	}
+	if !credentialHostAllowed(host, b.hosts) {
+		return nil, fmt.Errorf("host %q is not in the gitCredentials allowlist", host)
+	}
+
+	// One prompt at a time, so parallel fetches do not interleave questions.
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.confirm != nil && !b.confirm(host) {
+		return nil, fmt.Errorf("release of credentials for %s declined", host)
+	}
+	response, err := b.fill(request)
+	if err != nil {
+		return nil, fmt.Errorf("no host credentials for %s: %w", host, err)
+	}
+	return response, nil
+}
+
+// credentialHostAllowed matches host, which may carry a port, against the
+// allowlist. Entries without a port match any port; "*.example.com" matches
+// subdomains of example.com.
+func credentialHostAllowed(host string, allowed []string) bool {
+	host = strings.ToLower(host)
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == host || entry == name {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(entry, "*."); ok && strings.HasSuffix(name, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCredential reads git's key=value credential format up to a blank line
+// or EOF. Only the request keys are kept.
+func parseCredential(r io.Reader) (map[string]string, error) {
+	attrs := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed credential line %q", line)
+		}
+		attrs[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read credential: %w", err)
+	}
+	kept := map[string]string{}
+	for _, key := range credentialRequestKeys {
+		if value, ok := attrs[key]; ok {
+			kept[key] = value
+		}
+	}
+	return kept, nil
+}
+
+func writeCredential(w io.Writer, attrs map[string]string, keys []string) error {
+	for _, key := range keys {
+		if value, ok := attrs[key]; ok {
+			if _, err := fmt.Fprintf(w, "%s=%s\n", key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hostCredentialFill asks the host's configured git credential helpers. With
+// terminal prompts off, git fails instead of asking for a password.
+func hostCredentialFill(request map[string]string) (map[string]string, error) {
+	var in bytes.Buffer
+	_ = writeCredential(&in, request, credentialRequestKeys)
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = &in
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	response := map[string]string{}
+	for _, line := range splitLines(string(out)) {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			response[key] = value
+		}
+	}
+	if response["password"] == "" {
+		return nil, errors.New("git credential fill returned no password")
+	}
+	return response, nil
+}
+
+// startCredentialBridge serves b on a socket in dir, next to the helper
+// script, and returns the socket's file name.
+func startCredentialBridge(dir string, b *credentialBridge) (string, func(), error) {
+	return startBridge(dir, gitBridgeSocket, gitBridgeHelper, gitBridgeHelperScript, b)
+}
+
+// gitBridgeEnv points the container's git at the helper. The empty value
+// first clears helpers inherited from the copied host .gitconfig, which
+// would not work in the container.
+func gitBridgeEnv() []string {
+	return []string{
+		"GIT_CONFIG_COUNT=2",
+		"GIT_CONFIG_KEY_0=credential.helper",
+		"GIT_CONFIG_VALUE_0=",
+		"GIT_CONFIG_KEY_1=credential.helper",
+		"GIT_CONFIG_VALUE_1=!/bin/sh " + gitBridgeMount + "/" + gitBridgeHelper,
+	}
+}
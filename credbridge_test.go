@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCredentialHostAllowed(t *testing.T) {
+	allowed := []string{"github.com", "*.corp.example", "git.internal:8443"}
+	for host, want := range map[string]bool{
+		"github.com":        true,
+		"GitHub.com":        true,
+		"github.com:443":    true,
+		"gitlab.com":        false,
+		"evilgithub.com":    false,
+		"git.corp.example":  true,
+		"corp.example":      false,
+		"git.internal:8443": true,
+		"git.internal:9000": false,
+		"git.internal":      false,
+		"":                  false,
+	} {
+		if got := credentialHostAllowed(host, allowed); got != want {
+			t.Fatalf("credentialHostAllowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestParseCredentialKeepsRequestKeys(t *testing.T) {
+	in := "protocol=https\nhost=github.com\nusername=me\npassword=planted\nwwwauth[]=Basic\n\nprotocol=ignored\n"
+	attrs, err := parseCredential(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if attrs["protocol"] != "https" || attrs["host"] != "github.com" || attrs["username"] != "me" {
+		t.Fatalf("unexpected attrs: %v", attrs)
+	}
+	if _, ok := attrs["password"]; ok {
+		t.Fatalf("password from the container should be dropped: %v", attrs)
+	}
+	if _, err := parseCredential(strings.NewReader("garbage\n")); err == nil {
+		t.Fatal("expected a malformed line to be rejected")
+	}
+}
+
+func TestCredentialBridgeGet(t *testing.T) {
+	var filled []map[string]string
+	bridge := &credentialBridge{
+		hosts: []string{"github.com"},
+		fill: func(request map[string]string) (map[string]string, error) {
+			filled = append(filled, request)
+			return map[string]string{"protocol": "https", "host": request["host"], "username": "me", "password": "s3cret"}, nil
+		},
+		log: io.Discard,
+	}
+
+	got, err := bridge.get(map[string]string{"protocol": "https", "host": "github.com"})
+	if err != nil || got["password"] != "s3cret" {
+		t.Fatalf("get allowed host = %v, %v", got, err)
+	}
+	for _, request := range []map[string]string{
+		{"protocol": "https", "host": "gitlab.com"},
+		{"protocol": "http", "host": "github.com"},
+	} {
+		if _, err := bridge.get(request); err == nil {
+			t.Fatalf("expected %v to be denied", request)
+		}
+	}
+	if len(filled) != 1 {
+		t.Fatalf("host git was asked %d times, want 1", len(filled))
+	}
+
+	asked := ""
+	bridge.confirm = func(host string) bool {
+		asked = host
+		return false
+	}
+	if _, err := bridge.get(map[string]string{"protocol": "https", "host": "github.com"}); err == nil {
+		t.Fatal("expected a declined prompt to deny the request")
+	}
+	if asked != "github.com" || len(filled) != 1 {
+		t.Fatalf("prompt host = %q, fills = %d", asked, len(filled))
+	}
+
+	bridge.confirm = nil
+	bridge.fill = func(map[string]string) (map[string]string, error) { return nil, errors.New("no helper") }
+	if _, err := bridge.get(map[string]string{"protocol": "https", "host": "github.com"}); err == nil {
+		t.Fatal("expected a failed fill to be reported")
+	}
+}
+
+func TestStartCredentialBridgeServesSocket(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "git")
+	var log bytes.Buffer
+	bridge := &credentialBridge{
+		hosts: []string{"github.com"},
+		fill: func(request map[string]string) (map[string]string, error) {
+			return map[string]string{"protocol": "https", "host": request["host"], "username": "me", "password": "s3cret", "extra": "dropped"}, nil
+		},
+		log: &log,
+	}
+	socket, stop, err := startCredentialBridge(dir, bridge)
+	if err != nil {
+		t.Fatalf("start bridge: %v", err)
+	}
+	defer stop()
+
+	helper, err := os.ReadFile(filepath.Join(dir, gitBridgeHelper))
+	if err != nil || !strings.Contains(string(helper), "${"+gitBridgeSocketEnv+":-") {
+		t.Fatalf("helper script = %q, %v", helper, err)
+	}
+
+	clientFor := func(socket string) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", filepath.Join(dir, socket))
+			},
+		}}
+	}
+
+	// A second launch sharing the directory serves its own settings on its
+	// own socket, and stopping it leaves the first one serving.
+	other := &credentialBridge{hosts: []string{"example.com"}, fill: bridge.fill, log: &log}
+	otherSocket, stopOther, err := startCredentialBridge(dir, other)
+	if err != nil {
+		t.Fatalf("start second bridge: %v", err)
+	}
+	if otherSocket == socket {
+		t.Fatalf("both launches serve on %s", socket)
+	}
+	resp, err := clientFor(otherSocket).Post("http://dockerx/get", "text/plain", strings.NewReader("protocol=https\nhost=example.com\n\n"))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("second launch's request = %v, %v", resp, err)
+	}
+	resp.Body.Close()
+	stopOther()
+
+	client := clientFor(socket)
+	post := func(body string) (int, string) {
+		resp, err := client.Post("http://dockerx/get", "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		defer resp.Body.Close()
+		out, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(out)
+	}
+
+	status, body := post("protocol=https\nhost=github.com\n\n")
+	if status != http.StatusOK || body != "protocol=https\nhost=github.com\nusername=me\npassword=s3cret\n" {
+		t.Fatalf("allowed request = %d %q", status, body)
+	}
+	status, body = post("protocol=https\nhost=example.com\n\n")
+	if status != http.StatusForbidden || strings.Contains(body, "s3cret") {
+		t.Fatalf("denied request = %d %q", status, body)
+	}
+	if !strings.Contains(log.String(), "example.com") {
+		t.Fatalf("denied request not logged: %q", log.String())
+	}
+}
+
+func TestBuildDockerArgsMountsGitBridge(t *testing.T) {
+	plan := launchPlan{
+		image:          "repo/image:latest",
+		workDir:        "/home/me/repo",
+		command:        []string{"zsh"},
+		gitCredentials: &gitCredentialPlan{hosts: defaultGitCredentialHosts},
+	}
+	args, err := buildDockerArgs(plan)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if containsSubstring(args, gitBridgeMount) {
+		t.Fatalf("bridge should not be mounted before it serves: %v", args)
+	}
+
+	plan.gitCredentials.dir = "/run/user/1000/dockerx/session-1/git"
+	args, err = buildDockerArgs(plan)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if !containsPair(args, "--mount", "type=bind,src=/run/user/1000/dockerx/session-1/git,dst="+gitBridgeMount+",readonly") {
+		t.Fatalf("missing bridge mount in %v", args)
+	}
+	if !containsPair(args, "--env", "GIT_CONFIG_VALUE_1=!/bin/sh "+gitBridgeMount+"/"+gitBridgeHelper) {
+		t.Fatalf("missing git helper config in %v", args)
+	}
+}
+
+func TestGitCredentialsFileMount(t *testing.T) {
+	home := t.TempDir()
+	mounts := []mountSpec{
+		{src: filepath.Join(home, ".gitconfig"), dst: containerHome + "/.gitconfig", readOnly: true},
+		{src: filepath.Join(home, ".ssh"), dst: containerHome + "/.ssh", readOnly: true},
+	}
+	if got, ok := gitCredentialsFileMount(mounts, home, pathExists); ok || len(got) != len(mounts) {
+		t.Fatalf("missing file should not be mounted: %v", got)
+	}
+
+	mustWriteFile(t, filepath.Join(home, ".git-credentials"), "x")
+	got, ok := gitCredentialsFileMount(mounts, home, pathExists)
+	if !ok || len(got) != 3 || got[0].dst != containerHome+"/.git-credentials" || !got[0].readOnly {
+		t.Fatalf("unexpected mounts: %v", got)
+	}
+}
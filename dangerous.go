@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// credentialDirs under the home directory must never end up inside /app.
+var credentialDirs = []string{".ssh", ".aws", ".gnupg", ".kube"}
+
+// darwinSystemDirs and darwinSystemTrees complement isSystemDir, which covers
+// the Linux layout; the trees are refused along with everything under them.
+var (
+	darwinSystemDirs  = []string{"/Applications", "/Users", "/Volumes", "/private", "/private/var"}
+	darwinSystemTrees = []string{"/Library", "/System", "/private/etc"}
+)
+
+// dangerousWorkDir explains why mounting dir into the container would expose
+// more than a project, or returns "" for an ordinary project directory.
+func dangerousWorkDir(dir, homeDir string, lookupEnv func(string) string, exists func(string) bool, paths hostPaths) string {
+	dir = filepath.Clean(dir)
+	key := func(p string) string { return paths.key(filepath.Clean(p)) }
+
+	switch {
+	case filepath.Dir(dir) == dir || dir == filepath.VolumeName(dir)+string(filepath.Separator):
+		return "it is a filesystem root"
+	case isWSLDriveRoot(dir):
+		return "it is the root of a Windows drive"
+	case homeDir != "" && key(dir) == key(homeDir):
+		return "it is your home directory, with shell rc files, SSH keys and other credentials"
+	case isSystemDir(dir):
+		return "it is a system directory"
+	}
+	if paths.goos == "darwin" {
+		for _, sys := range darwinSystemDirs {
+			if key(dir) == key(sys) {
+				return "it is a system directory"
+			}
+		}
+		for _, sys := range darwinSystemTrees {
+			if pathWithin(key(dir), key(sys)) {
+				return "it is a system directory"
+			}
+		}
+	}
+	if paths.goos == "windows" {
+		for _, env := range []string{"SystemRoot", "ProgramFiles", "ProgramFiles(x86)", "ProgramData"} {
+			if sys := lookupEnv(env); sys != "" && pathWithin(key(dir), key(sys)) {
+				return "it is a system directory"
+			}
+		}
+		if homeDir != "" && key(dir) == key(filepath.Dir(homeDir)) {
+			return "it holds every user's home directory"
+		}
+	}
+	if homeDir == "" {
+		return ""
+	}
+	for _, name := range credentialDirs {
+		secret := filepath.Join(homeDir, name)
+		if !exists(secret) {
+			continue
+		}
+		// ~/.ssh may be a link into dir, as with a dotfiles checkout.
+		if pathWithin(key(secret), key(dir)) || pathWithin(key(resolveExisting(secret)), key(dir)) {
+			return fmt.Sprintf("it contains %s", secret)
+		}
+	}
+	return ""
+}
+
+func isWSLDriveRoot(dir string) bool {
+	_, rest, ok := wslDrivePath(filepath.ToSlash(dir))
+	return ok && rest == ""
+}
+
+// checkDangerousDirs refuses a workspace or additional directory that
+// dangerousWorkDir flags, unless it was allowed on the command line or in the
+// user config.
+func checkDangerousDirs(workDir string, addDirs []mountSpec, allowFlag bool, cfg userConfig, homeDir string, paths hostPaths) error {
+	if allowFlag {
+		return nil
+	}
+	allowed := map[string]bool{}
+	for _, p := range cfg.AllowDangerousRoots {
+		allowed[paths.key(filepath.Clean(expandHome(p, homeDir)))] = true
+	}
+
+	check := func(dir, what string) error {
+		// A symlink exposes whatever it points at, so check the resolved
+		// directory against the resolved home as well.
+		reason := dangerousWorkDir(dir, homeDir, getenv, pathExists, paths)
+		if reason == "" {
+			reason = dangerousWorkDir(resolveExisting(dir), resolveExisting(homeDir), getenv, pathExists, paths)
+		}
+		if reason == "" || allowed[paths.key(filepath.Clean(dir))] {
+			return nil
+		}
+		return refusedError{fmt.Errorf("refusing to mount %s %s: %s. Run dockerx from a project directory, or if this is intended pass --allow-dangerous-root or list the path under allowDangerousRoots in %s", what, dir, reason, cfg.path)}
+	}
+	if err := check(workDir, "the current directory"); err != nil {
+		return err
+	}
+	for _, m := range addDirs {
+		if err := check(m.src, "additional directory"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDangerousWorkDir(t *testing.T) {
+	home := "/srv/users/me"
+	exists := func(path string) bool { return path == filepath.Join(home, ".aws") }
+	noEnv := func(string) string { return "" }
+
+	for _, tt := range []struct {
+		dir   string
+		paths hostPaths
+		want  string
+	}{
+		{"/", hostPaths{goos: "linux"}, "filesystem root"},
+		{"/srv/users/me", hostPaths{goos: "linux"}, "home directory"},
+		{"/srv/users/me/", hostPaths{goos: "linux"}, "home directory"},
+		{"/srv/users", hostPaths{goos: "linux"}, "contains /srv/users/me/.aws"},
+		{"/srv", hostPaths{goos: "linux"}, "system directory"},
+		{"/home", hostPaths{goos: "linux"}, "system directory"},
+		{"/etc/nginx", hostPaths{goos: "linux"}, "system directory"},
+		{"/usr/local/src", hostPaths{goos: "linux"}, "system directory"},
+		{"/mnt/c", hostPaths{goos: "linux"}, "Windows drive"},
+		{"/SRV/Users/ME", hostPaths{goos: "darwin"}, "home directory"},
+		{"/Users", hostPaths{goos: "darwin"}, "system directory"},
+		{"/Library/Application Support", hostPaths{goos: "darwin"}, "system directory"},
+		{"/srv/users/me/src/app", hostPaths{goos: "linux"}, ""},
+		{"/srv/users/me/.aws-tools", hostPaths{goos: "linux"}, ""},
+		{"/Users/me/src/app", hostPaths{goos: "darwin"}, ""},
+		{"/mnt/c/src/app", hostPaths{goos: "linux"}, ""},
+	} {
+		got := dangerousWorkDir(tt.dir, home, noEnv, exists, tt.paths)
+		if tt.want == "" && got != "" || tt.want != "" && !strings.Contains(got, tt.want) {
+			t.Fatalf("dangerousWorkDir(%q, %s) = %q, want %q", tt.dir, tt.paths.goos, got, tt.want)
+		}
+	}
+}
+
+func TestCheckDangerousDirs(t *testing.T) {
+	home := t.TempDir()
+	project := filepath.Join(home, "src", "app")
+	mustMkdirAll(t, project)
+	mustMkdirAll(t, filepath.Join(home, ".ssh"))
+	cfg := userConfig{path: filepath.Join(home, ".config", "dockerx", "config.yaml")}
+	paths := hostPaths{goos: "linux"}
+
+	if err := checkDangerousDirs(project, nil, false, cfg, home, paths); err != nil {
+		t.Fatalf("project dir refused: %v", err)
+	}
+
+	err := checkDangerousDirs(home, nil, false, cfg, home, paths)
+	if err == nil {
+		t.Fatal("expected the home directory to be refused")
+	}
+	for _, want := range []string{"home directory", "--allow-dangerous-root", "allowDangerousRoots", cfg.path} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q should mention %q", err, want)
+		}
+	}
+
+	if err := checkDangerousDirs(project, []mountSpec{{src: filepath.Dir(home), dst: workspacesRoot + "/x", readOnly: true}}, false, cfg, home, paths); err == nil {
+		t.Fatal("expected an additional directory containing ~/.ssh to be refused")
+	}
+
+	if err := checkDangerousDirs(home, nil, true, cfg, home, paths); err != nil {
+		t.Fatalf("--allow-dangerous-root should allow the home directory: %v", err)
+	}
+	cfg.AllowDangerousRoots = []string{"~"}
+	if err := checkDangerousDirs(home, nil, false, cfg, home, paths); err != nil {
+		t.Fatalf("config entry should allow the home directory: %v", err)
+	}
+	if err := checkDangerousDirs("/etc", nil, false, cfg, home, paths); err == nil {
+		t.Fatal("an allowed home should not allow other directories")
+	}
+}
+
+func TestCheckDangerousDirsResolvesSymlinks(t *testing.T) {
+	home := t.TempDir()
+	cfg := userConfig{path: filepath.Join(home, ".config", "dockerx", "config.yaml")}
+	paths := hostPaths{goos: "linux"}
+
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(home, link); err != nil {
+		t.Skipf("symlink: %v", err)
+	}
+	if err := checkDangerousDirs(link, nil, false, cfg, home, paths); err == nil || !strings.Contains(err.Error(), "home directory") {
+		t.Fatalf("symlink to the home directory: err = %v", err)
+	}
+	if err := checkDangerousDirs(filepath.Join(home, "src"), []mountSpec{{src: link, dst: workspacesRoot + "/link"}}, false, cfg, home, paths); err == nil {
+		t.Fatal("expected an additional directory linking to the home directory to be refused")
+	}
+
+	dotfiles := filepath.Join(home, "dotfiles")
+	mustMkdirAll(t, filepath.Join(dotfiles, "ssh"))
+	if err := os.Symlink(filepath.Join("dotfiles", "ssh"), filepath.Join(home, ".ssh")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	err := checkDangerousDirs(dotfiles, nil, false, cfg, home, paths)
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(home, ".ssh")) {
+		t.Fatalf("dotfiles holding the target of ~/.ssh: err = %v", err)
+	}
+}
@@ -0,0 +1,790 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	dockerAccessNone     = "none"
+	dockerAccessReadonly = "readonly"
+	dockerAccessFiltered = "filtered"
+
+	dockerBridgeMount  = bridgeRoot + "/docker"
+	dockerBridgeSocket = "docker.sock"
+)
+
+func validateDockerAccess(mode string) error {
+	switch mode {
+	case "", dockerAccessNone, dockerAccessReadonly, dockerAccessFiltered:
+		return nil
+	default:
+		return fmt.Errorf("invalid --docker-access %q (want none, readonly or filtered)", mode)
+	}
+}
+
+// dockerAccessPlan describes the Engine API proxy. dir is the host directory
+// holding its socket, empty until the proxy serves, and socket is the file
+// name this launch serves on.
+type dockerAccessPlan struct {
+	mode   string
+	dir    string
+	socket string
+}
+
+// workspaceRoot is a directory the session can already reach, which
+// containers it creates may bind mount too. Compose in the session sends
+// container paths, so both the container and the host form are accepted.
+type workspaceRoot struct {
+	container string
+	host      string
+	readOnly  bool
+	// guarded is set when the session sees the root with masked or
+	// read-only paths, which a plain bind in another container would not
+	// keep.
+	guarded bool
+}
+
+// sessionWorkspaceRoots lists /app and the additional directories, with host
+// paths resolved through symlinks.
+func sessionWorkspaceRoots(plan launchPlan) []workspaceRoot {
+	roots := []workspaceRoot{{container: "/app", host: plan.workDir, guarded: len(plan.masks) > 0 || len(plan.protected) > 0}}
+	for _, m := range plan.addDirs {
+		roots = append(roots, workspaceRoot{container: m.dst, host: m.src, readOnly: m.readOnly})
+	}
+	for i := range roots {
+		roots[i].host = resolveExisting(roots[i].host)
+	}
+	return roots
+}
+
+// apiVersionPrefix matches the optional /v1.43 prefix of Engine API paths.
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9]+(\.[0-9]+)?/`)
+
+// Fields the filter knows in each request body. The daemon ignores fields it
+// does not know, but a field the filter does not know is one it cannot check,
+// so it is refused.
+var (
+	containerConfigFields = []string{
+		"Hostname", "Domainname", "User", "AttachStdin", "AttachStdout", "AttachStderr",
+		"ExposedPorts", "Tty", "OpenStdin", "StdinOnce", "Env", "Cmd", "Healthcheck",
+		"ArgsEscaped", "Image", "Volumes", "WorkingDir", "Entrypoint", "NetworkDisabled",
+		"MacAddress", "OnBuild", "Labels", "StopSignal", "StopTimeout", "Shell",
+		"HostConfig", "NetworkingConfig",
+	}
+	resourceFields = []string{
+		"CpuShares", "Memory", "NanoCpus", "CgroupParent", "BlkioWeight", "BlkioWeightDevice",
+		"BlkioDeviceReadBps", "BlkioDeviceWriteBps", "BlkioDeviceReadIOps", "BlkioDeviceWriteIOps",
+		"CpuPeriod", "CpuQuota", "CpuRealtimePeriod", "CpuRealtimeRuntime", "CpusetCpus",
+		"CpusetMems", "Devices", "DeviceCgroupRules", "DeviceRequests", "KernelMemory",
+		"KernelMemoryTCP", "MemoryReservation", "MemorySwap", "MemorySwappiness",
+		"OomKillDisable", "PidsLimit", "Ulimits", "CpuCount", "CpuPercent",
+		"IOMaximumIOps", "IOMaximumBandwidth",
+	}
+	hostConfigFields = append([]string{
+		"Binds", "ContainerIDFile", "LogConfig", "NetworkMode", "PortBindings", "RestartPolicy",
+		"AutoRemove", "VolumeDriver", "VolumesFrom", "ConsoleSize", "Annotations", "CapAdd",
+		"CapDrop", "CgroupnsMode", "Dns", "DnsOptions", "DnsSearch", "ExtraHosts", "GroupAdd",
+		"IpcMode", "Cgroup", "Links", "OomScoreAdj", "PidMode", "Privileged", "PublishAllPorts",
+		"ReadonlyRootfs", "SecurityOpt", "StorageOpt", "Tmpfs", "UTSMode", "UsernsMode",
+		"ShmSize", "Sysctls", "Runtime", "Isolation", "Mounts", "MaskedPaths", "ReadonlyPaths",
+		"Init",
+	}, resourceFields...)
+	updateFields       = append([]string{"RestartPolicy"}, resourceFields...)
+	mountFields        = []string{"Type", "Source", "Target", "ReadOnly", "Consistency", "BindOptions", "VolumeOptions", "TmpfsOptions"}
+	volumeOptFields    = []string{"NoCopy", "Labels", "DriverConfig", "Subpath"}
+	driverFields       = []string{"Name", "Options"}
+	execFields         = []string{"AttachStdin", "AttachStdout", "AttachStderr", "DetachKeys", "Tty", "Env", "Cmd", "Privileged", "User", "WorkingDir", "ConsoleSize"}
+	volumeCreateFields = []string{"Name", "Driver", "DriverOpts", "Labels"}
+	networkConnFields  = []string{"Container", "EndpointConfig", "Force"}
+)
+
+// listEndpoints are the GET calls read-only access allows besides calls on
+// the session's own objects. They list objects without reading into them.
+var listEndpoints = []string{
+	"/_ping", "/version", "/info", "/events", "/system/df",
+	"/containers/json", "/images/json", "/volumes", "/networks",
+}
+
+// createdKinds maps the create calls whose result the session owns to the
+// API collection of the created object.
+var createdKinds = map[string]string{
+	"/containers/create": "containers",
+	"/networks/create":   "networks",
+	"/volumes/create":    "volumes",
+	"/commit":            "images",
+}
+
+// deniedHostFields reach the host kernel, devices or other containers and
+// are refused whenever they are set.
+var deniedHostFields = []string{
+	"CapAdd", "VolumesFrom", "Cgroup", "Sysctls", "Runtime", "VolumeDriver",
+}
+
+// namespaceModeFields join a host or another container's namespace when set
+// to host or container:<id>.
+var namespaceModeFields = []string{"NetworkMode", "PidMode", "IpcMode", "UTSMode", "UsernsMode", "CgroupnsMode"}
+
+// dockerAPIFilter decides which Engine API calls from the container reach
+// the host daemon.
+type dockerAPIFilter struct {
+	mode  string
+	roots []workspaceRoot
+	// inspect resolves a reference in an API collection as the daemon would:
+	// containers, images and networks to their ID, volumes to their name and
+	// an exec ID (kind "exec") to the ID of its container.
+	inspect func(kind, ref string) (string, error)
+
+	mu sync.Mutex
+	// owned holds the objects created through the filter as kind/ID.
+	owned map[string]bool
+}
+
+// own records an object of an API collection created through the filter.
+func (f *dockerAPIFilter) own(kind, id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.owned == nil {
+		f.owned = map[string]bool{}
+	}
+	f.owned[kind+"/"+id] = true
+}
+
+// checkOwned refuses calls on objects this session did not create. An exec
+// counts as its container.
+func (f *dockerAPIFilter) checkOwned(kind, ref string) error {
+	if f.inspect == nil {
+		return fmt.Errorf("cannot resolve %s", ref)
+	}
+	id, err := f.inspect(kind, ref)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", ref, err)
+	}
+	if kind == "exec" {
+		kind = "containers"
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.owned[kind+"/"+id] {
+		return fmt.Errorf("%s belongs to a %s this session did not create", ref, strings.TrimSuffix(kind, "s"))
+	}
+	return nil
+}
+
+// apiEndpoint strips the version prefix from an Engine API path.
+func apiEndpoint(p string) string {
+	return "/" + strings.TrimPrefix(apiVersionPrefix.ReplaceAllString(p, "/"), "/")
+}
+
+// apiObject splits /containers/{ref}/{action} and /exec/{id}/{action}. ok is
+// false for other paths and for collection endpoints such as
+// /containers/create.
+func apiObject(endpoint string) (kind, ref, action string, ok bool) {
+	parts := strings.SplitN(strings.TrimPrefix(endpoint, "/"), "/", 3)
+	if len(parts) < 2 || (parts[0] != "containers" && parts[0] != "exec") {
+		return "", "", "", false
+	}
+	if parts[0] == "containers" && len(parts) == 2 && slices.Contains([]string{"create", "json", "prune"}, parts[1]) {
+		return "", "", "", false
+	}
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+	return parts[0], parts[1], action, true
+}
+
+// check returns an error for a call the mode does not allow. Filtered mode
+// may rewrite the body of a create call, in which case r.Body is replaced.
+func (f *dockerAPIFilter) check(r *http.Request) error {
+	if r.URL.Path != path.Clean(r.URL.Path) {
+		return fmt.Errorf("unclean API path %s", r.URL.Path)
+	}
+	endpoint := apiEndpoint(r.URL.Path)
+	kind, ref, action, isObject := apiObject(endpoint)
+
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		// These read a container's files or, for the websocket attach,
+		// write to its stdin.
+		if kind == "containers" && slices.Contains([]string{"attach/ws", "archive", "export"}, action) && f.mode != dockerAccessFiltered {
+			return fmt.Errorf("%s is not available with read-only docker access", action)
+		}
+		// Inspect, logs and the like show what other sessions and the host
+		// run, down to their environment.
+		if isObject {
+			return f.checkOwned(kind, ref)
+		}
+		if f.mode != dockerAccessFiltered && !slices.Contains(listEndpoints, endpoint) {
+			return fmt.Errorf("read-only docker access allows only list calls, not %s", endpoint)
+		}
+		return nil
+	}
+	if f.mode != dockerAccessFiltered {
+		return errors.New("read-only docker access allows only GET and HEAD requests")
+	}
+
+	for _, prefix := range []string{"/plugins", "/swarm", "/services", "/nodes", "/secrets", "/configs"} {
+		if endpoint == prefix || strings.HasPrefix(endpoint, prefix+"/") {
+			return fmt.Errorf("%s is not available with filtered docker access", prefix)
+		}
+	}
+	if strings.HasSuffix(endpoint, "/prune") {
+		return errors.New("prune acts on every session's objects and is not available with filtered docker access")
+	}
+	if isObject {
+		if err := f.checkOwned(kind, ref); err != nil {
+			return err
+		}
+	}
+	if endpoint == "/commit" {
+		if err := f.checkOwned("containers", r.URL.Query().Get("container")); err != nil {
+			return err
+		}
+	}
+	switch {
+	case r.Method == http.MethodDelete && strings.HasPrefix(endpoint, "/images/"):
+		if err := f.checkOwned("images", strings.TrimPrefix(endpoint, "/images/")); err != nil {
+			return err
+		}
+	case strings.HasPrefix(endpoint, "/volumes/") && endpoint != "/volumes/create":
+		if err := f.checkOwned("volumes", strings.TrimPrefix(endpoint, "/volumes/")); err != nil {
+			return err
+		}
+	case strings.HasPrefix(endpoint, "/networks/") && endpoint != "/networks/create":
+		id, _, _ := strings.Cut(strings.TrimPrefix(endpoint, "/networks/"), "/")
+		if err := f.checkOwned("networks", id); err != nil {
+			return err
+		}
+	}
+
+	var rewrite func(spec map[string]any) (map[string]any, error)
+	switch {
+	case endpoint == "/containers/create":
+		rewrite = f.checkContainerCreate
+	case endpoint == "/volumes/create":
+		rewrite = f.checkVolumeCreate
+	case kind == "containers" && action == "exec":
+		rewrite = checkExecCreate
+	case kind == "containers" && action == "update":
+		rewrite = checkContainerUpdate
+	case strings.HasPrefix(endpoint, "/networks/") && (strings.HasSuffix(endpoint, "/connect") || strings.HasSuffix(endpoint, "/disconnect")):
+		rewrite = f.checkNetworkConnect
+	case endpoint == "/build":
+		for key, values := range r.URL.Query() {
+			if strings.EqualFold(key, "networkmode") && slices.Contains(values, "host") {
+				return errors.New("builds on the host network are not allowed")
+			}
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4<<20))
+	if err != nil {
+		return fmt.Errorf("read request body: %w", err)
+	}
+	spec := map[string]any{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&spec); err != nil {
+			return fmt.Errorf("decode request body: %w", err)
+		}
+	}
+	if spec, err = rewrite(spec); err != nil {
+		return err
+	}
+	body, err = json.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("encode request body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", fmt.Sprint(len(body)))
+	return nil
+}
+
+// canonicalFields renames the keys of obj to the field names in known. The
+// daemon decodes JSON case-insensitively and lets the last of two matching
+// keys win, so "hostconfig" must be checked as HostConfig, and a body with
+// both is refused. The forwarded body carries only the canonical names.
+func canonicalFields(obj map[string]any, known []string, what string) (map[string]any, error) {
+	out := make(map[string]any, len(obj))
+	for key, value := range obj {
+		i := slices.IndexFunc(known, func(k string) bool { return strings.EqualFold(k, key) })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown %s field %q", what, key)
+		}
+		if _, dup := out[known[i]]; dup {
+			return nil, fmt.Errorf("duplicate %s field %q", what, known[i])
+		}
+		out[known[i]] = value
+	}
+	return out, nil
+}
+
+// canonicalObject applies canonicalFields to a nested object, which may be
+// absent or null.
+func canonicalObject(value any, known []string, what string) (map[string]any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an object", what)
+	}
+	return canonicalFields(obj, known, what)
+}
+
+// isSet reports whether a decoded JSON value differs from its zero value.
+func isSet(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case json.Number:
+		return v.String() != "0"
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	default:
+		return true
+	}
+}
+
+// checkContainerCreate refuses privileged containers, added capabilities,
+// security options, devices, other containers' volumes, host or shared
+// namespaces and bind mounts outside the workspace. Bind sources are
+// rewritten to the resolved host path, so the daemon mounts exactly what was
+// checked.
+func (f *dockerAPIFilter) checkContainerCreate(spec map[string]any) (map[string]any, error) {
+	spec, err := canonicalFields(spec, containerConfigFields, "container")
+	if err != nil {
+		return nil, err
+	}
+	hc, err := canonicalObject(spec["HostConfig"], hostConfigFields, "HostConfig")
+	if err != nil || hc == nil {
+		return spec, err
+	}
+	spec["HostConfig"] = hc
+
+	if isSet(hc["Privileged"]) {
+		return nil, errors.New("privileged containers are not allowed")
+	}
+	if err := checkResources(hc); err != nil {
+		return nil, err
+	}
+	for _, key := range deniedHostFields {
+		if isSet(hc[key]) {
+			return nil, fmt.Errorf("HostConfig.%s is not allowed", key)
+		}
+	}
+	for _, key := range []string{"MaskedPaths", "ReadonlyPaths"} {
+		// An empty list unmasks /proc and /sys paths, so any value counts.
+		if hc[key] != nil {
+			return nil, fmt.Errorf("HostConfig.%s is not allowed", key)
+		}
+	}
+	if opts, _ := hc["SecurityOpt"].([]any); len(opts) > 0 {
+		for _, o := range opts {
+			if s, _ := o.(string); !strings.HasPrefix(s, "no-new-privileges") {
+				return nil, fmt.Errorf("security option %v is not allowed", o)
+			}
+		}
+	} else if isSet(hc["SecurityOpt"]) {
+		return nil, errors.New("HostConfig.SecurityOpt is not allowed")
+	}
+	for _, key := range namespaceModeFields {
+		mode, _ := hc[key].(string)
+		if mode == "host" || strings.HasPrefix(mode, "container:") {
+			return nil, fmt.Errorf("%s=%s is not allowed", key, mode)
+		}
+	}
+
+	if binds, ok := hc["Binds"].([]any); ok {
+		for i, b := range binds {
+			bind, _ := b.(string)
+			src, rest, _ := strings.Cut(bind, ":")
+			if !strings.HasPrefix(src, "/") {
+				// A named volume.
+				continue
+			}
+			_, opts, _ := strings.Cut(rest, ":")
+			host, err := f.hostSource(src, hasOption(opts, "ro"))
+			if err != nil {
+				return nil, err
+			}
+			binds[i] = host + ":" + rest
+		}
+	}
+
+	if mounts, ok := hc["Mounts"].([]any); ok {
+		for i, raw := range mounts {
+			m, err := canonicalObject(raw, mountFields, "mount")
+			if err != nil {
+				return nil, err
+			}
+			if m == nil {
+				continue
+			}
+			mounts[i] = m
+			typ, _ := m["Type"].(string)
+			switch typ {
+			case "bind":
+				src, _ := m["Source"].(string)
+				readOnly, _ := m["ReadOnly"].(bool)
+				host, err := f.hostSource(src, readOnly)
+				if err != nil {
+					return nil, err
+				}
+				m["Source"] = host
+			case "", "volume":
+				opts, err := canonicalObject(m["VolumeOptions"], volumeOptFields, "VolumeOptions")
+				if err != nil {
+					return nil, err
+				}
+				if opts == nil {
+					continue
+				}
+				m["VolumeOptions"] = opts
+				driver, err := canonicalObject(opts["DriverConfig"], driverFields, "DriverConfig")
+				if err != nil {
+					return nil, err
+				}
+				if driver == nil {
+					continue
+				}
+				opts["DriverConfig"] = driver
+				if name, _ := driver["Name"].(string); name != "" && name != "local" {
+					return nil, fmt.Errorf("volume driver %s is not allowed", name)
+				}
+				options, _ := driver["Options"].(map[string]any)
+				readOnly, _ := m["ReadOnly"].(bool)
+				if err := f.checkVolumeOptions(options, readOnly); err != nil {
+					return nil, err
+				}
+			case "tmpfs":
+			default:
+				return nil, fmt.Errorf("%s mounts are not allowed", typ)
+			}
+		}
+	}
+	return spec, nil
+}
+
+// checkResources refuses device access through the resource fields, which
+// containers/update accepts as well.
+func checkResources(resources map[string]any) error {
+	for _, key := range []string{"Devices", "DeviceCgroupRules", "DeviceRequests", "CgroupParent"} {
+		if isSet(resources[key]) {
+			return fmt.Errorf("%s is not allowed", key)
+		}
+	}
+	return nil
+}
+
+func checkContainerUpdate(spec map[string]any) (map[string]any, error) {
+	spec, err := canonicalFields(spec, updateFields, "update")
+	if err != nil {
+		return nil, err
+	}
+	return spec, checkResources(spec)
+}
+
+// checkVolumeCreate applies the bind rules to local volumes that bind a
+// host directory through driver options.
+func (f *dockerAPIFilter) checkVolumeCreate(spec map[string]any) (map[string]any, error) {
+	spec, err := canonicalFields(spec, volumeCreateFields, "volume")
+	if err != nil {
+		return nil, err
+	}
+	if driver, _ := spec["Driver"].(string); driver != "" && driver != "local" {
+		return nil, fmt.Errorf("volume driver %s is not allowed", driver)
+	}
+	// Creating a volume that exists returns it, which would hand the session
+	// a volume it did not create.
+	if name, _ := spec["Name"].(string); name != "" && f.inspect != nil {
+		if _, err := f.inspect("volumes", name); err == nil {
+			if err := f.checkOwned("volumes", name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	options, _ := spec["DriverOpts"].(map[string]any)
+	return spec, f.checkVolumeOptions(options, false)
+}
+
+// checkNetworkConnect refuses attaching or detaching containers the session
+// did not create.
+func (f *dockerAPIFilter) checkNetworkConnect(spec map[string]any) (map[string]any, error) {
+	spec, err := canonicalFields(spec, networkConnFields, "network connect")
+	if err != nil {
+		return nil, err
+	}
+	container, _ := spec["Container"].(string)
+	return spec, f.checkOwned("containers", container)
+}
+
+func (f *dockerAPIFilter) checkVolumeOptions(options map[string]any, readOnly bool) error {
+	device, _ := options["device"].(string)
+	if device == "" {
+		return nil
+	}
+	o, _ := options["o"].(string)
+	if !hasOption(o, "bind") {
+		return fmt.Errorf("volumes backed by device %s are not allowed", device)
+	}
+	host, err := f.hostSource(device, readOnly || hasOption(o, "ro"))
+	if err != nil {
+		return err
+	}
+	options["device"] = host
+	return nil
+}
+
+func checkExecCreate(spec map[string]any) (map[string]any, error) {
+	spec, err := canonicalFields(spec, execFields, "exec")
+	if err != nil {
+		return nil, err
+	}
+	if isSet(spec["Privileged"]) {
+		return nil, errors.New("privileged exec is not allowed")
+	}
+	return spec, nil
+}
+
+// hostSource maps a bind source, given as the container or host path of a
+// workspace root, to the root's resolved host path. Directories below a root
+// are refused: the daemon resolves the source again when the container
+// starts, and by then the session could have replaced the checked directory
+// with a symlink to anywhere on the host. A root is a mount point in the
+// session's container, so the session cannot replace it.
+func (f *dockerAPIFilter) hostSource(src string, readOnly bool) (string, error) {
+	clean := path.Clean(src)
+	for _, root := range f.roots {
+		if clean != root.container && filepath.FromSlash(clean) != root.host {
+			continue
+		}
+		if root.guarded {
+			return "", fmt.Errorf("%s has .dockerxignore masks or protected paths, which a bind mount would expose", src)
+		}
+		if root.readOnly && !readOnly {
+			return "", fmt.Errorf("%s is read-only in this session and can only be mounted read-only", src)
+		}
+		return root.host, nil
+	}
+	for _, root := range f.roots {
+		if strings.HasPrefix(clean, root.container+"/") || pathWithin(filepath.FromSlash(clean), root.host) {
+			return "", fmt.Errorf("bind mount of %s is below a workspace root; only %s itself can be mounted", src, root.container)
+		}
+	}
+	return "", fmt.Errorf("bind mount of %s is outside the workspace", src)
+}
+
+// resolveExisting resolves symlinks in the longest existing prefix of p.
+// Docker creates missing bind sources, so the rest is kept as given.
+func resolveExisting(p string) string {
+	rest := ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(p); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return filepath.Join(p, rest)
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = parent
+	}
+}
+
+// hasOption reports whether the comma-separated list contains opt.
+func hasOption(list, opt string) bool {
+	for _, o := range strings.Split(list, ",") {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// dockerProxy forwards allowed Engine API calls to the host daemon.
+// ReverseProxy passes the connection upgrades used by attach and exec.
+type dockerProxy struct {
+	filter *dockerAPIFilter
+	proxy  *httputil.ReverseProxy
+	client *http.Client
+	log    io.Writer
+}
+
+func newDockerProxy(upstream string, filter *dockerAPIFilter, log io.Writer) *dockerProxy {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", upstream)
+		},
+	}
+	p := &dockerProxy{
+		filter: filter,
+		log:    log,
+		client: &http.Client{Transport: transport},
+		proxy: &httputil.ReverseProxy{
+			Rewrite: func(r *httputil.ProxyRequest) {
+				r.Out.URL.Scheme = "http"
+				r.Out.URL.Host = "docker"
+			},
+			Transport:     transport,
+			FlushInterval: -1,
+		},
+	}
+	p.proxy.ModifyResponse = p.recordCreated
+	if filter.inspect == nil {
+		filter.inspect = p.inspect
+	}
+	return p
+}
+
+// recordCreated marks containers, networks, volumes and images created
+// through the proxy as the session's.
+func (p *dockerProxy) recordCreated(resp *http.Response) error {
+	if resp.Request.Method != http.MethodPost {
+		return nil
+	}
+	endpoint := apiEndpoint(resp.Request.URL.Path)
+	if endpoint == "/build" && resp.StatusCode == http.StatusOK {
+		resp.Body = &builtImageReader{ReadCloser: resp.Body, own: func(id string) { p.filter.own("images", id) }}
+		return nil
+	}
+	kind, ok := createdKinds[endpoint]
+	if !ok || resp.StatusCode != http.StatusCreated {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	var created struct{ Id, Name string }
+	if json.Unmarshal(body, &created) == nil {
+		id := created.Id
+		if kind == "volumes" {
+			id = created.Name
+		}
+		if id != "" {
+			p.filter.own(kind, id)
+		}
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+// builtImageReader passes a build's progress stream through and owns the
+// image the build reports in an aux message.
+type builtImageReader struct {
+	io.ReadCloser
+	own  func(id string)
+	line []byte
+}
+
+func (r *builtImageReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.line = append(r.line, p[:n]...)
+	for {
+		i := bytes.IndexByte(r.line, '\n')
+		if i < 0 && (err == nil || len(r.line) == 0) {
+			break
+		}
+		if i < 0 {
+			i = len(r.line)
+		}
+		var msg struct {
+			Aux struct{ ID string }
+		}
+		if json.Unmarshal(r.line[:i], &msg) == nil && msg.Aux.ID != "" {
+			r.own(msg.Aux.ID)
+		}
+		r.line = r.line[min(i+1, len(r.line)):]
+	}
+	return n, err
+}
+
+// inspect asks the daemon which object ref names.
+func (p *dockerProxy) inspect(kind, ref string) (string, error) {
+	target := url.URL{Scheme: "http", Host: "docker", Path: "/" + kind + "/" + ref}
+	if kind != "volumes" && kind != "networks" {
+		target.Path += "/json"
+	}
+	resp, err := p.client.Get(target.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("daemon answered %s", resp.Status)
+	}
+	var out struct{ Id, ContainerID, Name string }
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	switch kind {
+	case "exec":
+		return out.ContainerID, nil
+	case "volumes":
+		return out.Name, nil
+	}
+	return out.Id, nil
+}
+
+func (p *dockerProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := p.filter.check(r); err != nil {
+		fmt.Fprintf(p.log, "dockerx: denied docker API call %s %s: %v\n", r.Method, r.URL.Path, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": "dockerx: " + err.Error()})
+		return
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+// dockerUpstream finds the socket of the daemon dockerx itself talks to.
+func dockerUpstream() (string, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		if out, err := exec.Command("docker", "context", "inspect", "--format", "{{.Endpoints.docker.Host}}").Output(); err == nil {
+			host = strings.TrimSpace(string(out))
+		}
+	}
+	if host == "" {
+		host = "unix:///var/run/docker.sock"
+	}
+	socket, ok := strings.CutPrefix(host, "unix://")
+	if !ok {
+		return "", fmt.Errorf("--docker-access needs a daemon on a unix socket, not %s", host)
+	}
+	return socket, nil
+}
+
+// startDockerProxy serves the proxy on a socket in dir and returns the
+// socket's file name.
+func startDockerProxy(dir string, p *dockerProxy) (string, func(), error) {
+	return startBridge(dir, dockerBridgeSocket, "", "", p)
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestValidateDockerAccess(t *testing.T) {
+	for _, mode := range []string{"", dockerAccessNone, dockerAccessReadonly, dockerAccessFiltered} {
+		if err := validateDockerAccess(mode); err != nil {
+			t.Fatalf("validateDockerAccess(%q): %v", mode, err)
+		}
+	}
+	if err := validateDockerAccess("full"); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+}
+
+func testWorkspaceRoots(t *testing.T) (string, string, []workspaceRoot) {
+	t.Helper()
+	base := t.TempDir()
+	work := filepath.Join(base, "repo")
+	shared := filepath.Join(base, "shared")
+	mustMkdirAll(t, filepath.Join(work, "data"))
+	mustMkdirAll(t, shared)
+	if err := os.Symlink("/etc", filepath.Join(work, "escape")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	plan := launchPlan{workDir: work, addDirs: []mountSpec{{src: shared, dst: workspacesRoot + "/shared", readOnly: true}}}
+	return work, shared, sessionWorkspaceRoots(plan)
+}
+
+func filterRequest(t *testing.T, f *dockerAPIFilter, method, target string, body any) (map[string]any, error) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		reader = bytes.NewReader(content)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	if err := f.check(r); err != nil {
+		return nil, err
+	}
+	out := map[string]any{}
+	if content, _ := io.ReadAll(r.Body); len(content) > 0 {
+		if err := json.Unmarshal(content, &out); err != nil {
+			t.Fatalf("decode rewritten body: %v", err)
+		}
+	}
+	return out, nil
+}
+
+func TestDockerAPIFilterReadonly(t *testing.T) {
+	f := &dockerAPIFilter{mode: dockerAccessReadonly}
+	if _, err := filterRequest(t, f, http.MethodGet, "/v1.43/containers/json", nil); err != nil {
+		t.Fatalf("GET denied: %v", err)
+	}
+	if _, err := filterRequest(t, f, http.MethodPost, "/v1.43/containers/create", map[string]any{"Image": "alpine"}); err == nil {
+		t.Fatal("expected create to be denied in readonly mode")
+	}
+	for _, target := range []string{
+		"/v1.43/containers/abc/attach/ws?stdin=1", "/v1.43/containers/abc/archive?path=/", "/v1.43/containers/abc/export",
+		"/v1.43/containers/abc/json", "/v1.43/containers/abc/logs?stdout=1", "/v1.43/exec/e1/json", "/v1.43/images/alpine/get",
+	} {
+		if _, err := filterRequest(t, f, http.MethodGet, target, nil); err == nil {
+			t.Fatalf("expected GET %s to be denied in readonly mode", target)
+		}
+	}
+	for _, target := range []string{"/v1.43/images/json", "/v1.43/volumes", "/_ping", "/v1.43/info"} {
+		if _, err := filterRequest(t, f, http.MethodGet, target, nil); err != nil {
+			t.Fatalf("GET %s denied: %v", target, err)
+		}
+	}
+}
+
+func TestDockerAPIFilterContainerCreate(t *testing.T) {
+	work, shared, roots := testWorkspaceRoots(t)
+	f := &dockerAPIFilter{mode: dockerAccessFiltered, roots: roots}
+	create := func(hc map[string]any) (map[string]any, error) {
+		return filterRequest(t, f, http.MethodPost, "/v1.43/containers/create?name=db", map[string]any{"Image": "postgres", "HostConfig": hc})
+	}
+
+	for name, hc := range map[string]map[string]any{
+		"privileged":      {"Privileged": true},
+		"host network":    {"NetworkMode": "host"},
+		"host pid":        {"PidMode": "host"},
+		"devices":         {"Devices": []any{map[string]any{"PathOnHost": "/dev/sda"}}},
+		"bind outside":    {"Binds": []any{"/etc:/host-etc"}},
+		"bind home":       {"Binds": []any{"/app/../..:/x"}},
+		"symlink escape":  {"Binds": []any{"/app/escape:/x"}},
+		"subdirectory":    {"Binds": []any{"/app/data:/x"}},
+		"host subdir":     {"Binds": []any{work + "/data:/x"}},
+		"mount outside":   {"Mounts": []any{map[string]any{"Type": "bind", "Source": "/var/run/docker.sock", "Target": "/s"}}},
+		"rw of ro dir":    {"Binds": []any{workspacesRoot + "/shared:/shared"}},
+		"device volume":   {"Mounts": []any{map[string]any{"Type": "volume", "Target": "/d", "VolumeOptions": map[string]any{"DriverConfig": map[string]any{"Options": map[string]any{"device": "/dev/sda1", "type": "ext4"}}}}}},
+		"bind volume out": {"Mounts": []any{map[string]any{"Type": "volume", "Target": "/d", "VolumeOptions": map[string]any{"DriverConfig": map[string]any{"Options": map[string]any{"device": "/etc", "o": "bind", "type": "none"}}}}}},
+		"cap add":         {"CapAdd": []any{"ALL"}},
+		"unconfined":      {"SecurityOpt": []any{"seccomp=unconfined", "apparmor=unconfined"}},
+		"volumes from":    {"VolumesFrom": []any{"other"}},
+		"container pid":   {"PidMode": "container:abc"},
+		"host cgroupns":   {"CgroupnsMode": "host"},
+		"container net":   {"NetworkMode": "container:abc"},
+		"host uts":        {"UTSMode": "host"},
+		"container ipc":   {"IpcMode": "container:abc"},
+		"device requests": {"DeviceRequests": []any{map[string]any{"Driver": "nvidia", "Count": -1}}},
+		"cgroup rules":    {"DeviceCgroupRules": []any{"b *:* rwm"}},
+		"unmask proc":     {"MaskedPaths": []any{}},
+		"sysctls":         {"Sysctls": map[string]any{"kernel.shm_rmid_forced": "1"}},
+		"runtime":         {"Runtime": "custom"},
+		"lowercase field": {"privileged": true},
+		"unknown field":   {"Privileged2": true},
+		"mount case":      {"Mounts": []any{map[string]any{"type": "bind", "source": "/", "target": "/host"}}},
+		"volume driver":   {"Mounts": []any{map[string]any{"Type": "volume", "Target": "/d", "VolumeOptions": map[string]any{"DriverConfig": map[string]any{"Name": "sshfs"}}}}},
+	} {
+		if _, err := create(hc); err == nil {
+			t.Fatalf("%s: expected the create call to be denied", name)
+		}
+	}
+
+	out, err := create(map[string]any{
+		"Binds":       []any{"/app:/var/lib/postgresql/data", "pgdata:/backup", workspacesRoot + "/shared:/shared:ro", work + ":/direct"},
+		"Mounts":      []any{map[string]any{"Type": "bind", "Source": "/app", "Target": "/src"}},
+		"NetworkMode": "bridge",
+		"Memory":      1 << 30,
+	})
+	if err != nil {
+		t.Fatalf("allowed create denied: %v", err)
+	}
+	hc := out["HostConfig"].(map[string]any)
+	binds := hc["Binds"].([]any)
+	for i, want := range []string{
+		work + ":/var/lib/postgresql/data",
+		"pgdata:/backup",
+		shared + ":/shared:ro",
+		work + ":/direct",
+	} {
+		if binds[i] != want {
+			t.Fatalf("bind %d = %q, want %q", i, binds[i], want)
+		}
+	}
+	if src := hc["Mounts"].([]any)[0].(map[string]any)["Source"]; src != work {
+		t.Fatalf("mount source = %v, want %s", src, work)
+	}
+	if hc["Memory"] != float64(1<<30) || out["Image"] != "postgres" {
+		t.Fatalf("unrelated fields changed: %v", out)
+	}
+}
+
+func TestDockerAPIFilterRefusesSwappableBindSources(t *testing.T) {
+	work, _, roots := testWorkspaceRoots(t)
+	f := &dockerAPIFilter{mode: dockerAccessFiltered, roots: roots}
+	create := func() error {
+		_, err := filterRequest(t, f, http.MethodPost, "/v1.43/containers/create", map[string]any{"Image": "alpine", "HostConfig": map[string]any{"Binds": []any{"/app/data:/w"}}})
+		return err
+	}
+
+	// A plain directory is refused too: the daemon resolves the source again
+	// at start, after the session could have swapped it for a link.
+	if err := create(); err == nil {
+		t.Fatal("expected a bind of a directory below /app to be denied")
+	}
+	data := filepath.Join(work, "data")
+	if err := os.Remove(data); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := os.Symlink("/", data); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := create(); err == nil {
+		t.Fatal("expected a bind of a swapped directory to be denied")
+	}
+}
+
+func TestDockerAPIFilterRefusesGuardedWorkspace(t *testing.T) {
+	work, shared, _ := testWorkspaceRoots(t)
+	plan := launchPlan{
+		workDir:   work,
+		addDirs:   []mountSpec{{src: shared, dst: workspacesRoot + "/shared", readOnly: true}},
+		protected: []mountSpec{{src: filepath.Join(work, ".git", "hooks"), dst: "/app/.git/hooks", readOnly: true}},
+	}
+	f := &dockerAPIFilter{mode: dockerAccessFiltered, roots: sessionWorkspaceRoots(plan)}
+	for _, bind := range []string{"/app:/w", "/app:/w:ro", work + ":/w"} {
+		if _, err := filterRequest(t, f, http.MethodPost, "/v1.43/containers/create", map[string]any{"Image": "alpine", "HostConfig": map[string]any{"Binds": []any{bind}}}); err == nil {
+			t.Fatalf("bind %s of a workspace with protected paths should be denied", bind)
+		}
+	}
+	if _, err := filterRequest(t, f, http.MethodPost, "/v1.43/containers/create", map[string]any{"Image": "alpine", "HostConfig": map[string]any{"Binds": []any{workspacesRoot + "/shared:/s:ro"}}}); err != nil {
+		t.Fatalf("bind of an unguarded root denied: %v", err)
+	}
+
+	plan.protected = nil
+	plan.masks = []maskSpec{{rel: ".env"}}
+	f = &dockerAPIFilter{mode: dockerAccessFiltered, roots: sessionWorkspaceRoots(plan)}
+	if _, err := filterRequest(t, f, http.MethodPost, "/v1.43/containers/create", map[string]any{"Image": "alpine", "HostConfig": map[string]any{"Binds": []any{"/app:/w"}}}); err == nil {
+		t.Fatal("bind of a workspace with masks should be denied")
+	}
+}
+
+func TestDockerAPIFilterFoldsFieldNames(t *testing.T) {
+	_, _, roots := testWorkspaceRoots(t)
+	f := &dockerAPIFilter{mode: dockerAccessFiltered, roots: roots}
+	for name, body := range map[string]string{
+		"lowercase host config": `{"Image":"alpine","hostconfig":{"Privileged":true,"Binds":["/:/host"]}}`,
+		"duplicate host config": `{"Image":"alpine","HostConfig":{},"hostConfig":{"Privileged":true}}`,
+		"duplicate field":       `{"Image":"alpine","HostConfig":{"Privileged":false,"PRIVILEGED":true}}`,
+		"unknown top level":     `{"Image":"alpine","Evil":1}`,
+		"folded binds":          `{"Image":"alpine","HostConfig":{"bInDs":["/etc:/etc"]}}`,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/v1.43/containers/create", strings.NewReader(body))
+		if err := f.check(r); err == nil {
+			t.Fatalf("%s: expected the create call to be denied", name)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1.43/containers/create", strings.NewReader(`{"image":"alpine","hostconfig":{"binds":["/app:/data"],"securityopt":["no-new-privileges"]}}`))
+	if err := f.check(r); err != nil {
+		t.Fatalf("allowed create denied: %v", err)
+	}
+	content, _ := io.ReadAll(r.Body)
+	if !strings.Contains(string(content), `"HostConfig":{"Binds":[`) || strings.Contains(string(content), "hostconfig") {
+		t.Fatalf("body not canonicalized: %s", content)
+	}
+}
+
+// fakeInspect resolves container refs to themselves and the execs e1 and e2
+// to the containers abc and other.
+func fakeInspect(kind, ref string) (string, error) {
+	if kind == "volumes" && !slices.Contains([]string{"mine", "hostvol"}, ref) {
+		return "", errors.New("no such volume")
+	}
+	if kind == "exec" {
+		id, ok := map[string]string{"e1": "abc", "e2": "other"}[ref]
+		if !ok {
+			return "", errors.New("no such exec")
+		}
+		return id, nil
+	}
+	return ref, nil
+}
+
+func TestDockerAPIFilterOtherEndpoints(t *testing.T) {
+	_, _, roots := testWorkspaceRoots(t)
+	f := &dockerAPIFilter{mode: dockerAccessFiltered, roots: roots, inspect: fakeInspect}
+	f.own("containers", "abc")
+	f.own("volumes", "mine")
+	f.own("networks", "net1")
+	f.own("images", "img1")
+	for _, tt := range []struct {
+		method, target string
+		body           any
+		ok             bool
+	}{
+		{http.MethodPost, "/containers/abc/start", nil, true},
+		{http.MethodDelete, "/v1.43/containers/abc?force=1", nil, true},
+		{http.MethodPost, "/v1.43/containers/abc/exec", map[string]any{"Cmd": []string{"sh"}}, true},
+		{http.MethodPost, "/v1.43/containers/abc/exec", map[string]any{"Cmd": []string{"sh"}, "Privileged": true}, false},
+		{http.MethodPost, "/v1.43/volumes/create", map[string]any{"Name": "cache"}, true},
+		{http.MethodPost, "/v1.43/volumes/create", map[string]any{"Name": "x", "DriverOpts": map[string]any{"type": "none", "o": "bind", "device": "/root"}}, false},
+		{http.MethodPost, "/v1.43/volumes/create", map[string]any{"Name": "x", "DriverOpts": map[string]any{"type": "none", "o": "bind", "device": "/app"}}, true},
+		{http.MethodPost, "/v1.43/volumes/create", map[string]any{"Name": "x", "DriverOpts": map[string]any{"type": "none", "o": "bind", "device": "/app/data"}}, false},
+		{http.MethodPost, "/v1.43/volumes/create", map[string]any{"Name": "x", "driver": "sshfs"}, false},
+		{http.MethodPost, "/v1.43/containers/abc/update", map[string]any{"Memory": 1 << 20}, true},
+		{http.MethodPost, "/v1.43/containers/abc/update", map[string]any{"devicecgrouprules": []string{"b *:* rwm"}}, false},
+		{http.MethodPost, "/v1.43/containers/abc/exec", map[string]any{"Cmd": []string{"sh"}, "privileged": true}, false},
+		{http.MethodPost, "/v1.43/containers/./create", map[string]any{"Image": "alpine"}, false},
+		{http.MethodPost, "/v1.43/build?networkmode=host", nil, false},
+		{http.MethodPost, "/v1.43/build?NetworkMode=host", nil, false},
+		{http.MethodPost, "/v1.43/build?t=app", nil, true},
+		{http.MethodPost, "/v1.43/plugins/pull?remote=x", nil, false},
+		{http.MethodPost, "/v1.43/services/create", map[string]any{}, false},
+		{http.MethodPost, "/v1.43/containers/other/start", nil, false},
+		{http.MethodPost, "/v1.43/containers/other/kill", nil, false},
+		{http.MethodDelete, "/v1.43/containers/other", nil, false},
+		{http.MethodPost, "/v1.43/containers/other/exec", map[string]any{"Cmd": []string{"sh"}}, false},
+		{http.MethodPut, "/v1.43/containers/other/archive?path=/", nil, false},
+		{http.MethodGet, "/v1.43/containers/other/archive?path=/", nil, false},
+		{http.MethodGet, "/v1.43/containers/other/export", nil, false},
+		{http.MethodGet, "/v1.43/containers/other/attach/ws?stdin=1", nil, false},
+		{http.MethodGet, "/v1.43/containers/abc/attach/ws?stdin=1", nil, true},
+		{http.MethodGet, "/v1.43/containers/other/json", nil, false},
+		{http.MethodGet, "/v1.43/containers/other/logs?stdout=1", nil, false},
+		{http.MethodGet, "/v1.43/containers/abc/json", nil, true},
+		{http.MethodGet, "/v1.43/exec/e2/json", nil, false},
+		{http.MethodDelete, "/v1.43/volumes/mine", nil, true},
+		{http.MethodDelete, "/v1.43/volumes/hostvol", nil, false},
+		{http.MethodPost, "/v1.43/volumes/create", map[string]any{"Name": "hostvol"}, false},
+		{http.MethodPost, "/v1.43/volumes/create", map[string]any{"Name": "mine"}, true},
+		{http.MethodDelete, "/v1.43/images/img1", nil, true},
+		{http.MethodDelete, "/v1.43/images/library/alpine:latest", nil, false},
+		{http.MethodDelete, "/v1.43/networks/net1", nil, true},
+		{http.MethodDelete, "/v1.43/networks/hostnet", nil, false},
+		{http.MethodPost, "/v1.43/networks/net1/connect", map[string]any{"Container": "abc"}, true},
+		{http.MethodPost, "/v1.43/networks/net1/connect", map[string]any{"container": "other"}, false},
+		{http.MethodPost, "/v1.43/networks/hostnet/connect", map[string]any{"Container": "abc"}, false},
+		{http.MethodPost, "/v1.43/networks/hostnet/disconnect", map[string]any{"Container": "abc", "Force": true}, false},
+		{http.MethodPost, "/v1.43/networks/create", map[string]any{"Name": "net2"}, true},
+		{http.MethodPost, "/v1.43/exec/e1/start", map[string]any{}, true},
+		{http.MethodPost, "/v1.43/exec/e2/start", map[string]any{}, false},
+		{http.MethodPost, "/v1.43/exec/missing/start", map[string]any{}, false},
+		{http.MethodPost, "/v1.43/commit?container=other", nil, false},
+		{http.MethodPost, "/v1.43/commit?container=abc", nil, true},
+		{http.MethodPost, "/v1.43/containers/prune", nil, false},
+		{http.MethodPost, "/v1.43/images/prune", nil, false},
+	} {
+		if _, err := filterRequest(t, f, tt.method, tt.target, tt.body); (err == nil) != tt.ok {
+			t.Fatalf("%s %s: error = %v, want ok=%v", tt.method, tt.target, err, tt.ok)
+		}
+	}
+}
+
+func TestBuiltImageReaderOwnsReportedImage(t *testing.T) {
+	stream := `{"stream":"Step 1/2 : FROM alpine"}` + "\r\n" +
+		`{"id":"moby.image.id","aux":{"ID":"sha256:built"}}` + "\r\n" +
+		`{"aux":"bm90IGFuIGltYWdl"}`
+	f := &dockerAPIFilter{mode: dockerAccessFiltered, inspect: fakeInspect}
+	r := &builtImageReader{ReadCloser: io.NopCloser(iotest.OneByteReader(strings.NewReader(stream))), own: func(id string) { f.own("images", id) }}
+	out, err := io.ReadAll(r)
+	if err != nil || string(out) != stream {
+		t.Fatalf("stream changed in transit: %q, %v", out, err)
+	}
+	if err := f.checkOwned("images", "sha256:built"); err != nil {
+		t.Fatalf("built image not owned: %v", err)
+	}
+	if len(f.owned) != 1 {
+		t.Fatalf("owned = %v", f.owned)
+	}
+}
+
+// fakeEngine records the calls that reach it and answers like the daemon.
+type fakeEngine struct {
+	calls []string
+	body  string
+}
+
+func (e *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	content, _ := io.ReadAll(r.Body)
+	e.calls = append(e.calls, r.Method+" "+r.URL.Path)
+	e.body = string(content)
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		// Inspect: a container is known by its own name.
+		ref := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/containers/"), "/json")
+		fmt.Fprintf(w, `{"Id":%q}`, ref)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/containers/create") {
+		w.WriteHeader(http.StatusCreated)
+	}
+	io.WriteString(w, `{"Id":"abc"}`)
+}
+
+func TestDockerProxyForwardsAllowedCalls(t *testing.T) {
+	work, _, roots := testWorkspaceRoots(t)
+	dir := t.TempDir()
+
+	engine := &fakeEngine{}
+	upstream := filepath.Join(dir, "engine.sock")
+	listener, err := net.Listen("unix", upstream)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &http.Server{Handler: engine}
+	go server.Serve(listener)
+	defer server.Close()
+
+	var log bytes.Buffer
+	proxyDir := filepath.Join(dir, "docker")
+	socket, stop, err := startDockerProxy(proxyDir, newDockerProxy(upstream, &dockerAPIFilter{mode: dockerAccessFiltered, roots: roots}, &log))
+	if err != nil {
+		t.Fatalf("start proxy: %v", err)
+	}
+	defer stop()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", filepath.Join(proxyDir, socket))
+		},
+	}}
+	post := func(path, body string) (int, string) {
+		resp, err := client.Post("http://docker"+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		defer resp.Body.Close()
+		out, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(out)
+	}
+
+	status, body := post("/v1.43/containers/create", `{"Image":"redis","HostConfig":{"Privileged":true}}`)
+	if status != http.StatusForbidden || !strings.Contains(body, "privileged") {
+		t.Fatalf("privileged create = %d %s", status, body)
+	}
+	if len(engine.calls) != 0 {
+		t.Fatalf("denied call reached the daemon: %v", engine.calls)
+	}
+	if !strings.Contains(log.String(), "denied docker API call POST /v1.43/containers/create") {
+		t.Fatalf("denied call not logged: %q", log.String())
+	}
+
+	status, body = post("/v1.43/containers/abc/start", "")
+	if status != http.StatusForbidden || len(engine.calls) != 1 {
+		t.Fatalf("start before create = %d %s, daemon saw %v", status, body, engine.calls)
+	}
+
+	status, body = post("/v1.43/containers/create", `{"Image":"redis","HostConfig":{"Binds":["/app:/data"]}}`)
+	if status != http.StatusCreated || !strings.Contains(body, "abc") {
+		t.Fatalf("allowed create = %d %s", status, body)
+	}
+	if !strings.Contains(engine.body, work+":/data") {
+		t.Fatalf("daemon saw %v with body %s", engine.calls, engine.body)
+	}
+
+	status, body = post("/v1.43/containers/abc/start", "")
+	if status != http.StatusCreated && status != http.StatusOK {
+		t.Fatalf("start of the session's container = %d %s", status, body)
+	}
+	status, body = post("/v1.43/containers/someone-else/start", "")
+	if status != http.StatusForbidden || !strings.Contains(body, "did not create") {
+		t.Fatalf("start of another container = %d %s", status, body)
+	}
+}
+
+func TestBuildDockerArgsMountsDockerProxy(t *testing.T) {
+	plan := launchPlan{
+		image:        "repo/image:latest",
+		workDir:      "/home/me/repo",
+		command:      []string{"zsh"},
+		dockerAccess: &dockerAccessPlan{mode: dockerAccessFiltered, dir: "/run/user/1000/dockerx/session-1/docker", socket: "docker-0a1b.sock"},
+	}
+	args, err := buildDockerArgs(plan)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if !containsPair(args, "--mount", "type=bind,src=/run/user/1000/dockerx/session-1/docker,dst="+dockerBridgeMount+",readonly") {
+		t.Fatalf("missing proxy mount in %v", args)
+	}
+	if !containsPair(args, "--env", "DOCKER_HOST=unix://"+dockerBridgeMount+"/docker-0a1b.sock") {
+		t.Fatalf("missing DOCKER_HOST in %v", args)
+	}
+}
@@ -129,14 +129,47 @@ if [ "$(id -u)" -ne 0 ]; then
   done
 
   export USER HOME
-  export CODEX_HOME="$HOME/.codex"
+  # Tool presets set CODEX_HOME under /home/dev; follow HOME if it moved.
+  if [ -n "${CODEX_HOME:-}" ]; then
+    export CODEX_HOME="$HOME/.codex"
+  fi
   export XDG_CACHE_HOME="$HOME/.cache"
 fi
 
 copy_staged_configs
 
-cmd_status=0
-"$@" || cmd_status=$?
+# dockerx --reuse re-runs the copy in a warm container when host configs change.
+if [ "${DOCKERX_CONFIG_REFRESH:-}" = "1" ]; then
+  exit 0
+fi
+
+# As PID 1 this shell ignores signals it has no trap for, so SIGTERM and
+# SIGHUP from docker would never reach the command. Run it in the background
+# and pass them on; with a tty, Ctrl-C already reaches it from the terminal.
+# Without job control a background command reads /dev/null unless its stdin
+# is redirected explicitly.
+exec 3<&0
+"$@" 0<&3 3<&- &
+cmd_pid=$!
+exec 3<&-
+forward_signal() {
+  kill -s "$1" "$cmd_pid" 2>/dev/null || true
+}
+trap 'forward_signal TERM' TERM
+trap 'forward_signal HUP' HUP
+if [ ! -t 0 ]; then
+  trap 'forward_signal INT' INT
+fi
+
+# A trapped signal ends wait early; wait again until the command has exited.
+while :; do
+  cmd_status=0
+  wait "$cmd_pid" || cmd_status=$?
+  if ! kill -0 "$cmd_pid" 2>/dev/null; then
+    break
+  fi
+done
+trap - TERM HUP INT
 
 print_staged_config_diffs
 exit "$cmd_status"
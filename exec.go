@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// projectLabel records the host project directory on every dockerx
+// container; toolLabel records the tool preset it was launched with and
+// envLabel the comma-separated passthrough env keys it was given, after the
+// image policy ran.
+const (
+	projectLabel = "dockerx.project"
+	toolLabel    = "dockerx.tool"
+	envLabel     = "dockerx.env"
+)
+
+// sessionContainer is a running dockerx container as listed by docker ps.
+type sessionContainer struct {
+	id         string
+	project    string
+	tool       string
+	env        string
+	name       string
+	runningFor string
+	command    string
+}
+
+func runExec(args []string) int {
+	flags := flag.NewFlagSet("exec", flag.ContinueOnError)
+	shell := flags.String("shell", "zsh", "Shell to start when no command is provided")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if err := execDockerx(*shell, flags.Args()); err != nil {
+		var status exitStatusError
+		if errors.As(err, &status) {
+			return status.code
+		}
+		fmt.Fprintf(os.Stderr, "dockerx: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func execDockerx(shell string, command []string) error {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return errors.New("docker executable not found in PATH")
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("resolve current directory: %w", err)
+	}
+	workDir, err = filepath.Abs(workDir)
+	if err != nil {
+		return fmt.Errorf("resolve current directory: %w", err)
+	}
+
+	containers, err := listSessionContainers()
+	if err != nil {
+		return err
+	}
+	containers = projectContainers(containers, workDir)
+
+	var prompt io.Reader
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		prompt = os.Stdin
+	}
+	container, err := chooseContainer(containers, workDir, prompt, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	user, err := containerUser(container.id)
+	if err != nil {
+		return err
+	}
+	if len(command) == 0 {
+		command = []string{shell}
+	}
+	tty := term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+	relay := startTerminalRelay()
+	defer relay.stop()
+	if command, err = relayExecSignals(relay, container.id, user, command); err != nil {
+		return err
+	}
+	// Pass exactly the env the session was launched with, so a policy that
+	// stripped credentials at launch also holds here.
+	args := buildExecArgs(container, workDir, user, labelEnvKeys(container.env), nil, tty, command)
+
+	cmd := exec.Command("docker", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	runErr := relay.run(cmd)
+	if code := exitCode(runErr); code > 0 {
+		return exitStatusError{code: code}
+	}
+	if runErr != nil {
+		return fmt.Errorf("docker exec failed: %w", runErr)
+	}
+	return nil
+}
+
+func listSessionContainers() ([]sessionContainer, error) {
+	format := "{{.ID}}\t{{.Label \"" + projectLabel + "\"}}\t{{.Label \"" + toolLabel + "\"}}\t{{.Label \"" + envLabel + "\"}}\t{{.Names}}\t{{.RunningFor}}\t{{.Command}}"
+	out, err := exec.Command("docker", "ps", "--filter", "label="+projectLabel, "--format", format).Output()
+	if err != nil {
+		return nil, fmt.Errorf("list dockerx containers: %w", err)
+	}
+	return parseSessionContainers(string(out)), nil
+}
+
+func parseSessionContainers(out string) []sessionContainer {
+	var containers []sessionContainer
+	for _, line := range splitLines(out) {
+		fields := strings.SplitN(line, "\t", 7)
+		if len(fields) != 7 {
+			continue
+		}
+		containers = append(containers, sessionContainer{
+			id:         fields[0],
+			project:    fields[1],
+			tool:       fields[2],
+			env:        fields[3],
+			name:       fields[4],
+			runningFor: fields[5],
+			command:    strings.Trim(fields[6], `"`),
+		})
+	}
+	return containers
+}
+
+// labelEnvKeys splits the env label. Containers from before the label get no
+// env.
+func labelEnvKeys(label string) []string {
+	var keys []string
+	for _, key := range strings.Split(label, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// projectContainers keeps the sessions whose project contains workDir, so
+// exec also works from a subdirectory of the project.
+func projectContainers(containers []sessionContainer, workDir string) []sessionContainer {
+	var out []sessionContainer
+	for _, c := range containers {
+		if c.project != "" && pathWithin(workDir, c.project) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// chooseContainer returns the only session, or asks which one to use when
+// there are several. prompt is nil when stdin is not a terminal.
+func chooseContainer(containers []sessionContainer, workDir string, prompt io.Reader, w io.Writer) (sessionContainer, error) {
+	switch {
+	case len(containers) == 0:
+		return sessionContainer{}, fmt.Errorf("no running dockerx session for %s", workDir)
+	case len(containers) == 1:
+		return containers[0], nil
+	case prompt == nil:
+		return sessionContainer{}, fmt.Errorf("%d dockerx sessions are running for %s; run from a terminal to choose one", len(containers), workDir)
+	}
+
+	fmt.Fprintf(w, "Several dockerx sessions are running for %s:\n", workDir)
+	for i, c := range containers {
+		fmt.Fprintf(w, "  %d) %s  %s  up %s  %s\n", i+1, c.name, c.id, c.runningFor, c.command)
+	}
+	reader := bufio.NewReader(prompt)
+	for {
+		fmt.Fprintf(w, "Choose a session [1-%d]: ", len(containers))
+		line, err := reader.ReadString('\n')
+		if n, convErr := strconv.Atoi(strings.TrimSpace(line)); convErr == nil && n >= 1 && n <= len(containers) {
+			return containers[n-1], nil
+		}
+		if err != nil {
+			return sessionContainer{}, errors.New("no session chosen")
+		}
+	}
+}
+
+func containerUser(id string) (string, error) {
+	out, err := exec.Command("docker", "inspect", "--format", "{{.Config.User}}", id).Output()
+	if err != nil {
+		return "", fmt.Errorf("inspect container %s: %w", id, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// execPIDScript records the PID of a docker exec command in the file named
+// by $0 before running it. docker exec does not pass signals on, so the relay
+// delivers them with a second exec that reads the file.
+const execPIDScript = `echo $$ > "$0" && exec "$@"`
+
+// execKillScript sends the signal named by $1 to the PID in the file $0.
+const execKillScript = `kill -s "$1" "$(cat "$0")"`
+
+// relayExecSignals wraps command so that signals the relay receives reach it
+// in container id, where it runs as user.
+func relayExecSignals(relay *signalRelay, id, user string, command []string) ([]string, error) {
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("name exec pid file: %w", err)
+	}
+	pidFile := "/tmp/dockerx-exec-" + hex.EncodeToString(suffix) + ".pid"
+	relay.deliverWith(func(sig os.Signal) {
+		args := []string{"exec"}
+		if user != "" {
+			args = append(args, "--user", user)
+		}
+		args = append(args, id, "sh", "-c", execKillScript, pidFile, signalName(sig))
+		_ = exec.Command("docker", args...).Run()
+	})
+	return append([]string{"sh", "-c", execPIDScript, pidFile}, command...), nil
+}
+
+// buildExecArgs starts command in the session as the same user, in the
+// directory matching workDir under /app, with the host's passthrough env and
+// the KEY=VALUE pairs in env.
+func buildExecArgs(c sessionContainer, workDir, user string, envKeys, env []string, tty bool, command []string) []string {
+	args := []string{"exec", "-i"}
+	if tty {
+		args = append(args, "-t")
+	}
+	if user != "" {
+		args = append(args, "--user", user)
+	}
+	args = append(args, "--workdir", containerWorkdir(c.project, workDir))
+	for _, key := range envKeys {
+		args = append(args, "--env", key)
+	}
+	for _, pair := range env {
+		args = append(args, "--env", pair)
+	}
+	args = append(args, c.id)
+	return append(args, command...)
+}
+
+func containerWorkdir(project, workDir string) string {
+	rel, err := filepath.Rel(project, workDir)
+	if err != nil || rel == "." {
+		return "/app"
+	}
+	return "/app/" + filepath.ToSlash(rel)
+}
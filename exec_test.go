@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSessionContainers(t *testing.T) {
+	out := "abc123\t/home/me/app\t\t\tbrave_turing\t5 minutes\t\"/entrypoint.sh zsh\"\n" +
+		"def456\t/home/me/other dir\tcodex\tTERM,OPENAI_API_KEY\tquiet_hopper\t2 hours\t\"/entrypoint.sh codex\"\n" +
+		"garbage line\n"
+	got := parseSessionContainers(out)
+	want := []sessionContainer{
+		{id: "abc123", project: "/home/me/app", name: "brave_turing", runningFor: "5 minutes", command: "/entrypoint.sh zsh"},
+		{id: "def456", project: "/home/me/other dir", tool: "codex", env: "TERM,OPENAI_API_KEY", name: "quiet_hopper", runningFor: "2 hours", command: "/entrypoint.sh codex"},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("parseSessionContainers = %+v, want %+v", got, want)
+	}
+}
+
+func TestProjectContainersMatchesSubdirectories(t *testing.T) {
+	containers := []sessionContainer{
+		{id: "a", project: "/home/me/app"},
+		{id: "b", project: "/home/me/app-two"},
+		{id: "c", project: "/home/me"},
+		{id: "d"},
+	}
+	got := projectContainers(containers, "/home/me/app/src")
+	if len(got) != 2 || got[0].id != "a" || got[1].id != "c" {
+		t.Fatalf("projectContainers = %+v", got)
+	}
+}
+
+func TestChooseContainer(t *testing.T) {
+	one := []sessionContainer{{id: "a", name: "first"}}
+	two := []sessionContainer{{id: "a", name: "first"}, {id: "b", name: "second"}}
+
+	if _, err := chooseContainer(nil, "/w", nil, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "no running dockerx session") {
+		t.Fatalf("expected no-session error, got %v", err)
+	}
+	if c, err := chooseContainer(one, "/w", nil, &bytes.Buffer{}); err != nil || c.id != "a" {
+		t.Fatalf("single session = %+v, %v", c, err)
+	}
+	if _, err := chooseContainer(two, "/w", nil, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected an error when several sessions run without a terminal")
+	}
+
+	var out bytes.Buffer
+	c, err := chooseContainer(two, "/w", strings.NewReader("9\nx\n2\n"), &out)
+	if err != nil || c.id != "b" {
+		t.Fatalf("prompted choice = %+v, %v", c, err)
+	}
+	if strings.Count(out.String(), "Choose a session [1-2]") != 3 || !strings.Contains(out.String(), "2) second") {
+		t.Fatalf("unexpected prompt output:\n%s", out.String())
+	}
+	if _, err := chooseContainer(two, "/w", strings.NewReader(""), &bytes.Buffer{}); err == nil {
+		t.Fatal("expected an error when the prompt gets no answer")
+	}
+}
+
+func TestBuildExecArgs(t *testing.T) {
+	c := sessionContainer{id: "abc123", project: "/home/me/app"}
+	got := buildExecArgs(c, "/home/me/app/web/src", "1000:1000", []string{"TERM", "OPENAI_API_KEY"}, []string{"DOCKERX_GIT_SOCKET=/run/dockerx/git/credential-1.sock"}, true, []string{"tail", "-f", "log.txt"})
+	want := []string{
+		"exec", "-i", "-t",
+		"--user", "1000:1000",
+		"--workdir", "/app/web/src",
+		"--env", "TERM",
+		"--env", "OPENAI_API_KEY",
+		"--env", "DOCKERX_GIT_SOCKET=/run/dockerx/git/credential-1.sock",
+		"abc123", "tail", "-f", "log.txt",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("buildExecArgs =\n %q\nwant\n %q", got, want)
+	}
+
+	got = buildExecArgs(c, "/home/me/app", "", nil, nil, false, []string{"zsh"})
+	if !slices.Equal(got, []string{"exec", "-i", "--workdir", "/app", "abc123", "zsh"}) {
+		t.Fatalf("buildExecArgs without user or tty = %q", got)
+	}
+}
+
+func TestBuildDockerArgsLabelsProject(t *testing.T) {
+	args, err := buildDockerArgs(launchPlan{image: "repo/image:latest", workDir: "/home/me/app", command: []string{"zsh"}})
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if !containsPair(args, "--label", projectLabel+"=/home/me/app") {
+		t.Fatalf("missing project label in %v", args)
+	}
+}
+
+func TestBuildDockerArgsLabelsEnvKeys(t *testing.T) {
+	args, err := buildDockerArgs(launchPlan{image: "repo/image:latest", workDir: "/home/me/app", command: []string{"zsh"}, envKeys: []string{"TERM", "LANG"}})
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if !containsPair(args, "--label", envLabel+"=TERM,LANG") {
+		t.Fatalf("missing env label in %v", args)
+	}
+	if got := labelEnvKeys("TERM,LANG"); !slices.Equal(got, []string{"TERM", "LANG"}) {
+		t.Fatalf("labelEnvKeys = %q", got)
+	}
+	if got := labelEnvKeys(""); got != nil {
+		t.Fatalf("labelEnvKeys of a missing label = %q", got)
+	}
+}
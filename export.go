@@ -0,0 +1,733 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	exportCompose      = "compose"
+	exportScript       = "script"
+	exportDevcontainer = "devcontainer"
+)
+
+// runOptions is the docker run invocation from buildDockerArgs split back
+// into its parts, so exporters can render each setting in their own syntax.
+type runOptions struct {
+	interactive bool
+	tty         bool
+	remove      bool
+	readOnly    bool
+	pull        string
+	capDrop     []string
+	capAdd      []string
+	mounts      []string
+	tmpfs       []string
+	workdir     string
+	user        string
+	userns      string
+	env         []string
+	image       string
+	command     []string
+}
+
+// parseRunArgs splits docker run args. Flags it does not know are rejected so
+// a new hardening flag in buildDockerArgs cannot be dropped from exports
+// silently.
+func parseRunArgs(args []string) (runOptions, error) {
+	if len(args) == 0 || args[0] != "run" {
+		return runOptions{}, errors.New("expected docker run args")
+	}
+
+	var opts runOptions
+	i := 1
+	next := func(flag string) (string, error) {
+		if i+1 >= len(args) {
+			return "", fmt.Errorf("docker flag %s is missing its value", flag)
+		}
+		i++
+		return args[i], nil
+	}
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			break
+		}
+
+		var err error
+		var value string
+		switch arg {
+		case "-i":
+			opts.interactive = true
+		case "-t":
+			opts.tty = true
+		case "--rm":
+			opts.remove = true
+		case "--read-only":
+			opts.readOnly = true
+		case "--pull":
+			opts.pull, err = next(arg)
+		case "--cap-drop":
+			value, err = next(arg)
+			opts.capDrop = append(opts.capDrop, value)
+		case "--cap-add":
+			value, err = next(arg)
+			opts.capAdd = append(opts.capAdd, value)
+		case "--mount":
+			value, err = next(arg)
+			opts.mounts = append(opts.mounts, value)
+		case "--tmpfs":
+			value, err = next(arg)
+			opts.tmpfs = append(opts.tmpfs, value)
+		case "--workdir":
+			opts.workdir, err = next(arg)
+		case "--user":
+			opts.user, err = next(arg)
+		case "--userns":
+			opts.userns, err = next(arg)
+		case "--env":
+			value, err = next(arg)
+			opts.env = append(opts.env, value)
+		case "--label":
+			// The session label ties a container to its host project
+			// path; only the script export, which runs from the project
+			// directory, keeps it.
+			_, err = next(arg)
+		default:
+			return runOptions{}, fmt.Errorf("export does not support docker flag %q", arg)
+		}
+		if err != nil {
+			return runOptions{}, err
+		}
+	}
+	if i >= len(args) {
+		return runOptions{}, errors.New("docker run args are missing the image")
+	}
+	opts.image = args[i]
+	opts.command = args[i+1:]
+	return opts, nil
+}
+
+// bindMount is a parsed --mount type=bind value.
+type bindMount struct {
+	source   string
+	target   string
+	readOnly bool
+}
+
+func parseBindMount(value string) (bindMount, error) {
+	var m bindMount
+	for _, field := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(field, "=")
+		switch key {
+		case "type":
+			if val != "bind" {
+				return bindMount{}, fmt.Errorf("unsupported mount type %q", val)
+			}
+		case "src", "source":
+			m.source = val
+		case "dst", "target", "destination":
+			m.target = val
+		case "readonly", "ro":
+			m.readOnly = val == "" || val == "true" || val == "1"
+		default:
+			return bindMount{}, fmt.Errorf("unsupported mount option %q", key)
+		}
+	}
+	if m.source == "" || m.target == "" {
+		return bindMount{}, fmt.Errorf("mount %q needs a source and target", value)
+	}
+	return m, nil
+}
+
+// hostContext holds the host-specific values that exporters replace with
+// portable expressions.
+type hostContext struct {
+	workDir string
+	homeDir string
+	uidGID  string
+}
+
+// exportNotes lists settings that depend on the exporting host. Scripts
+// resolve the user with id(1) when they run, so only the other formats flag it.
+func exportNotes(format string, plan launchPlan, opts runOptions, host hostContext) []string {
+	notes := []string{
+		"Identity overlays for /etc/passwd, /etc/group and /etc/shadow are generated per host at launch and are not exported; sudo may not resolve the runtime user.",
+	}
+	switch {
+	case opts.user != "" && host.uidGID == "":
+		notes = append(notes, fmt.Sprintf("The container user %s was chosen for the exporting host's docker daemon (%s).", opts.user, plan.identity.strategy))
+	case opts.user != "" && format != exportScript:
+		notes = append(notes, fmt.Sprintf("The container user %s is the exporting host's UID:GID.", opts.user))
+	}
+	for _, m := range plan.configMounts {
+		src := plan.paths.dockerPath(m.src)
+		if host.homeDir == "" || !pathWithin(src, host.homeDir) {
+			notes = append(notes, fmt.Sprintf("Config mount %s is outside the home directory and is exported as an absolute host path.", src))
+		}
+	}
+	for _, m := range plan.addDirs {
+		src := plan.paths.dockerPath(m.src)
+		if host.homeDir == "" || !pathWithin(src, host.homeDir) {
+			notes = append(notes, fmt.Sprintf("Additional directory %s is outside the home directory and is exported as an absolute host path.", src))
+		}
+	}
+	return notes
+}
+
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", exportCompose, "Export format: compose, script or devcontainer")
+	output := flags.String("output", "", "Write to this file instead of stdout")
+	image := flags.String("image", defaultImage(), "Docker image to run")
+	shell := flags.String("shell", "zsh", "Shell to launch when no command is provided")
+	noConfig := flags.Bool("no-config", false, "Disable automatic host config mounts")
+	var addDirs addDirFlag
+	flags.Var(&addDirs, "add-dir", "Mount another host directory at /workspaces/<name>; append :ro for read-only (repeatable)")
+	allowDangerousRoot := flags.Bool("allow-dangerous-root", false, "Allow exporting from a home, root or system directory, or one containing ~/.ssh or ~/.aws")
+	usernsHost := flags.Bool("userns-host", false, "Under userns-remap, run the container in the host user namespace so --user is the host user")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	cfg := cliConfig{
+		image:              *image,
+		shell:              *shell,
+		noConfig:           *noConfig,
+		addDirs:            addDirs,
+		allowDangerousRoot: *allowDangerousRoot,
+		usernsHost:         *usernsHost,
+		command:            flags.Args(),
+	}
+	if err := exportDockerx(cfg, *format, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "dockerx: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func exportDockerx(cfg cliConfig, format, output string) error {
+	if cfg.image == "" {
+		return errors.New("image cannot be empty")
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("resolve current directory: %w", err)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("resolve user home directory: %w", err)
+	}
+	paths := detectHostPaths(getenv)
+
+	// The exported file mounts the same directories a launch would, so it
+	// gets the launch's checks.
+	userCfg, err := loadUserConfig(userConfigPath(homeDir, getenv))
+	if err != nil {
+		return err
+	}
+	addDirs, err := resolveAddDirs(collectAddDirs(cfg.addDirs, userCfg, workDir, homeDir), workDir, homeDir, paths)
+	if err != nil {
+		return err
+	}
+	if err := checkDangerousDirs(workDir, addDirs, cfg.allowDangerousRoot, userCfg, homeDir, paths); err != nil {
+		return err
+	}
+
+	image, err := applyImageLock(cfg.image, workDir, false, os.Stderr)
+	if err != nil {
+		return err
+	}
+	tools, err := loadToolRegistry(userCfg.Tools)
+	if err != nil {
+		return fmt.Errorf("%s: %w", userCfg.path, err)
+	}
+	tool, toolSpecs, command := tools.resolve(cfg.command)
+	if len(command) == 0 {
+		command = []string{cfg.shell}
+	}
+	violation, err := checkImagePolicies(homeDir, image, cfg.image)
+	if err != nil {
+		return err
+	}
+
+	// Without a daemon to ask, assume a rootful one as a launch does.
+	security, _ := inspectDaemonSecurity()
+	uidGID, hasUIDGID := hostUIDGID()
+	identity := chooseIdentity(security, uidGID, hasUIDGID, cfg.usernsHost)
+	if identity.warning != "" {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", identity.warning)
+	}
+
+	plan := launchPlan{
+		image:        image,
+		workDir:      workDir,
+		addDirs:      addDirs,
+		command:      command,
+		envKeys:      gatherPassthroughEnvKeys(toolSpecs),
+		tool:         tool,
+		containerEnv: toolContainerEnv(toolSpecs),
+		paths:        paths,
+		identity:     identity,
+	}
+	switch {
+	case violation != nil:
+		fmt.Fprintf(os.Stderr, "warning: %v; exporting without host config mounts or credential env vars\n", violation)
+		plan.envKeys = withoutCredentialEnvKeys(plan.envKeys)
+	case !cfg.noConfig:
+		plan.configMounts = discoverHostConfigMounts(toolSpecs, homeDir, getenv, pathExists, paths)
+	}
+	// The exported file masks and protects what exists now; re-export after
+	// the ignore file or the matched paths change.
+	if plan.masks, err = findMasks(workDir); err != nil {
+		return err
+	}
+	if plan.protected, _, err = protectedMounts(workDir, protectedPaths(userCfg.project(workDir, homeDir)), plan.masks); err != nil {
+		return err
+	}
+	if len(plan.masks) > 0 {
+		if plan.maskFile, err = maskFilePath(); err != nil {
+			return err
+		}
+		if err := ensureMaskFile(plan.maskFile); err != nil {
+			return err
+		}
+	}
+
+	args, err := buildDockerArgs(plan)
+	if err != nil {
+		return err
+	}
+	host := hostContext{workDir: paths.dockerPath(workDir), homeDir: paths.dockerPath(homeDir)}
+	if identity.strategy == identityHostUser {
+		// Only the host user can be swapped for whoever runs the export;
+		// the other identities depend on this host's daemon.
+		host.uidGID = identity.user
+	}
+	if homeDir == containerHome {
+		// Container paths under /home/dev would be mistaken for host paths.
+		host.homeDir = ""
+	}
+
+	var out bytes.Buffer
+	notes, err := renderExport(&out, format, plan, args, host)
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		fmt.Fprintf(os.Stderr, "note: %s\n", note)
+	}
+
+	if output == "" {
+		_, err := os.Stdout.Write(out.Bytes())
+		return err
+	}
+	mode := os.FileMode(0o644)
+	if format == exportScript {
+		mode = 0o755
+	}
+	if err := os.WriteFile(output, out.Bytes(), mode); err != nil {
+		return fmt.Errorf("write export: %w", err)
+	}
+	return nil
+}
+
+// renderExport writes plan in the given format and returns the host-specific
+// notes that were flagged in it.
+func renderExport(w io.Writer, format string, plan launchPlan, args []string, host hostContext) ([]string, error) {
+	opts, err := parseRunArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	notes := exportNotes(format, plan, opts, host)
+	switch format {
+	case exportCompose:
+		err = renderCompose(w, opts, host, notes)
+	case exportScript:
+		err = renderScript(w, args, host, notes)
+	case exportDevcontainer:
+		err = renderDevcontainer(w, opts, host, notes)
+	default:
+		err = fmt.Errorf("invalid export format %q (want compose, script or devcontainer)", format)
+	}
+	return notes, err
+}
+
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Image       string          `yaml:"image"`
+	PullPolicy  string          `yaml:"pull_policy,omitempty"`
+	ReadOnly    bool            `yaml:"read_only,omitempty"`
+	CapDrop     []string        `yaml:"cap_drop,omitempty"`
+	CapAdd      []string        `yaml:"cap_add,omitempty"`
+	User        string          `yaml:"user,omitempty"`
+	UsernsMode  string          `yaml:"userns_mode,omitempty"`
+	StdinOpen   bool            `yaml:"stdin_open,omitempty"`
+	TTY         bool            `yaml:"tty,omitempty"`
+	WorkingDir  string          `yaml:"working_dir,omitempty"`
+	Tmpfs       []string        `yaml:"tmpfs,omitempty"`
+	Volumes     []composeVolume `yaml:"volumes,omitempty"`
+	Environment []string        `yaml:"environment,omitempty"`
+	Command     []string        `yaml:"command,omitempty"`
+}
+
+type composeVolume struct {
+	Type     string `yaml:"type"`
+	Source   string `yaml:"source"`
+	Target   string `yaml:"target"`
+	ReadOnly bool   `yaml:"read_only,omitempty"`
+}
+
+func renderCompose(w io.Writer, opts runOptions, host hostContext, notes []string) error {
+	uid, gid, _ := strings.Cut(host.uidGID, ":")
+	replacements := []textReplacement{
+		{host.workDir, "."},
+		{host.homeDir, "${HOME}"},
+	}
+	if host.uidGID != "" {
+		replacements = append(replacements,
+			textReplacement{"uid=" + uid + ",gid=" + gid, "uid=${DOCKERX_UID:-" + uid + "},gid=${DOCKERX_GID:-" + gid + "}"},
+		)
+	}
+	value := func(s string) string {
+		return replaceHostValues(s, replacements, escapeComposeValue)
+	}
+
+	svc := composeService{
+		Image:      escapeComposeValue(opts.image),
+		ReadOnly:   opts.readOnly,
+		CapDrop:    opts.capDrop,
+		CapAdd:     opts.capAdd,
+		StdinOpen:  opts.interactive,
+		TTY:        true,
+		WorkingDir: opts.workdir,
+	}
+	if opts.pull == "never" {
+		svc.PullPolicy = "missing"
+	}
+	switch {
+	case opts.user != "" && host.uidGID != "":
+		svc.User = "${DOCKERX_UID:-" + uid + "}:${DOCKERX_GID:-" + gid + "}"
+	case opts.user != "":
+		svc.User = opts.user
+	}
+	svc.UsernsMode = opts.userns
+	for _, t := range opts.tmpfs {
+		svc.Tmpfs = append(svc.Tmpfs, value(t))
+	}
+	for _, raw := range opts.mounts {
+		m, err := parseBindMount(raw)
+		if err != nil {
+			return err
+		}
+		source := value(m.source)
+		svc.Volumes = append(svc.Volumes, composeVolume{Type: "bind", Source: source, Target: m.target, ReadOnly: m.readOnly})
+	}
+	for _, e := range opts.env {
+		svc.Environment = append(svc.Environment, value(e))
+	}
+	for _, c := range opts.command {
+		svc.Command = append(svc.Command, escapeComposeValue(c))
+	}
+
+	fmt.Fprintln(w, "# Generated by dockerx export. Run from the project directory:")
+	fmt.Fprintln(w, "#   docker compose run --rm dockerx")
+	writeNotes(w, "#", notes)
+	if host.uidGID != "" {
+		fmt.Fprintln(w, "# Set DOCKERX_UID and DOCKERX_GID to run as another host user.")
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(composeFile{Services: map[string]composeService{"dockerx": svc}}); err != nil {
+		return fmt.Errorf("encode compose file: %w", err)
+	}
+	return enc.Close()
+}
+
+// renderScript keeps the docker run args in their original order, replacing
+// only the host-specific values with expressions evaluated when it runs.
+func renderScript(w io.Writer, args []string, host hostContext, notes []string) error {
+	uid, gid, _ := strings.Cut(host.uidGID, ":")
+	replacements := []textReplacement{
+		{host.workDir, `"$PWD"`},
+		{host.homeDir, `"$HOME"`},
+	}
+	if host.uidGID != "" {
+		replacements = append(replacements, textReplacement{"uid=" + uid + ",gid=" + gid, `uid="$(id -u)",gid="$(id -g)"`})
+	}
+
+	var lines []string
+	i := 1
+	for ; i < len(args) && strings.HasPrefix(args[i], "-"); i++ {
+		arg := args[i]
+		switch arg {
+		case "-t":
+			lines = append(lines, "$tty_flag")
+			continue
+		case "-i", "--rm", "--read-only":
+			lines = append(lines, arg)
+			continue
+		}
+		i++
+		value := args[i]
+		switch arg {
+		case "--pull":
+			// There is no separate pull phase, so let docker fetch a missing image.
+			value = "missing"
+		case "--user":
+			if host.uidGID != "" {
+				lines = append(lines, arg+` "$(id -u):$(id -g)"`)
+				continue
+			}
+		}
+		lines = append(lines, arg+" "+replaceHostValues(value, replacements, shellQuote))
+	}
+	if !slices.Contains(args[:i], "-t") {
+		lines = append(lines, "$tty_flag")
+	}
+	lines = append(lines, shellJoin(args[i:]))
+
+	fmt.Fprintln(w, "#!/bin/sh")
+	fmt.Fprintln(w, "# Generated by dockerx export. Run from the project directory.")
+	writeNotes(w, "#", notes)
+	fmt.Fprintln(w, "set -eu")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "tty_flag=")
+	fmt.Fprintln(w, "if [ -t 0 ] && [ -t 1 ]; then")
+	fmt.Fprintln(w, "  tty_flag=-t")
+	fmt.Fprintln(w, "fi")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "# shellcheck disable=SC2086")
+	fmt.Fprintln(w, "exec docker run \\")
+	for n, line := range lines {
+		if n == len(lines)-1 {
+			fmt.Fprintf(w, "  %s\n", line)
+		} else {
+			fmt.Fprintf(w, "  %s \\\n", line)
+		}
+	}
+	return nil
+}
+
+func renderDevcontainer(w io.Writer, opts runOptions, host hostContext, notes []string) error {
+	replacements := []textReplacement{
+		{host.workDir, "${localWorkspaceFolder}"},
+		{host.homeDir, "${localEnv:HOME}"},
+	}
+	value := func(s string) string {
+		return replaceHostValues(s, replacements, func(s string) string { return s })
+	}
+
+	runArgs := []string{}
+	if opts.readOnly {
+		runArgs = append(runArgs, "--read-only")
+	}
+	for _, c := range opts.capDrop {
+		runArgs = append(runArgs, "--cap-drop", c)
+	}
+	for _, c := range opts.capAdd {
+		runArgs = append(runArgs, "--cap-add", c)
+	}
+	for _, t := range opts.tmpfs {
+		runArgs = append(runArgs, "--tmpfs", value(t))
+	}
+	if opts.user != "" {
+		runArgs = append(runArgs, "--user", opts.user)
+	}
+	if opts.userns != "" {
+		runArgs = append(runArgs, "--userns", opts.userns)
+	}
+
+	containerEnv := map[string]string{}
+	remoteEnv := map[string]string{}
+	for _, e := range opts.env {
+		key, val, ok := strings.Cut(e, "=")
+		if !ok {
+			// Passthrough keys are read from the host when the container starts.
+			remoteEnv[key] = "${localEnv:" + key + "}"
+			continue
+		}
+		containerEnv[key] = value(val)
+	}
+
+	var workspaceMount string
+	var mounts []string
+	for _, raw := range opts.mounts {
+		m, err := parseBindMount(raw)
+		if err != nil {
+			return err
+		}
+		spec := "source=" + value(m.source) + ",target=" + m.target + ",type=bind"
+		if m.readOnly {
+			spec += ",readonly"
+		}
+		if m.target == opts.workdir && m.source == host.workDir {
+			workspaceMount = spec
+			continue
+		}
+		mounts = append(mounts, spec)
+	}
+
+	doc := devcontainerFile{
+		Name:            "dockerx",
+		Image:           opts.image,
+		WorkspaceFolder: opts.workdir,
+		WorkspaceMount:  workspaceMount,
+		Mounts:          mounts,
+		RunArgs:         runArgs,
+		ContainerEnv:    sortedMap(containerEnv),
+		RemoteEnv:       sortedMap(remoteEnv),
+	}
+	content, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode devcontainer: %w", err)
+	}
+	fmt.Fprintln(w, "// Generated by dockerx export. Save as .devcontainer/devcontainer.json.")
+	writeNotes(w, "//", notes)
+	_, err = w.Write(append(content, '\n'))
+	return err
+}
+
+type devcontainerFile struct {
+	Name            string        `json:"name"`
+	Image           string        `json:"image"`
+	WorkspaceFolder string        `json:"workspaceFolder,omitempty"`
+	WorkspaceMount  string        `json:"workspaceMount,omitempty"`
+	Mounts          []string      `json:"mounts,omitempty"`
+	RunArgs         []string      `json:"runArgs,omitempty"`
+	ContainerEnv    orderedValues `json:"containerEnv,omitempty"`
+	RemoteEnv       orderedValues `json:"remoteEnv,omitempty"`
+}
+
+// orderedValues marshals as a JSON object with keys in slice order.
+type orderedValues [][2]string
+
+func (o orderedValues) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, kv := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(kv[0])
+		val, _ := json.Marshal(kv[1])
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(val)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func sortedMap(m map[string]string) orderedValues {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make(orderedValues, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, [2]string{k, m[k]})
+	}
+	return out
+}
+
+// escapeComposeValue escapes $ so compose does not interpolate it.
+func escapeComposeValue(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
+
+func writeNotes(w io.Writer, comment string, notes []string) {
+	if len(notes) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s\n%s Host-specific settings:\n", comment, comment)
+	for _, note := range notes {
+		fmt.Fprintf(w, "%s   - %s\n", comment, note)
+	}
+	fmt.Fprintln(w, comment)
+}
+
+// textReplacement swaps a host-specific literal for a portable expression.
+type textReplacement struct {
+	literal string
+	expr    string
+}
+
+// replaceHostValues swaps host literals in s for their expressions, passing
+// the text between them through quote.
+func replaceHostValues(s string, replacements []textReplacement, quote func(string) string) string {
+	replacements = sortReplacements(replacements)
+	var out strings.Builder
+	literal := ""
+	flush := func() {
+		if literal != "" {
+			out.WriteString(quote(literal))
+			literal = ""
+		}
+	}
+	for len(s) > 0 {
+		matched := false
+		for _, r := range replacements {
+			if strings.HasPrefix(s, r.literal) && pathBoundary(s[len(r.literal):]) {
+				flush()
+				out.WriteString(r.expr)
+				s = s[len(r.literal):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			literal += s[:1]
+			s = s[1:]
+		}
+	}
+	flush()
+	if out.Len() == 0 {
+		return quote("")
+	}
+	return out.String()
+}
+
+// pathBoundary reports whether a replaced path ends at rest, so /home/me does
+// not match the start of /home/meg.
+func pathBoundary(rest string) bool {
+	return rest == "" || strings.ContainsAny(rest[:1], "/,:=")
+}
+
+// sortReplacements drops empty literals and puts longer ones first, so the
+// workdir wins over the home directory that contains it.
+func sortReplacements(replacements []textReplacement) []textReplacement {
+	out := slices.DeleteFunc(slices.Clone(replacements), func(r textReplacement) bool {
+		return r.literal == "" || r.literal == "/"
+	})
+	slices.SortStableFunc(out, func(a, b textReplacement) int {
+		return len(b.literal) - len(a.literal)
+	})
+	return out
+}
+
+func pathWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func exportFixture(t *testing.T) (launchPlan, []string, hostContext) {
+	t.Helper()
+	host := hostContext{workDir: "/home/me/src/my app", homeDir: "/home/me", uidGID: "1000:1000"}
+	plan := fixturePlan(host.workDir)
+	plan.command = []string{"sh", "-c", "echo $HOME"}
+	plan.configMounts = append(plan.configMounts, mountSpec{src: "/opt/shared/gitconfig", dst: containerHome + "/.gitconfig", readOnly: true})
+	return plan, goldenArgs(t, plan, true), host
+}
+
+func TestRenderExportGolden(t *testing.T) {
+	plan, args, host := exportFixture(t)
+	for _, tt := range []struct {
+		format string
+		file   string
+	}{
+		{exportCompose, "export-compose.yaml"},
+		{exportScript, "export-script.sh"},
+		{exportDevcontainer, "export-devcontainer.json"},
+	} {
+		var out bytes.Buffer
+		notes, err := renderExport(&out, tt.format, plan, args, host)
+		if err != nil {
+			t.Fatalf("render %s: %v", tt.format, err)
+		}
+		if len(notes) == 0 {
+			t.Fatalf("expected host-specific notes for %s", tt.format)
+		}
+		assertGolden(t, filepath.Join("testdata", tt.file), out.Bytes())
+	}
+}
+
+func TestRenderExportFlagsHostSpecificSettings(t *testing.T) {
+	plan, args, host := exportFixture(t)
+
+	notes, err := renderExport(&bytes.Buffer{}, exportCompose, plan, args, host)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	joined := strings.Join(notes, "\n")
+	for _, want := range []string{"Identity overlays", "1000:1000", "/opt/shared/gitconfig"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("expected note mentioning %q in %v", want, notes)
+		}
+	}
+
+	notes, err = renderExport(&bytes.Buffer{}, exportScript, plan, args, host)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if strings.Contains(strings.Join(notes, "\n"), "1000:1000") {
+		t.Fatalf("did not expect a user note for scripts: %v", notes)
+	}
+}
+
+func TestExportedScriptParsesToSameArgs(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	plan, args, host := exportFixture(t)
+	var out bytes.Buffer
+	if _, err := renderExport(&out, exportScript, plan, args, host); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+
+	// Swap docker for printf and pin the host values the script expands.
+	script := strings.Replace(out.String(), "exec docker run", "printf '%s\\n' run", 1)
+	cmd := exec.Command(sh, "-c", "PWD='/home/me/src/my app'; HOME=/home/me; id() { echo 1000; }; "+script)
+	cmd.Stdin = strings.NewReader("")
+	got, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("run script: %v\n%s", err, script)
+	}
+
+	want := slices.Clone(args)
+	want = slices.DeleteFunc(want, func(a string) bool { return a == "-t" })
+	want[slices.Index(want, "never")] = "missing"
+	gotArgs := splitLines(string(got))
+	if !slices.Equal(gotArgs, want) {
+		t.Fatalf("script args differ:\n got: %q\nwant: %q", gotArgs, want)
+	}
+}
+
+func TestParseRunArgsAcceptsBuildDockerArgs(t *testing.T) {
+	plan, _, _ := exportFixture(t)
+	args, err := buildDockerArgs(plan)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	opts, err := parseRunArgs(args)
+	if err != nil {
+		t.Fatalf("parse args from buildDockerArgs: %v", err)
+	}
+	if opts.image != plan.image || !slices.Equal(opts.command, plan.command) || !opts.readOnly {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+}
+
+func TestParseRunArgsRejectsUnknownFlags(t *testing.T) {
+	if _, err := parseRunArgs([]string{"run", "--privileged", "img"}); err == nil {
+		t.Fatal("expected unknown flag to be rejected")
+	}
+	if _, err := parseRunArgs([]string{"run", "--rm"}); err == nil {
+		t.Fatal("expected missing image to be rejected")
+	}
+}
+
+func TestReplaceHostValues(t *testing.T) {
+	replacements := []textReplacement{
+		{"/home/me", `"$HOME"`},
+		{"/home/me/src/app", `"$PWD"`},
+	}
+	for input, want := range map[string]string{
+		"type=bind,src=/home/me/src/app,dst=/app": `type=bind,src="$PWD",dst=/app`,
+		"/home/me/.codex":                         `"$HOME"/.codex`,
+		"/home/meg/.codex":                        "/home/meg/.codex",
+		"/home/me dir":                            "'/home/me dir'",
+		"":                                        "''",
+	} {
+		if got := replaceHostValues(input, replacements, shellQuote); got != want {
+			t.Fatalf("replaceHostValues(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
+
+func TestExportDockerxRunsLaunchChecks(t *testing.T) {
+	home := t.TempDir()
+	project := filepath.Join(home, "src", "app")
+	mustMkdirAll(t, project)
+	mustMkdirAll(t, filepath.Join(home, ".ssh"))
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	output := filepath.Join(t.TempDir(), "compose.yaml")
+	cfg := cliConfig{image: "wpkpda/dockerx:latest", shell: "zsh"}
+
+	t.Chdir(home)
+	if err := exportDockerx(cfg, exportCompose, output); err == nil || !strings.Contains(err.Error(), "home directory") {
+		t.Fatalf("export from the home directory: err = %v", err)
+	}
+
+	t.Chdir(project)
+	policy := filepath.Join(home, ".config", "dockerx", "policy.yaml")
+	mustWriteFile(t, policy, "allow:\n  - other/*\n")
+	if err := exportDockerx(cfg, exportCompose, output); err == nil || !strings.Contains(err.Error(), "wpkpda/dockerx") {
+		t.Fatalf("export of a refused image: err = %v", err)
+	}
+
+	mustWriteFile(t, policy, "onViolation: strip\nallow:\n  - other/*\n")
+	if err := exportDockerx(cfg, exportCompose, output); err != nil {
+		t.Fatalf("export of a stripped image: %v", err)
+	}
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	if strings.Contains(string(content), ".ssh") {
+		t.Fatalf("stripped export mounts host config:\n%s", content)
+	}
+}
+
+func TestRenderExportKeepsDaemonSpecificUser(t *testing.T) {
+	plan, _, host := exportFixture(t)
+	plan.identity = identityPlan{strategy: identityUsernsHost, user: "1000:1000", usernsHost: true}
+	host.uidGID = ""
+	args := goldenArgs(t, plan, true)
+
+	var out bytes.Buffer
+	notes, err := renderExport(&out, exportCompose, plan, args, host)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	for _, want := range []string{"user: 1000:1000", "userns_mode: host"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("compose file lacks %q:\n%s", want, out.String())
+		}
+	}
+	if !strings.Contains(strings.Join(notes, "\n"), string(identityUsernsHost)) {
+		t.Fatalf("expected a note on the daemon-specific user: %v", notes)
+	}
+
+	out.Reset()
+	if _, err := renderExport(&out, exportScript, plan, args, host); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if strings.Contains(out.String(), "id -u") || !strings.Contains(out.String(), "--userns host") {
+		t.Fatalf("script should keep the daemon-specific user:\n%s", out.String())
+	}
+}
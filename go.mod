@@ -2,6 +2,8 @@ module github.com/i-rocky/dockerx
 
 go 1.25.0
 
-require golang.org/x/term v0.36.0
-
-require golang.org/x/sys v0.37.0 // indirect
+require (
+	golang.org/x/sys v0.37.0
+	golang.org/x/term v0.36.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// hostPaths translates host paths into the form the docker daemon expects
+// for bind mount sources. The zero value leaves paths unchanged, which is
+// right for Linux and macOS.
+type hostPaths struct {
+	// goos is the platform dockerx runs on.
+	goos string
+	// wslDistro names the WSL distribution dockerx runs in, if any.
+	wslDistro string
+	// windowsDocker is set inside WSL when docker is Docker Desktop's
+	// docker.exe, which only understands Windows paths.
+	windowsDocker bool
+}
+
+// detectHostPaths inspects the current platform. Inside WSL the docker found
+// on PATH may be a link to docker.exe, in which case Linux paths have to be
+// rewritten to drive letters or \\wsl.localhost shares.
+func detectHostPaths(lookupEnv func(string) string) hostPaths {
+	h := hostPaths{goos: runtime.GOOS}
+	if h.goos != "linux" {
+		return h
+	}
+	h.wslDistro = lookupEnv("WSL_DISTRO_NAME")
+	if h.wslDistro == "" {
+		return h
+	}
+	docker, err := exec.LookPath("docker")
+	if err != nil {
+		return h
+	}
+	if resolved, err := filepath.EvalSymlinks(docker); err == nil {
+		docker = resolved
+	}
+	h.windowsDocker = strings.HasSuffix(strings.ToLower(docker), ".exe")
+	return h
+}
+
+// dockerPath returns path as a bind mount source for the docker daemon.
+func (h hostPaths) dockerPath(path string) string {
+	switch {
+	case h.goos == "windows":
+		return windowsDockerPath(path)
+	case h.windowsDocker:
+		if drive, rest, ok := wslDrivePath(path); ok {
+			return drive + ":/" + rest
+		}
+		return "//wsl.localhost/" + h.wslDistro + path
+	default:
+		return path
+	}
+}
+
+// key returns a form of path for detecting duplicates. Windows, macOS and
+// WSL's /mnt drives are case-insensitive by default, so two spellings of the
+// same directory must not produce two mounts.
+func (h hostPaths) key(path string) string {
+	translated := h.dockerPath(path)
+	if h.goos == "windows" || h.goos == "darwin" {
+		return strings.ToLower(translated)
+	}
+	if _, _, ok := wslDrivePath(path); ok && h.wslDistro != "" {
+		return strings.ToLower(translated)
+	}
+	return translated
+}
+
+// windowsDockerPath converts a Windows path to forward slashes with an upper
+// case drive letter. Extended-length prefixes are dropped and UNC shares keep
+// their leading double slash.
+func windowsDockerPath(path string) string {
+	p := strings.ReplaceAll(path, `\`, "/")
+	switch {
+	case strings.HasPrefix(p, "//?/UNC/"):
+		p = "//" + strings.TrimPrefix(p, "//?/UNC/")
+	case strings.HasPrefix(p, "//?/"), strings.HasPrefix(p, "//./"):
+		p = p[len("//?/"):]
+	}
+	if len(p) >= 2 && p[1] == ':' && isDriveLetter(p[0]) {
+		p = strings.ToUpper(p[:1]) + p[1:]
+		if len(p) == 2 {
+			p += "/"
+		}
+	}
+	return p
+}
+
+// wslDrivePath splits a WSL /mnt/<drive>/... path into the drive letter and
+// the remaining path.
+func wslDrivePath(path string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(path, "/mnt/")
+	if !ok || len(rest) == 0 || !isDriveLetter(rest[0]) {
+		return "", "", false
+	}
+	if len(rest) > 1 && rest[1] != '/' {
+		return "", "", false
+	}
+	return strings.ToUpper(rest[:1]), strings.TrimPrefix(rest[1:], "/"), true
+}
+
+func isDriveLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// sharesSockets reports whether a unix socket on the host can be bind mounted
+// into a container, which needs the daemon to run on the same kernel.
+func (h hostPaths) sharesSockets() bool {
+	return h.goos == "linux" && !h.windowsDocker
+}
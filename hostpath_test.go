@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDockerPath(t *testing.T) {
+	windows := hostPaths{goos: "windows"}
+	wslDesktop := hostPaths{goos: "linux", wslDistro: "Ubuntu", windowsDocker: true}
+	wslNative := hostPaths{goos: "linux", wslDistro: "Ubuntu"}
+	for _, tt := range []struct {
+		name  string
+		paths hostPaths
+		in    string
+		want  string
+	}{
+		{"linux unchanged", hostPaths{goos: "linux"}, "/home/me/repo", "/home/me/repo"},
+		{"zero value unchanged", hostPaths{}, `C:\Users\me`, `C:\Users\me`},
+		{"darwin unchanged", hostPaths{goos: "darwin"}, "/Users/Me/repo", "/Users/Me/repo"},
+		{"drive letter", windows, `C:\Users\me\repo`, "C:/Users/me/repo"},
+		{"lower case drive", windows, `c:\Users\me`, "C:/Users/me"},
+		{"drive root", windows, `D:`, "D:/"},
+		{"drive root slash", windows, `D:\`, "D:/"},
+		{"forward slashes", windows, "C:/Users/me", "C:/Users/me"},
+		{"spaces kept", windows, `C:\Users\me\My Projects`, "C:/Users/me/My Projects"},
+		{"unc share", windows, `\\server\share\repo`, "//server/share/repo"},
+		{"wsl share", windows, `\\wsl.localhost\Ubuntu\home\me`, "//wsl.localhost/Ubuntu/home/me"},
+		{"extended length", windows, `\\?\C:\very\long\path`, "C:/very/long/path"},
+		{"extended unc", windows, `\\?\UNC\server\share\repo`, "//server/share/repo"},
+		{"device namespace", windows, `\\.\c:\repo`, "C:/repo"},
+		{"wsl mnt drive", wslDesktop, "/mnt/c/Users/me/repo", "C:/Users/me/repo"},
+		{"wsl mnt drive root", wslDesktop, "/mnt/d", "D:/"},
+		{"wsl mnt not a drive", wslDesktop, "/mnt/data/repo", "//wsl.localhost/Ubuntu/mnt/data/repo"},
+		{"wsl linux path", wslDesktop, "/home/me/repo", "//wsl.localhost/Ubuntu/home/me/repo"},
+		{"wsl native docker", wslNative, "/mnt/c/Users/me", "/mnt/c/Users/me"},
+	} {
+		if got := tt.paths.dockerPath(tt.in); got != tt.want {
+			t.Errorf("%s: dockerPath(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHostPathsKey(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		paths hostPaths
+		a, b  string
+		same  bool
+	}{
+		{"windows case", hostPaths{goos: "windows"}, `C:\Users\Me\.codex`, `c:\users\me\.codex`, true},
+		{"windows slashes", hostPaths{goos: "windows"}, `C:\Users\me\.ssh`, "C:/Users/me/.ssh", true},
+		{"darwin case", hostPaths{goos: "darwin"}, "/Users/Me/.ssh", "/Users/me/.ssh", true},
+		{"linux case", hostPaths{goos: "linux"}, "/home/Me/.ssh", "/home/me/.ssh", false},
+		{"wsl drive case", hostPaths{goos: "linux", wslDistro: "Ubuntu"}, "/mnt/c/Users/Me", "/mnt/c/users/me", true},
+		{"wsl linux case", hostPaths{goos: "linux", wslDistro: "Ubuntu"}, "/home/Me", "/home/me", false},
+	} {
+		if got := tt.paths.key(tt.a) == tt.paths.key(tt.b); got != tt.same {
+			t.Errorf("%s: key(%q) == key(%q) is %v, want %v", tt.name, tt.a, tt.b, got, tt.same)
+		}
+	}
+}
+
+func TestDiscoverHostConfigMountsDedupsCaseInsensitively(t *testing.T) {
+	// HF_HOME and XDG_CONFIG_HOME/huggingface spell the same directory with
+	// different case.
+	env := map[string]string{
+		"XDG_CONFIG_HOME": "/Users/Me/.config",
+		"HF_HOME":         "/users/me/.config/huggingface",
+	}
+	exists := func(path string) bool {
+		return path == "/Users/Me/.config/huggingface" || path == "/users/me/.config/huggingface"
+	}
+	lookup := func(key string) string { return env[key] }
+
+	mounts := discoverHostConfigMounts(allToolSpecs(t), "/Users/Me", lookup, exists, hostPaths{goos: "darwin"})
+	if len(mounts) != 1 {
+		t.Fatalf("expected one mount on a case-insensitive host, got %+v", mounts)
+	}
+	assertMount(t, mounts, "/Users/Me/.config/huggingface", containerHome+"/.config/huggingface", true)
+
+	mounts = discoverHostConfigMounts(allToolSpecs(t), "/Users/Me", lookup, exists, hostPaths{goos: "linux"})
+	if len(mounts) != 2 {
+		t.Fatalf("expected both mounts on a case-sensitive host, got %+v", mounts)
+	}
+}
+
+func TestBuildDockerArgsTranslatesMountSources(t *testing.T) {
+	plan := launchPlan{
+		image:          "repo/image:latest",
+		workDir:        `C:\Users\me\repo`,
+		command:        []string{"zsh"},
+		configMounts:   []mountSpec{{src: `C:\Users\me\.codex`, dst: containerHome + "/.codex", readOnly: true}},
+		identityMounts: []mountSpec{{src: `C:\Users\me\AppData\Local\Temp\dockerx\passwd`, dst: "/etc/passwd", readOnly: true}},
+		paths:          hostPaths{goos: "windows"},
+	}
+	args, err := buildDockerArgs(plan)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	for _, want := range []string{
+		"type=bind,src=C:/Users/me/repo,dst=/app",
+		"type=bind,src=C:/Users/me/AppData/Local/Temp/dockerx/passwd,dst=/etc/passwd,readonly",
+		"type=bind,src=C:/Users/me/.codex,dst=" + configStageRoot + "/0,readonly",
+	} {
+		if !containsPair(args, "--mount", want) {
+			t.Fatalf("missing --mount %s in %v", want, args)
+		}
+	}
+	if plan.mounts()[0].src != plan.workDir {
+		t.Fatal("host mounts should keep the host path")
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+type identityStrategy string
+
+const (
+	// identityHostUser runs as the host UID:GID, which the daemon passes
+	// through unchanged.
+	identityHostUser identityStrategy = "host-user"
+	// identityUsernsHost opts out of userns-remap for the container so the
+	// host UID:GID still means the host user. It needs --userns-host.
+	identityUsernsHost identityStrategy = "userns-host"
+	// identityUsernsRemapped keeps userns-remap and runs as the container
+	// UID:GID that the remap maps to the host user, when there is one.
+	identityUsernsRemapped identityStrategy = "userns-remapped"
+	// identityRootMapped runs as container root, which a rootless daemon
+	// maps to the host user.
+	identityRootMapped identityStrategy = "root-mapped"
+	// identityImageDefault keeps the image's user when the host has no
+	// numeric UID:GID, as on Windows.
+	identityImageDefault identityStrategy = "image-default"
+)
+
+// daemonSecurity is the part of `docker info` that decides how container
+// UIDs relate to host UIDs.
+type daemonSecurity struct {
+	rootless bool
+	userns   bool
+	// uidMap and gidMap are the subordinate ranges of the remap user, in
+	// order, when they could be read.
+	uidMap []idRange
+	gidMap []idRange
+}
+
+// idRange is a /etc/subuid or /etc/subgid entry: count host IDs starting at
+// start.
+type idRange struct {
+	start, count int
+}
+
+// identityPlan is how the container user is chosen, with the reasons shown
+// by --verbose.
+type identityPlan struct {
+	strategy   identityStrategy
+	user       string
+	usernsHost bool
+	reasons    []string
+	// warning is printed before launch.
+	warning string
+}
+
+func inspectDaemonSecurity() (daemonSecurity, error) {
+	out, err := exec.Command("docker", "info", "--format", "{{json .SecurityOptions}}").Output()
+	if err != nil {
+		return daemonSecurity{}, fmt.Errorf("docker info: %w", err)
+	}
+	var options []string
+	if err := json.Unmarshal(out, &options); err != nil {
+		return daemonSecurity{}, fmt.Errorf("parse docker info security options: %w", err)
+	}
+	sec := parseSecurityOptions(options)
+	if sec.userns {
+		sec.uidMap, sec.gidMap = readRemapRanges(os.ReadFile)
+	}
+	return sec, nil
+}
+
+// readRemapRanges looks up the subordinate ranges of the daemon's remap
+// user, as configured in /etc/docker/daemon.json. It returns nothing when
+// any part is unreadable, as with a remote daemon.
+func readRemapRanges(readFile func(string) ([]byte, error)) ([]idRange, []idRange) {
+	content, err := readFile("/etc/docker/daemon.json")
+	if err != nil {
+		return nil, nil
+	}
+	var daemon struct {
+		UsernsRemap string `json:"userns-remap"`
+	}
+	if json.Unmarshal(content, &daemon) != nil || daemon.UsernsRemap == "" {
+		return nil, nil
+	}
+	user, group, ok := strings.Cut(daemon.UsernsRemap, ":")
+	if user == "default" {
+		user, group, ok = "dockremap", "dockremap", true
+	}
+	if !ok {
+		group = user
+	}
+	subuid, err := readFile("/etc/subuid")
+	if err != nil {
+		return nil, nil
+	}
+	subgid, err := readFile("/etc/subgid")
+	if err != nil {
+		return nil, nil
+	}
+	return parseSubordinateRanges(string(subuid), user), parseSubordinateRanges(string(subgid), group)
+}
+
+// parseSubordinateRanges returns the ranges of name in a subuid or subgid
+// file, which the daemon maps to container IDs 0, 1, ... in file order.
+func parseSubordinateRanges(content, name string) []idRange {
+	var ranges []idRange
+	for _, line := range splitLines(content) {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != 3 || fields[0] != name {
+			continue
+		}
+		start, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil || count <= 0 {
+			continue
+		}
+		ranges = append(ranges, idRange{start: start, count: count})
+	}
+	return ranges
+}
+
+// containerID returns the container ID that ranges map to hostID.
+func containerID(ranges []idRange, hostID int) (int, bool) {
+	offset := 0
+	for _, r := range ranges {
+		if hostID >= r.start && hostID < r.start+r.count {
+			return offset + hostID - r.start, true
+		}
+		offset += r.count
+	}
+	return 0, false
+}
+
+// remappedUIDGID translates a host UID:GID through the remap ranges.
+func remappedUIDGID(sec daemonSecurity, uidGID string) (string, bool) {
+	uidText, gidText, ok := strings.Cut(uidGID, ":")
+	if !ok {
+		return "", false
+	}
+	uid, err1 := strconv.Atoi(uidText)
+	gid, err2 := strconv.Atoi(gidText)
+	if err1 != nil || err2 != nil {
+		return "", false
+	}
+	cuid, ok1 := containerID(sec.uidMap, uid)
+	cgid, ok2 := containerID(sec.gidMap, gid)
+	if !ok1 || !ok2 {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d", cuid, cgid), true
+}
+
+// parseSecurityOptions reads entries such as "name=rootless" and
+// "name=seccomp,profile=builtin".
+func parseSecurityOptions(options []string) daemonSecurity {
+	var sec daemonSecurity
+	for _, option := range options {
+		for _, field := range strings.Split(option, ",") {
+			switch strings.TrimSpace(field) {
+			case "name=rootless":
+				sec.rootless = true
+			case "name=userns":
+				sec.userns = true
+			}
+		}
+	}
+	return sec
+}
+
+// chooseIdentity picks the container user so files written to /app are
+// owned by the host user. Under userns-remap the container leaves the remap
+// only when allowUsernsHost is set.
+func chooseIdentity(sec daemonSecurity, uidGID string, hasUIDGID, allowUsernsHost bool) identityPlan {
+	switch {
+	case sec.rootless:
+		return identityPlan{
+			strategy: identityRootMapped,
+			user:     "0:0",
+			reasons: []string{
+				"the Docker daemon is rootless, so container root is mapped to your host user",
+				"--user " + uidGIDOrHost(uidGID, hasUIDGID) + " would map to a subordinate UID and leave files in /app owned by an unknown user",
+				"running as container root with root's home in /etc/passwd set to " + containerHome,
+			},
+		}
+	case !hasUIDGID:
+		return identityPlan{
+			strategy: identityImageDefault,
+			reasons:  []string{"no numeric host UID:GID is available, so the image's default user is kept"},
+		}
+	case sec.userns && allowUsernsHost:
+		return identityPlan{
+			strategy:   identityUsernsHost,
+			user:       uidGID,
+			usernsHost: true,
+			reasons: []string{
+				"the Docker daemon uses userns-remap, which shifts container UIDs into a subordinate range",
+				"--userns-host was given, so --userns=host keeps --user " + uidGID + " equal to your host user",
+			},
+			warning: "--userns-host runs the container outside the daemon's user namespace remap, so container root is host root",
+		}
+	case sec.userns:
+		reasons := []string{"the Docker daemon uses userns-remap, which shifts container UIDs into a subordinate range"}
+		if user, ok := remappedUIDGID(sec, uidGID); ok {
+			return identityPlan{
+				strategy: identityUsernsRemapped,
+				user:     user,
+				reasons:  append(reasons, "--user "+user+" is remapped to your host user "+uidGID+", so files in /app stay yours"),
+			}
+		}
+		return identityPlan{
+			strategy: identityUsernsRemapped,
+			user:     uidGID,
+			reasons:  append(reasons, "your host user "+uidGID+" is outside the remap's subordinate range, so --user "+uidGID+" is kept"),
+			warning:  "userns-remap does not map your host user into the container; files in /app will be owned by a subordinate UID. Add your UID:GID to the remap user's /etc/subuid and /etc/subgid ranges, or pass --userns-host to leave the remap",
+		}
+	default:
+		return identityPlan{
+			strategy: identityHostUser,
+			user:     uidGID,
+			reasons:  []string{"--user " + uidGID + " matches your host user, so files in /app stay yours"},
+		}
+	}
+}
+
+func uidGIDOrHost(uidGID string, ok bool) string {
+	if ok {
+		return uidGID
+	}
+	return "<host uid:gid>"
+}
+
+// setRootHome points root's passwd entry at home. Under a rootless daemon
+// the session runs as container root, and tools such as ssh look up the home
+// directory in /etc/passwd rather than $HOME.
+func setRootHome(passwdBase, home string) string {
+	lines := splitLines(passwdBase)
+	for i, line := range lines {
+		fields := strings.Split(line, ":")
+		if len(fields) < 7 || fields[2] != "0" {
+			continue
+		}
+		fields[5] = home
+		lines[i] = strings.Join(fields, ":")
+		break
+	}
+	return joinLines(lines)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSecurityOptions(t *testing.T) {
+	for _, tt := range []struct {
+		options []string
+		want    daemonSecurity
+	}{
+		{[]string{"name=seccomp,profile=builtin", "name=cgroupns"}, daemonSecurity{}},
+		{[]string{"name=seccomp,profile=builtin", "name=rootless", "name=cgroupns"}, daemonSecurity{rootless: true}},
+		{[]string{"name=apparmor", "name=userns"}, daemonSecurity{userns: true}},
+		{nil, daemonSecurity{}},
+	} {
+		if got := parseSecurityOptions(tt.options); got.rootless != tt.want.rootless || got.userns != tt.want.userns {
+			t.Fatalf("parseSecurityOptions(%q) = %+v, want %+v", tt.options, got, tt.want)
+		}
+	}
+}
+
+func TestChooseIdentity(t *testing.T) {
+	mapped := daemonSecurity{
+		userns: true,
+		uidMap: []idRange{{start: 100000, count: 65536}, {start: 1000, count: 1}},
+		gidMap: []idRange{{start: 1000, count: 1}},
+	}
+	for _, tt := range []struct {
+		name       string
+		sec        daemonSecurity
+		hasUIDGID  bool
+		allowHost  bool
+		strategy   identityStrategy
+		user       string
+		usernsHost bool
+		warns      bool
+	}{
+		{"rootful", daemonSecurity{}, true, false, identityHostUser, "1000:1000", false, false},
+		{"rootless", daemonSecurity{rootless: true}, true, false, identityRootMapped, "0:0", false, false},
+		{"rootless wins over userns", daemonSecurity{rootless: true, userns: true}, true, true, identityRootMapped, "0:0", false, false},
+		{"userns-remap without a mapping", daemonSecurity{userns: true}, true, false, identityUsernsRemapped, "1000:1000", false, true},
+		{"userns-remap with a mapping", mapped, true, false, identityUsernsRemapped, "65536:0", false, false},
+		{"userns-remap opted out", daemonSecurity{userns: true}, true, true, identityUsernsHost, "1000:1000", true, true},
+		{"no host uid", daemonSecurity{}, false, false, identityImageDefault, "", false, false},
+	} {
+		uidGID := ""
+		if tt.hasUIDGID {
+			uidGID = "1000:1000"
+		}
+		got := chooseIdentity(tt.sec, uidGID, tt.hasUIDGID, tt.allowHost)
+		if got.strategy != tt.strategy || got.user != tt.user || got.usernsHost != tt.usernsHost || (got.warning != "") != tt.warns {
+			t.Fatalf("%s: chooseIdentity = %+v", tt.name, got)
+		}
+		if len(got.reasons) == 0 {
+			t.Fatalf("%s: expected an explanation", tt.name)
+		}
+	}
+}
+
+func TestReadRemapRanges(t *testing.T) {
+	files := map[string]string{
+		"/etc/docker/daemon.json": `{"userns-remap": "default"}`,
+		"/etc/subuid":             "me:200000:65536\ndockremap:100000:65536\ndockremap:1000:1\n",
+		"/etc/subgid":             "dockremap:100000:65536\n",
+	}
+	readFile := func(path string) ([]byte, error) {
+		content, ok := files[path]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(content), nil
+	}
+	uids, gids := readRemapRanges(readFile)
+	if !slices.Equal(uids, []idRange{{100000, 65536}, {1000, 1}}) || !slices.Equal(gids, []idRange{{100000, 65536}}) {
+		t.Fatalf("readRemapRanges = %v, %v", uids, gids)
+	}
+
+	files["/etc/docker/daemon.json"] = `{"userns-remap": "me"}`
+	if uids, _ := readRemapRanges(readFile); !slices.Equal(uids, []idRange{{200000, 65536}}) {
+		t.Fatalf("ranges of a named remap user = %v", uids)
+	}
+	delete(files, "/etc/docker/daemon.json")
+	if uids, gids := readRemapRanges(readFile); uids != nil || gids != nil {
+		t.Fatalf("expected no ranges without daemon.json, got %v, %v", uids, gids)
+	}
+}
+
+func TestSetRootHome(t *testing.T) {
+	passwd := "root:x:0:0:root:/root:/bin/bash\ndaemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin\n"
+	got := setRootHome(passwd, containerHome)
+	want := "root:x:0:0:root:" + containerHome + ":/bin/bash\ndaemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin\n"
+	if got != want {
+		t.Fatalf("setRootHome:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestBuildDockerArgsFollowsIdentityPlan(t *testing.T) {
+	base := launchPlan{image: "repo/image:latest", workDir: "/tmp/work", command: []string{"zsh"}}
+
+	rootless := base
+	rootless.identity = chooseIdentity(daemonSecurity{rootless: true}, "1000:1000", true, false)
+	args, err := buildDockerArgs(rootless)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if !containsPair(args, "--user", "0:0") || !containsPair(args, "--tmpfs", containerHome+":mode=755,uid=0,gid=0") {
+		t.Fatalf("expected container root under a rootless daemon: %v", args)
+	}
+
+	remapped := base
+	remapped.identity = chooseIdentity(daemonSecurity{userns: true}, "1000:1000", true, false)
+	args, err = buildDockerArgs(remapped)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if slices.Contains(args, "--userns") {
+		t.Fatalf("did not expect --userns without --userns-host: %v", args)
+	}
+
+	remapped.identity = chooseIdentity(daemonSecurity{userns: true}, "1000:1000", true, true)
+	args, err = buildDockerArgs(remapped)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if !containsPair(args, "--userns", "host") || !containsPair(args, "--user", "1000:1000") {
+		t.Fatalf("expected --userns=host with the host user: %v", args)
+	}
+
+	imageDefault := base
+	imageDefault.identity = chooseIdentity(daemonSecurity{}, "", false, false)
+	args, err = buildDockerArgs(imageDefault)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if slices.Contains(args, "--user") {
+		t.Fatalf("did not expect --user without a host UID:GID: %v", args)
+	}
+}
+
+func TestWritePlanExplainsIdentity(t *testing.T) {
+	plan := launchPlan{
+		image:    "repo/image:latest",
+		workDir:  "/tmp/work",
+		command:  []string{"zsh"},
+		identity: chooseIdentity(daemonSecurity{rootless: true}, "1000:1000", true, false),
+	}
+	var out bytes.Buffer
+	if err := writePlan(&out, planFormatText, plan, nil); err != nil {
+		t.Fatalf("write plan: %v", err)
+	}
+	if !strings.Contains(out.String(), "Identity: root-mapped\n  - the Docker daemon is rootless") {
+		t.Fatalf("missing identity explanation:\n%s", out.String())
+	}
+}
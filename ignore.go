@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const ignoreFileName = ".dockerxignore"
+
+// maskSpec is a workspace path hidden from the container. Files get an empty
+// read-only bind, directories an empty read-only tmpfs.
+type maskSpec struct {
+	// rel is the slash-separated path relative to the workspace.
+	rel string
+	dir bool
+}
+
+// ignoreRule is one compiled .dockerxignore pattern.
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// parseIgnore reads gitignore syntax: # comments, ! negation, a trailing /
+// for directories only, a leading or inner / to anchor at the workspace,
+// and *, ?, [...] and ** globs.
+func parseIgnore(content string) ([]ignoreRule, error) {
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := trimIgnoreSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate, line = true, line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+
+		expr := globToRegexp(line)
+		if anchored {
+			expr = "^" + expr + "$"
+		} else {
+			expr = "^(?:.*/)?" + expr + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid pattern %q", n, scanner.Text())
+		}
+		rule.re = re
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// trimIgnoreSpace drops trailing spaces unless the last one is escaped.
+func trimIgnoreSpace(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**") && i+2 == len(glob) && (i == 0 || glob[i-1] == '/'):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// ignored applies the rules in order; the last match wins.
+func ignored(rules []ignoreRule, rel string, dir bool) bool {
+	matched := false
+	for _, r := range rules {
+		if r.dirOnly && !dir {
+			continue
+		}
+		if r.re.MatchString(rel) {
+			matched = !r.negate
+		}
+	}
+	return matched
+}
+
+// findMasks walks workDir for paths matched by its .dockerxignore. A matched
+// directory is masked as a whole and not walked further, which is both what
+// gitignore does (nothing below an ignored directory can be re-included) and
+// what keeps large ignored trees cheap. .git is not walked either. A bind over
+// a symlink would land on its target, so a matched symlink masks the target
+// inside the workspace instead, and one that leaves the workspace is refused.
+func findMasks(workDir string) ([]maskSpec, error) {
+	content, err := os.ReadFile(filepath.Join(workDir, ignoreFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", ignoreFileName, err)
+	}
+	rules, err := parseIgnore(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ignoreFileName, err)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	var masks []maskSpec
+	root := resolveExisting(workDir)
+	err = filepath.WalkDir(workDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() && path != workDir {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if path == workDir {
+			return nil
+		}
+		rel, err := filepath.Rel(workDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.Type()&fs.ModeSymlink != 0 {
+			if !ignored(rules, rel, false) && !ignored(rules, rel, true) {
+				return nil
+			}
+			target, err := filepath.EvalSymlinks(path)
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%s: resolve %s: %w", ignoreFileName, rel, err)
+			}
+			targetRel, err := filepath.Rel(root, target)
+			if err != nil || !pathWithin(target, root) || target == root {
+				return fmt.Errorf("%s: %s is a symlink to %s, outside the workspace, and cannot be masked", ignoreFileName, rel, target)
+			}
+			info, err := os.Stat(target)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(targetRel)
+			if strings.ContainsAny(rel, ",:") {
+				return fmt.Errorf("%s: cannot mask %q, which contains a comma or colon", ignoreFileName, rel)
+			}
+			masks = append(masks, maskSpec{rel: rel, dir: info.IsDir()})
+			return nil
+		}
+		if ignored(rules, rel, d.IsDir()) {
+			if strings.ContainsAny(rel, ",:") {
+				return fmt.Errorf("%s: cannot mask %q, which contains a comma or colon", ignoreFileName, rel)
+			}
+			masks = append(masks, maskSpec{rel: rel, dir: d.IsDir()})
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Symlink targets may repeat a mask or fall under a masked directory.
+	var out []maskSpec
+	for _, m := range masks {
+		if slices.Contains(out, m) || slices.ContainsFunc(masks, func(o maskSpec) bool {
+			return o.dir && strings.HasPrefix(m.rel, o.rel+"/")
+		}) {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// maskFilePath is the empty file bound over masked files. It lives in the
+// cache dir so warm containers can keep using it.
+func maskFilePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve cache dir: %w", err)
+	}
+	return filepath.Join(dir, "dockerx", "masked-empty"), nil
+}
+
+func ensureMaskFile(path string) error {
+	if info, err := os.Stat(path); err == nil && info.Size() == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create mask file: %w", err)
+	}
+	if err := os.WriteFile(path, nil, 0o444); err != nil {
+		return fmt.Errorf("create mask file: %w", err)
+	}
+	return nil
+}
+
+// maskedPaths lists the masks for plans, with a trailing / on directories.
+func maskedPaths(masks []maskSpec) []string {
+	var paths []string
+	for _, m := range masks {
+		p := "/app/" + m.rel
+		if m.dir {
+			p += "/"
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIgnoredFollowsGitignoreSyntax(t *testing.T) {
+	rules, err := parseIgnore(`
+# secrets
+.env
+*.pem
+!public.pem
+/terraform.tfstate
+secrets/
+config/**/local.yaml
+\#literal
+logs/**
+`)
+	if err != nil {
+		t.Fatalf("parseIgnore: %v", err)
+	}
+
+	for _, tt := range []struct {
+		rel  string
+		dir  bool
+		want bool
+	}{
+		{".env", false, true},
+		{"services/api/.env", false, true},
+		{".envrc", false, false},
+		{"certs/server.pem", false, true},
+		{"certs/public.pem", false, false},
+		{"terraform.tfstate", false, true},
+		{"infra/terraform.tfstate", false, false},
+		{"secrets", true, true},
+		{"app/secrets", true, true},
+		{"secrets", false, false},
+		{"config/local.yaml", false, true},
+		{"config/dev/eu/local.yaml", false, true},
+		{"other/local.yaml", false, false},
+		{"#literal", false, true},
+		{"logs/today.log", false, true},
+		{"logs", true, false},
+	} {
+		if got := ignored(rules, tt.rel, tt.dir); got != tt.want {
+			t.Fatalf("ignored(%q, dir=%v) = %v, want %v", tt.rel, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestFindMasksPrunesMatchedDirectories(t *testing.T) {
+	work := t.TempDir()
+	mustWriteFile(t, filepath.Join(work, ignoreFileName), ".env\nsecrets/\n*.pem\n")
+	mustWriteFile(t, filepath.Join(work, ".env"), "TOKEN=1\n")
+	mustWriteFile(t, filepath.Join(work, "api", ".env"), "TOKEN=2\n")
+	mustWriteFile(t, filepath.Join(work, "secrets", "nested", "key.pem"), "key\n")
+	mustWriteFile(t, filepath.Join(work, "main.go"), "package main\n")
+	mustWriteFile(t, filepath.Join(work, ".git", "hooks", "x.pem"), "not walked\n")
+	if err := os.Symlink(filepath.Join(work, ".env"), filepath.Join(work, "link.pem")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	masks, err := findMasks(work)
+	if err != nil {
+		t.Fatalf("findMasks: %v", err)
+	}
+	got := maskedPaths(masks)
+	want := []string{"/app/.env", "/app/api/.env", "/app/secrets/"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("masked = %v, want %v", got, want)
+	}
+}
+
+func TestFindMasksFollowsSymlinks(t *testing.T) {
+	work := t.TempDir()
+	mustWriteFile(t, filepath.Join(work, ignoreFileName), ".env\nsecrets/\n")
+	mustWriteFile(t, filepath.Join(work, "config", "prod.env"), "TOKEN=1\n")
+	mustWriteFile(t, filepath.Join(work, "keys", "id"), "key\n")
+	if err := os.Symlink(filepath.Join("config", "prod.env"), filepath.Join(work, ".env")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := os.Symlink("keys", filepath.Join(work, "secrets")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	masks, err := findMasks(work)
+	if err != nil {
+		t.Fatalf("findMasks: %v", err)
+	}
+	got := maskedPaths(masks)
+	want := []string{"/app/config/prod.env", "/app/keys/"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("masked = %v, want %v", got, want)
+	}
+
+	outside := filepath.Join(t.TempDir(), "prod.env")
+	mustWriteFile(t, outside, "TOKEN=2\n")
+	if err := os.Remove(filepath.Join(work, ".env")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(work, ".env")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if _, err := findMasks(work); err == nil || !strings.Contains(err.Error(), "outside the workspace") {
+		t.Fatalf("findMasks with a link out of the workspace: err = %v", err)
+	}
+}
+
+func TestFindMasksWithoutIgnoreFile(t *testing.T) {
+	masks, err := findMasks(t.TempDir())
+	if err != nil || masks != nil {
+		t.Fatalf("findMasks = %v, %v; want nothing", masks, err)
+	}
+}
+
+func TestBuildDockerArgsMasksIgnoredPaths(t *testing.T) {
+	plan := launchPlan{
+		image:    "repo/image:latest",
+		workDir:  "/tmp/work",
+		command:  []string{"zsh"},
+		masks:    []maskSpec{{rel: "api/.env"}, {rel: "secrets", dir: true}},
+		maskFile: "/cache/dockerx/masked-empty",
+	}
+	args, err := buildDockerArgs(plan)
+	if err != nil {
+		t.Fatalf("buildDockerArgs: %v", err)
+	}
+	if !containsPair(args, "--mount", "type=bind,src=/cache/dockerx/masked-empty,dst=/app/api/.env,readonly") {
+		t.Fatalf("missing file mask in args: %v", args)
+	}
+	if !containsPair(args, "--tmpfs", "/app/secrets:ro,mode=755") {
+		t.Fatalf("missing directory mask in args: %v", args)
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"golang.org/x/term"
 )
@@ -20,14 +22,28 @@ const containerHome = "/home/dev"
 const configStageRoot = "/tmp/dockerx-config"
 
 type cliConfig struct {
-	image       string
-	shell       string
-	noPull      bool
-	noConfig    bool
-	dryRun      bool
-	verbose     bool
-	showVersion bool
-	command     []string
+	image              string
+	shell              string
+	build              buildFlag
+	pull               string
+	noPull             bool
+	locked             bool
+	noConfig           bool
+	addDirs            addDirFlag
+	selinux            string
+	writable           string
+	dockerAccess       string
+	allowDangerousRoot bool
+	usernsHost         bool
+	record             recordFlag
+	recordInput        bool
+	reuse              bool
+	idleTimeout        time.Duration
+	dryRun             bool
+	verbose            bool
+	format             string
+	showVersion        bool
+	command            []string
 }
 
 type mountSpec struct {
@@ -36,10 +52,137 @@ type mountSpec struct {
 	readOnly bool
 }
 
-func launchDockerx(cfg cliConfig) error {
+// launchPlan is everything resolved on the host that shapes the docker run
+// invocation.
+type launchPlan struct {
+	image          string
+	workDir        string
+	addDirs        []mountSpec // extra host directories under /workspaces
+	command        []string
+	configMounts   []mountSpec
+	identityMounts []mountSpec
+	envKeys        []string
+	// tool names the preset the session was launched with, if any;
+	// containerEnv holds the KEY=VALUE pairs its presets set.
+	tool         string
+	containerEnv []string
+	// paths translates mount sources for the docker daemon.
+	paths hostPaths
+	// selinuxRelabel asks docker to relabel bind mounts for SELinux.
+	selinuxRelabel bool
+	// identity selects the container user. The zero value runs as the host
+	// UID:GID.
+	identity identityPlan
+	// detach starts the container in the background instead of attaching.
+	detach bool
+	// configStage holds copies of the config sources to mount instead of
+	// the originals, under SELinux.
+	configStage string
+	// labels are extra key=value container labels.
+	labels []string
+	// writableSystem is the --writable-system mode; systemVolumes are the
+	// volumes it mounts, named in project mode and anonymous in ephemeral
+	// mode.
+	writableSystem string
+	systemVolumes  []mountSpec
+	// gitCredentials is set when git asks the host for credentials.
+	gitCredentials *gitCredentialPlan
+	// browser is set when URLs opened in the container open on the host.
+	browser *browserPlan
+	// dockerAccess is set when the session may reach the Engine API.
+	dockerAccess *dockerAccessPlan
+	// masks are the /app paths hidden by .dockerxignore; masked files are
+	// bound to the empty maskFile.
+	masks    []maskSpec
+	maskFile string
+	// protected are read-only binds over host-executed workspace paths.
+	protected []mountSpec
+	// warnings were found while resolving the plan.
+	warnings []string
+}
+
+// plannedMount is one --mount or --volume of the docker run invocation.
+type plannedMount struct {
+	mountSpec
+	// label is how the mount is relabeled when the plan relabels for SELinux.
+	label string
+	// volume marks a docker volume named src, anonymous when src is empty.
+	volume bool
+	// bindSrc, when set, is bound in place of src, which stays the host path
+	// that plans and the audit log record.
+	bindSrc string
+}
+
+// mounts lists every mount buildDockerArgs passes to docker run, so plans
+// and the audit log record exactly what the container sees.
+func (p launchPlan) mounts() []plannedMount {
+	bind := func(m mountSpec, label string) plannedMount {
+		return plannedMount{mountSpec: m, label: label}
+	}
+	mounts := []plannedMount{bind(mountSpec{src: p.workDir, dst: "/app", readOnly: false}, selinuxShared)}
+	for _, m := range p.masks {
+		if !m.dir {
+			mounts = append(mounts, bind(mountSpec{src: p.maskFile, dst: "/app/" + m.rel, readOnly: true}, selinuxShared))
+		}
+	}
+	for _, m := range p.protected {
+		mounts = append(mounts, bind(m, selinuxShared))
+	}
+	for _, v := range p.systemVolumes {
+		mounts = append(mounts, plannedMount{mountSpec: v, volume: true})
+	}
+	for _, m := range p.addDirs {
+		mounts = append(mounts, bind(m, selinuxShared))
+	}
+	for _, m := range p.identityMounts {
+		mounts = append(mounts, bind(m, selinuxPrivate))
+	}
+	if p.gitCredentials != nil && p.gitCredentials.dir != "" {
+		mounts = append(mounts, bind(mountSpec{src: p.gitCredentials.dir, dst: gitBridgeMount, readOnly: true}, selinuxPrivate))
+	}
+	if p.browser != nil && p.browser.dir != "" {
+		mounts = append(mounts,
+			bind(mountSpec{src: p.browser.dir, dst: browserBridgeMount, readOnly: true}, selinuxPrivate),
+			bind(mountSpec{src: filepath.Join(p.browser.dir, browserBridgeHelper), dst: browserShimPath, readOnly: true}, selinuxPrivate),
+		)
+	}
+	if p.dockerAccess != nil && p.dockerAccess.dir != "" {
+		mounts = append(mounts, bind(mountSpec{src: p.dockerAccess.dir, dst: dockerBridgeMount, readOnly: true}, selinuxPrivate))
+	}
+	for i, m := range p.configMounts {
+		// Config sources in the home directory are never relabeled; only
+		// dockerx's own copies are.
+		mount := bind(mountSpec{src: m.src, dst: fmt.Sprintf("%s/%d", configStageRoot, i), readOnly: true}, selinuxNone)
+		if p.configStage != "" {
+			mount.bindSrc, mount.label = filepath.Join(p.configStage, strconv.Itoa(i)), selinuxPrivate
+		}
+		mounts = append(mounts, mount)
+	}
+	return mounts
+}
+
+func launchDockerx(cfg cliConfig) (err error) {
 	if cfg.image == "" {
 		return errors.New("image cannot be empty")
 	}
+	if err := validatePlanFormat(cfg.format); err != nil {
+		return err
+	}
+	if err := validateSELinuxMode(cfg.selinux); err != nil {
+		return err
+	}
+	if err := validateWritableSystem(cfg.writable); err != nil {
+		return err
+	}
+	if err := validateDockerAccess(cfg.dockerAccess); err != nil {
+		return err
+	}
+	if cfg.recordInput && !cfg.record.enabled {
+		return errors.New("--record-input needs --record")
+	}
+	if cfg.record.enabled && !cfg.dryRun && !(term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))) {
+		return errors.New("--record needs an interactive terminal")
+	}
 	if _, err := exec.LookPath("docker"); err != nil {
 		return errors.New("docker executable not found in PATH")
 	}
@@ -57,63 +200,446 @@ func launchDockerx(cfg cliConfig) error {
 	if err != nil {
 		return fmt.Errorf("resolve user home directory: %w", err)
 	}
+	paths := detectHostPaths(getenv)
+
+	// Launches that end before docker run are logged too, so refusals,
+	// setup failures and interrupts show up in the history.
+	record := sessionRecord{
+		Version: version,
+		Start:   time.Now().UTC(),
+		Project: workDir,
+		Image:   cfg.image,
+		Command: cfg.command,
+	}
+	started := false
+	defer func() {
+		if started || err == nil {
+			return
+		}
+		record.End = time.Now().UTC()
+		record.Status, record.ExitCode = abortedStatus(err)
+		record.Error = err.Error()
+		if err := appendSessionRecord(auditLogPath(homeDir, getenv), record, auditChainEnabled(getenv)); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: session audit log not written: %v\n", err)
+		}
+	}()
+
+	userCfg, err := loadUserConfig(userConfigPath(homeDir, getenv))
+	if err != nil {
+		return err
+	}
+	addDirs, err := resolveAddDirs(collectAddDirs(cfg.addDirs, userCfg, workDir, homeDir), workDir, homeDir, paths)
+	if err != nil {
+		return err
+	}
+	if err := checkDangerousDirs(workDir, addDirs, cfg.allowDangerousRoot, userCfg, homeDir, paths); err != nil {
+		return err
+	}
+	masks, err := findMasks(workDir)
+	if err != nil {
+		return err
+	}
+	protected, protectWarnings, err := protectedMounts(workDir, protectedPaths(userCfg.project(workDir, homeDir)), masks)
+	if err != nil {
+		return err
+	}
+	tools, err := loadToolRegistry(userCfg.Tools)
+	if err != nil {
+		return fmt.Errorf("%s: %w", userCfg.path, err)
+	}
+	tool, toolSpecs, command := tools.resolve(cfg.command)
+
+	policy, err := resolvePullPolicy(cfg.pull, cfg.noPull, cfg.image)
+	if err != nil {
+		return err
+	}
+
+	image := cfg.image
+	if cfg.build.enabled {
+		// Pull the base first so the tag is derived from the image the build
+		// will actually use.
+		if err := ensureImage(cfg.image, policy, cfg.dryRun); err != nil {
+			return err
+		}
+		baseID, _ := imageID(cfg.image)
+		spec, err := resolveBuildSpec(workDir, cfg.build.path, cfg.image, baseID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case imageExists(spec.tag):
+			if cfg.verbose {
+				fmt.Fprintf(os.Stderr, "dockerx: using cached build %s\n", spec.tag)
+			}
+		case cfg.dryRun:
+			fmt.Fprintf(os.Stderr, "dockerx: would build %s from %s (skipped in dry-run)\n", spec.tag, spec.dockerfile)
+		default:
+			if err := buildImage(spec, cfg.verbose); err != nil {
+				return err
+			}
+		}
+		image = spec.tag
+	} else {
+		image, err = applyImageLock(image, workDir, cfg.locked, os.Stderr)
+		if err != nil {
+			return err
+		}
+		if err := ensureImage(image, policy, cfg.dryRun); err != nil {
+			return err
+		}
+	}
+
+	envKeys := gatherPassthroughEnvKeys(toolSpecs)
+	stripCredentials := false
+	named := cfg.image
+	if cfg.build.enabled {
+		named = ""
+	}
+	violation, err := checkImagePolicies(homeDir, image, named)
+	if err != nil {
+		return err
+	}
+	if violation != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v; launching without host config mounts or credential env vars\n", violation)
+		stripCredentials = true
+		envKeys = withoutCredentialEnvKeys(envKeys)
+	}
 
 	configMounts := []mountSpec{}
-	if !cfg.noConfig {
-		configMounts = discoverHostConfigMounts(homeDir, getenv, pathExists)
+	if !cfg.noConfig && !stripCredentials {
+		configMounts = discoverHostConfigMounts(toolSpecs, homeDir, getenv, pathExists, paths)
+		if !paths.sharesSockets() && !userCfg.GitCredentials.Disabled {
+			var mounted bool
+			if configMounts, mounted = gitCredentialsFileMount(configMounts, homeDir, pathExists); mounted {
+				fmt.Fprintln(os.Stderr, "dockerx: the git credential bridge needs a local docker daemon; mounting ~/.git-credentials read-only instead")
+			} else if cfg.verbose {
+				fmt.Fprintln(os.Stderr, "dockerx: git credential bridge needs a local docker daemon; git credentials are not shared")
+			}
+		}
 	}
 
-	identityMounts := []mountSpec{}
-	cleanupIdentity := func() {}
-	defer cleanupIdentity()
-	if !cfg.dryRun {
-		if uidGID, ok := hostUIDGID(); ok {
-			mounts, cleanup, err := prepareIdentityMounts(cfg.image, "dev", containerHome, uidGID)
+	// Catch signals from here on so an interrupt during setup still removes
+	// the identity overlays, and one while docker runs is passed through.
+	relay := startTerminalRelay()
+	defer relay.stop()
+
+	security, err := inspectDaemonSecurity()
+	if err != nil && cfg.verbose {
+		fmt.Fprintf(os.Stderr, "warning: daemon security options unknown, assuming a rootful daemon: %v\n", err)
+	}
+	uidGID, hasUIDGID := hostUIDGID()
+	identity := chooseIdentity(security, uidGID, hasUIDGID, cfg.usernsHost)
+	if identity.warning != "" {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", identity.warning)
+	}
+
+	if len(command) == 0 {
+		command = []string{cfg.shell}
+	}
+
+	plan := launchPlan{
+		image:          image,
+		workDir:        workDir,
+		addDirs:        addDirs,
+		command:        command,
+		configMounts:   configMounts,
+		envKeys:        envKeys,
+		tool:           tool,
+		containerEnv:   toolContainerEnv(toolSpecs),
+		paths:          paths,
+		selinuxRelabel: resolveSELinuxRelabel(cfg.selinux, os.ReadFile),
+		identity:       identity,
+		writableSystem: cfg.writable,
+		masks:          masks,
+		protected:      protected,
+		warnings:       protectWarnings,
+	}
+	if len(masks) > 0 {
+		if plan.maskFile, err = maskFilePath(); err != nil {
+			return err
+		}
+		if err := ensureMaskFile(plan.maskFile); err != nil {
+			return err
+		}
+	}
+	if !cfg.noConfig && !stripCredentials && !userCfg.GitCredentials.Disabled && paths.sharesSockets() {
+		hosts := userCfg.GitCredentials.Hosts
+		if len(hosts) == 0 {
+			hosts = defaultGitCredentialHosts
+		}
+		plan.gitCredentials = &gitCredentialPlan{hosts: hosts, prompt: userCfg.GitCredentials.Prompt}
+	}
+	if !userCfg.Browser.Disabled && paths.sharesSockets() {
+		plan.browser = &browserPlan{domains: userCfg.Browser.Domains}
+	}
+	if cfg.dockerAccess != "" && cfg.dockerAccess != dockerAccessNone {
+		if !paths.sharesSockets() {
+			return errors.New("--docker-access needs a local docker daemon")
+		}
+		plan.dockerAccess = &dockerAccessPlan{mode: cfg.dockerAccess}
+	}
+	switch cfg.writable {
+	case writableProject:
+		plan.systemVolumes = systemVolumes(workDir)
+	case writableEphemeral:
+		plan.systemVolumes = ephemeralSystemVolumes()
+	}
+
+	// With --reuse, a running container with the same spec takes the place
+	// of a fresh one and the identity overlays it already has are kept.
+	var warmID, warmHash, warmDir string
+	if cfg.reuse && !cfg.dryRun {
+		warmHash = reuseSpecHash(plan, imageDigest(image))
+		if warmDir, err = warmStateDir(warmHash); err != nil {
+			return err
+		}
+		if warmID, err = findWarmContainer(warmHash); err != nil {
+			return err
+		}
+		if cfg.verbose && warmID != "" {
+			fmt.Fprintf(os.Stderr, "dockerx: reusing warm container %s\n", warmID)
+		}
+	}
+
+	var sessionDir string
+	if !cfg.dryRun && warmID == "" {
+		root := sessionRoot(getenv)
+		if removed, err := sweepStaleSessions(root, processAlive); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: stale session cleanup failed: %v\n", err)
+		} else if cfg.verbose && len(removed) > 0 {
+			fmt.Fprintf(os.Stderr, "dockerx: removed %d stale session dir(s) from %s\n", len(removed), root)
+		}
+
+		dir, cleanupSession, err := createSessionDir(root)
+		if err != nil {
+			return err
+		}
+		defer cleanupSession()
+		sessionDir = dir
+
+		// A warm container outlives this process, so its overlays must not
+		// live in the session dir.
+		identityDir := filepath.Join(sessionDir, "identity")
+		if cfg.reuse {
+			identityDir = filepath.Join(warmDir, "identity")
+		}
+		if identity.user != "" {
+			mounts, err := prepareIdentityMounts(image, "dev", containerHome, identity.user, identityDir)
 			if err != nil {
 				if cfg.verbose {
 					fmt.Fprintf(os.Stderr, "warning: identity overlay disabled: %v\n", err)
 				}
 			} else {
-				identityMounts = mounts
-				cleanupIdentity = cleanup
+				plan.identityMounts = mounts
 			}
 		}
 	}
 
-	command := cfg.command
-	if len(command) == 0 {
-		command = []string{cfg.shell}
+	// A warm container keeps the bridge directories of the launch that
+	// started it, and every later launch serves on them while it runs.
+	stateDir := sessionDir
+	if cfg.reuse {
+		stateDir = warmDir
+	}
+	if plan.selinuxRelabel && len(plan.configMounts) > 0 && !cfg.dryRun {
+		configDir := filepath.Join(stateDir, "config")
+		if err := stageConfigMounts(plan.configMounts, configDir); err != nil {
+			return err
+		}
+		plan.configStage = configDir
+	}
+	if plan.gitCredentials != nil && !cfg.dryRun {
+		bridgeDir := filepath.Join(stateDir, "git")
+		bridge := &credentialBridge{hosts: plan.gitCredentials.hosts, fill: hostCredentialFill, log: os.Stderr}
+		if plan.gitCredentials.prompt {
+			bridge.confirm = func(host string) bool {
+				return relay.confirm(fmt.Sprintf("release git credentials for %s to the container?", host))
+			}
+		}
+		socket, stopBridge, err := startCredentialBridge(bridgeDir, bridge)
+		if err != nil {
+			return err
+		}
+		defer stopBridge()
+		plan.gitCredentials.dir, plan.gitCredentials.socket = bridgeDir, socket
+	}
+	if plan.browser != nil && !cfg.dryRun {
+		bridgeDir := filepath.Join(stateDir, "browser")
+		socket, stopBridge, err := startBrowserBridge(bridgeDir, &browserBridge{domains: plan.browser.domains, open: hostOpenURL, log: os.Stderr})
+		if err != nil {
+			return err
+		}
+		defer stopBridge()
+		plan.browser.dir, plan.browser.socket = bridgeDir, socket
+	}
+	if plan.dockerAccess != nil && !cfg.dryRun {
+		upstream, err := dockerUpstream()
+		if err != nil {
+			return err
+		}
+		bridgeDir := filepath.Join(stateDir, "docker")
+		filter := &dockerAPIFilter{mode: plan.dockerAccess.mode, roots: sessionWorkspaceRoots(plan)}
+		socket, stopBridge, err := startDockerProxy(bridgeDir, newDockerProxy(upstream, filter, os.Stderr))
+		if err != nil {
+			return err
+		}
+		defer stopBridge()
+		plan.dockerAccess.dir, plan.dockerAccess.socket = bridgeDir, socket
 	}
 
-	args, envKeys, err := buildDockerArgs(cfg.image, workDir, command, configMounts, identityMounts, cfg.noPull)
+	args, err := buildDockerArgs(plan)
 	if err != nil {
 		return err
 	}
 
-	if cfg.verbose || cfg.dryRun {
-		printPlan(cfg.image, workDir, command, configMounts, envKeys, args)
+	showPlan := cfg.verbose || cfg.dryRun
+	if !showPlan || cfg.format == planFormatShell {
+		// Text and JSON plans carry the warnings themselves.
+		for _, warning := range planWarnings(plan) {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+		}
+	}
+	if showPlan {
+		if err := writePlan(os.Stdout, cfg.format, plan, args); err != nil {
+			return err
+		}
 	}
 	if cfg.dryRun {
 		return nil
 	}
+	if status, ok := relay.interrupted(); ok {
+		return status
+	}
+	if plan.writableSystem == writableProject {
+		if err := ensureSystemVolumes(plan.systemVolumes, workDir, imageDigest(image), os.Stderr); err != nil {
+			return err
+		}
+	}
+
+	watched := riskyPaths(userCfg, userCfg.project(workDir, homeDir))
+	before := snapshotWorkspace(workDir, watched)
+	record.Image = image
+	record.Digest = imageDigest(image)
+	record.Mounts = plannedMountRecords(plan.mounts())
+	record.EnvKeys = envKeys
+	record.Command = command
+
+	if cfg.reuse {
+		if warmID == "" {
+			warmArgs, err := buildDockerArgs(warmPlan(plan, warmHash, cfg.idleTimeout))
+			if err != nil {
+				return err
+			}
+			if warmID, err = startWarmContainer(warmArgs, configMounts, warmDir); err != nil {
+				return err
+			}
+		} else if err := refreshWarmConfigs(warmID, identity.user, configMounts, warmDir); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+		tty := term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+		// The warm container's env names the sockets of the launch that
+		// started it; this session uses the ones this launch serves.
+		execCommand, err := relayExecSignals(relay, warmID, identity.user, command)
+		if err != nil {
+			return err
+		}
+		args = buildExecArgs(sessionContainer{id: warmID, project: workDir}, workDir, identity.user, envKeys, bridgeSocketEnv(plan), tty, execCommand)
+	}
 
 	cmd := exec.Command("docker", args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("docker run failed: %w", err)
+	started = true
+	record.Start = time.Now().UTC()
+	var runErr error
+	if cfg.record.enabled {
+		rec := recording{
+			path:  cfg.record.path,
+			input: cfg.recordInput,
+			header: castHeader{
+				Command: shellJoin(command),
+				Title:   "dockerx: " + workDir,
+				Env:     map[string]string{"TERM": getenv("TERM"), "SHELL": cfg.shell},
+			},
+		}
+		if rec.path == "" {
+			rec.path = defaultRecordingPath(homeDir, workDir, getenv, record.Start.Local())
+		} else if rec.path, err = filepath.Abs(rec.path); err != nil {
+			return fmt.Errorf("resolve recording path: %w", err)
+		}
+		record.Recording = rec.path
+		runErr = rec.run(relay, cmd)
+	} else {
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		runErr = relay.run(cmd)
 	}
 
+	record.End = time.Now().UTC()
+	record.ExitCode = exitCode(runErr)
+	record.RiskyChanges = compareSnapshots(before, snapshotWorkspace(workDir, watched))
+	color := term.IsTerminal(int(os.Stderr.Fd())) && getenv("NO_COLOR") == ""
+	writeRiskyReport(os.Stderr, record.RiskyChanges, color)
+	if record.Recording != "" {
+		fmt.Fprintf(os.Stderr, "dockerx: session recorded to %s (play it with dockerx replay)\n", record.Recording)
+	}
+	if err := appendSessionRecord(auditLogPath(homeDir, getenv), record, auditChainEnabled(getenv)); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: session audit log not written: %v\n", err)
+	}
+
+	if code := record.ExitCode; code > 0 {
+		return exitStatusError{code: code}
+	}
+	if runErr != nil {
+		return fmt.Errorf("docker run failed: %w", runErr)
+	}
 	return nil
 }
 
-func buildDockerArgs(image, workDir string, command []string, configMounts, identityMounts []mountSpec, noPull bool) ([]string, []string, error) {
-	if strings.Contains(workDir, ",") {
-		return nil, nil, fmt.Errorf("current directory contains an unsupported comma: %q", workDir)
+func buildDockerArgs(plan launchPlan) ([]string, error) {
+	if strings.Contains(plan.workDir, ",") {
+		return nil, fmt.Errorf("current directory contains an unsupported comma: %q", plan.workDir)
+	}
+
+	// Mount sources are recorded as the host sees them and only rewritten
+	// for the daemon here, so plans and the audit log keep host paths.
+	// --mount cannot relabel for SELinux, so relabeled mounts use --volume.
+	var mountArgs []string
+	for _, m := range plan.mounts() {
+		if m.volume {
+			if m.src == "" {
+				mountArgs = append(mountArgs, "--mount", "type=volume,dst="+m.dst)
+			} else {
+				mountArgs = append(mountArgs, "--mount", "type=volume,src="+m.src+",dst="+m.dst)
+			}
+			continue
+		}
+		spec := m.mountSpec
+		if m.bindSrc != "" {
+			spec.src = m.bindSrc
+		}
+		if strings.Contains(spec.src, ",") {
+			return nil, fmt.Errorf("mount source contains an unsupported comma: %q", spec.src)
+		}
+		spec.src = plan.paths.dockerPath(spec.src)
+		if !plan.selinuxRelabel || m.label == selinuxNone {
+			mountArgs = append(mountArgs, "--mount", formatMount(spec))
+			continue
+		}
+		if strings.Contains(spec.src, ":") {
+			return nil, fmt.Errorf("mount source contains a colon, which cannot be relabeled for SELinux: %q", spec.src)
+		}
+		mountArgs = append(mountArgs, "--volume", formatVolume(spec, m.label))
+	}
+	for _, m := range plan.masks {
+		if m.dir {
+			mountArgs = append(mountArgs, "--tmpfs", "/app/"+m.rel+":ro,mode=755")
+		}
 	}
 
 	uidGID, hasUIDGID := hostUIDGID()
+	if plan.identity.strategy != "" {
+		uidGID, hasUIDGID = plan.identity.user, plan.identity.user != ""
+	}
 
 	containerHomeTmpfs := containerHome + ":mode=755"
 	if hasUIDGID {
@@ -123,13 +649,23 @@ func buildDockerArgs(image, workDir string, command []string, configMounts, iden
 		}
 	}
 
-	args := []string{"run", "--rm", "-i"}
-	if !noPull && shouldAlwaysPull(image) {
-		args = append(args, "--pull", "always")
-	}
-	if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+	// The image was already resolved by the pull phase; never let docker run
+	// fetch a different one after identity overlays were read from it.
+	args := []string{"run", "--rm", "-i", "--pull", "never"}
+	if plan.detach {
+		args[2] = "-d"
+	} else if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
 		args = append(args, "-t")
 	}
+	// The project label lets `dockerx exec` find this session later.
+	args = append(args, "--label", projectLabel+"="+plan.workDir)
+	if plan.tool != "" {
+		args = append(args, "--label", toolLabel+"="+plan.tool)
+	}
+	args = append(args, "--label", envLabel+"="+strings.Join(plan.envKeys, ","))
+	for _, label := range plan.labels {
+		args = append(args, "--label", label)
+	}
 
 	args = append(args,
 		"--read-only",
@@ -137,7 +673,14 @@ func buildDockerArgs(image, workDir string, command []string, configMounts, iden
 		"--cap-add", "SETUID",
 		"--cap-add", "SETGID",
 		"--cap-add", "AUDIT_WRITE",
-		"--mount", formatMount(mountSpec{src: workDir, dst: "/app", readOnly: false}),
+	)
+	if plan.writableSystem == writableEphemeral || plan.writableSystem == writableProject {
+		for _, c := range systemWriteCaps {
+			args = append(args, "--cap-add", c)
+		}
+	}
+	args = append(args, mountArgs...)
+	args = append(args,
 		"--tmpfs", "/tmp:mode=1777",
 		"--tmpfs", "/run:mode=755",
 		"--tmpfs", "/var/tmp:mode=1777",
@@ -147,41 +690,84 @@ func buildDockerArgs(image, workDir string, command []string, configMounts, iden
 		"--workdir", "/app",
 		"--env", "HOME="+containerHome,
 		"--env", "USER=dev",
-		"--env", "CODEX_HOME="+containerHome+"/.codex",
 	)
+	for _, env := range plan.containerEnv {
+		args = append(args, "--env", env)
+	}
 
+	if plan.identity.usernsHost {
+		args = append(args, "--userns", "host")
+	}
 	if hasUIDGID {
 		args = append(args, "--user", uidGID)
 	}
 
-	for _, m := range identityMounts {
-		if strings.Contains(m.src, ",") {
-			return nil, nil, fmt.Errorf("mount source contains an unsupported comma: %q", m.src)
+	if plan.gitCredentials != nil && plan.gitCredentials.dir != "" {
+		for _, env := range gitBridgeEnv() {
+			args = append(args, "--env", env)
 		}
-		args = append(args, "--mount", formatMount(m))
+	}
+	if plan.browser != nil && plan.browser.dir != "" {
+		args = append(args, "--env", "BROWSER="+browserBridgeMount+"/"+browserBridgeHelper)
+	}
+	for _, env := range bridgeSocketEnv(plan) {
+		args = append(args, "--env", env)
 	}
 
-	for i, m := range configMounts {
-		if strings.Contains(m.src, ",") {
-			return nil, nil, fmt.Errorf("mount source contains an unsupported comma: %q", m.src)
-		}
+	for i, m := range plan.configMounts {
 		stagePath := fmt.Sprintf("%s/%d", configStageRoot, i)
-		args = append(args, "--mount", formatMount(mountSpec{src: m.src, dst: stagePath, readOnly: true}))
 		args = append(args, "--env", fmt.Sprintf("DOCKERX_CONFIG_SRC_%d=%s", i, stagePath))
 		args = append(args, "--env", fmt.Sprintf("DOCKERX_CONFIG_DST_%d=%s", i, m.dst))
 	}
-	if len(configMounts) > 0 {
-		args = append(args, "--env", fmt.Sprintf("DOCKERX_CONFIG_COUNT=%d", len(configMounts)))
+	if len(plan.configMounts) > 0 {
+		args = append(args, "--env", fmt.Sprintf("DOCKERX_CONFIG_COUNT=%d", len(plan.configMounts)))
 	}
 
-	envKeys := gatherPassthroughEnvKeys()
-	for _, key := range envKeys {
+	for _, key := range plan.envKeys {
 		args = append(args, "--env", key)
 	}
 
-	args = append(args, image)
-	args = append(args, command...)
-	return args, envKeys, nil
+	args = append(args, plan.image)
+	args = append(args, plan.command...)
+	return args, nil
+}
+
+// bridgeSocketEnv points the session at the sockets this launch serves its
+// bridges on.
+func bridgeSocketEnv(plan launchPlan) []string {
+	socket := func(name, fallback string) string {
+		if name == "" {
+			return fallback
+		}
+		return name
+	}
+	var env []string
+	if plan.gitCredentials != nil && plan.gitCredentials.dir != "" {
+		env = append(env, gitBridgeSocketEnv+"="+gitBridgeMount+"/"+socket(plan.gitCredentials.socket, gitBridgeSocket))
+	}
+	if plan.browser != nil && plan.browser.dir != "" {
+		env = append(env, browserBridgeSocketEnv+"="+browserBridgeMount+"/"+socket(plan.browser.socket, browserBridgeSocket))
+	}
+	if plan.dockerAccess != nil && plan.dockerAccess.dir != "" {
+		env = append(env, "DOCKER_HOST=unix://"+dockerBridgeMount+"/"+socket(plan.dockerAccess.socket, dockerBridgeSocket))
+	}
+	return env
+}
+
+// exitCode reports the exit status of a finished command, or -1 when it did
+// not run to completion.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return signalExitCode(status.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	return -1
 }
 
 func shouldAlwaysPull(image string) bool {
@@ -191,71 +777,72 @@ func shouldAlwaysPull(image string) bool {
 	return ref == "wpkpda/dockerx" || strings.HasPrefix(ref, "wpkpda/dockerx:")
 }
 
-func prepareIdentityMounts(image, username, home, uidGID string) ([]mountSpec, func(), error) {
+func prepareIdentityMounts(image, username, home, uidGID, dir string) ([]mountSpec, error) {
 	parts := strings.SplitN(uidGID, ":", 2)
 	if len(parts) != 2 {
-		return nil, nil, fmt.Errorf("invalid uid:gid: %q", uidGID)
+		return nil, fmt.Errorf("invalid uid:gid: %q", uidGID)
 	}
 	uid, err := strconv.Atoi(parts[0])
 	if err != nil {
-		return nil, nil, fmt.Errorf("invalid uid in %q: %w", uidGID, err)
+		return nil, fmt.Errorf("invalid uid in %q: %w", uidGID, err)
 	}
 	gid, err := strconv.Atoi(parts[1])
 	if err != nil {
-		return nil, nil, fmt.Errorf("invalid gid in %q: %w", uidGID, err)
-	}
-	if uid == 0 {
-		return nil, func() {}, nil
+		return nil, fmt.Errorf("invalid gid in %q: %w", uidGID, err)
 	}
 
 	passwdBase, err := readImageFile(image, "/etc/passwd")
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	if uid == 0 {
+		// Root already exists in the image; only its home needs to match.
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("create identity dir: %w", err)
+		}
+		passwdPath := filepath.Join(dir, "passwd")
+		if err := os.WriteFile(passwdPath, []byte(setRootHome(passwdBase, home)), 0o644); err != nil {
+			return nil, fmt.Errorf("write passwd overlay: %w", err)
+		}
+		return []mountSpec{{src: passwdPath, dst: "/etc/passwd", readOnly: true}}, nil
 	}
 	groupBase, err := readImageFile(image, "/etc/group")
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	shadowBase, err := readImageFile(image, "/etc/shadow")
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	passwdContent, groupContent, shadowContent := ensureRuntimeIdentity(passwdBase, groupBase, shadowBase, username, home, uid, gid)
 
-	tmpDir, err := os.MkdirTemp("", "dockerx-identity-")
-	if err != nil {
-		return nil, nil, fmt.Errorf("create identity temp dir: %w", err)
-	}
-	cleanup := func() {
-		_ = os.RemoveAll(tmpDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create identity dir: %w", err)
 	}
 
-	passwdPath := filepath.Join(tmpDir, "passwd")
-	groupPath := filepath.Join(tmpDir, "group")
-	shadowPath := filepath.Join(tmpDir, "shadow")
+	passwdPath := filepath.Join(dir, "passwd")
+	groupPath := filepath.Join(dir, "group")
+	shadowPath := filepath.Join(dir, "shadow")
 	if err := os.WriteFile(passwdPath, []byte(passwdContent), 0o644); err != nil {
-		cleanup()
-		return nil, nil, fmt.Errorf("write passwd overlay: %w", err)
+		return nil, fmt.Errorf("write passwd overlay: %w", err)
 	}
 	if err := os.WriteFile(groupPath, []byte(groupContent), 0o644); err != nil {
-		cleanup()
-		return nil, nil, fmt.Errorf("write group overlay: %w", err)
+		return nil, fmt.Errorf("write group overlay: %w", err)
 	}
 	if err := os.WriteFile(shadowPath, []byte(shadowContent), 0o400); err != nil {
-		cleanup()
-		return nil, nil, fmt.Errorf("write shadow overlay: %w", err)
+		return nil, fmt.Errorf("write shadow overlay: %w", err)
 	}
 
 	return []mountSpec{
 		{src: passwdPath, dst: "/etc/passwd", readOnly: true},
 		{src: groupPath, dst: "/etc/group", readOnly: true},
 		{src: shadowPath, dst: "/etc/shadow", readOnly: true},
-	}, cleanup, nil
+	}, nil
 }
 
 func readImageFile(image, path string) (string, error) {
-	cmd := exec.Command("docker", "run", "--rm", "--entrypoint", "cat", image, path)
+	cmd := exec.Command("docker", "run", "--rm", "--pull", "never", "--entrypoint", "cat", image, path)
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -346,61 +933,15 @@ func joinLines(lines []string) string {
 	return strings.Join(lines, "\n") + "\n"
 }
 
-func printPlan(image, workDir string, command []string, configMounts []mountSpec, envKeys, args []string) {
-	fmt.Printf("Image: %s\n", image)
-	fmt.Printf("Workdir: %s -> /app (rw)\n", workDir)
-	if len(configMounts) == 0 {
-		fmt.Println("Host config mounts: none")
-	} else {
-		fmt.Println("Host config mounts:")
-		for i, m := range configMounts {
-			stagePath := fmt.Sprintf("%s/%d", configStageRoot, i)
-			fmt.Printf("  - %s -> %s (ro), copied to %s (rw)\n", m.src, stagePath, m.dst)
+// discoverHostConfigMounts lists the config paths of specs that exist on the
+// host.
+func discoverHostConfigMounts(specs []toolSpec, homeDir string, lookupEnv func(string) string, exists func(string) bool, paths hostPaths) []mountSpec {
+	var candidates []mountSpec
+	for _, spec := range specs {
+		for _, c := range spec.Config {
+			candidates = append(candidates, mountSpec{src: c.hostPath(homeDir, lookupEnv), dst: c.containerPath(), readOnly: true})
 		}
 	}
-	if len(envKeys) == 0 {
-		fmt.Println("Passthrough env: none")
-	} else {
-		fmt.Printf("Passthrough env: %s\n", strings.Join(envKeys, ", "))
-	}
-	fmt.Printf("Container command: %s\n", strings.Join(command, " "))
-	fmt.Printf("Docker args: %s\n", strings.Join(args, " "))
-}
-
-func discoverHostConfigMounts(homeDir string, lookupEnv func(string) string, exists func(string) bool) []mountSpec {
-	configHome := lookupEnv("XDG_CONFIG_HOME")
-	if configHome == "" {
-		configHome = filepath.Join(homeDir, ".config")
-	}
-
-	cacheHome := lookupEnv("XDG_CACHE_HOME")
-	if cacheHome == "" {
-		cacheHome = filepath.Join(homeDir, ".cache")
-	}
-
-	hfHome := lookupEnv("HF_HOME")
-	if hfHome == "" {
-		hfHome = filepath.Join(cacheHome, "huggingface")
-	}
-
-	codexHome := lookupEnv("CODEX_HOME")
-	if codexHome == "" {
-		codexHome = filepath.Join(homeDir, ".codex")
-	}
-
-	candidates := []mountSpec{
-		{src: codexHome, dst: containerHome + "/.codex", readOnly: true},
-		{src: filepath.Join(configHome, "codex"), dst: containerHome + "/.config/codex", readOnly: true},
-		{src: filepath.Join(homeDir, ".openai"), dst: containerHome + "/.openai", readOnly: true},
-		{src: filepath.Join(configHome, "gh"), dst: containerHome + "/.config/gh", readOnly: true},
-		{src: filepath.Join(configHome, "git"), dst: containerHome + "/.config/git", readOnly: true},
-		{src: filepath.Join(homeDir, ".gitconfig"), dst: containerHome + "/.gitconfig", readOnly: true},
-		{src: filepath.Join(homeDir, ".git-credentials"), dst: containerHome + "/.git-credentials", readOnly: true},
-		{src: filepath.Join(homeDir, ".ssh"), dst: containerHome + "/.ssh", readOnly: true},
-		{src: filepath.Join(homeDir, ".huggingface"), dst: containerHome + "/.huggingface", readOnly: true},
-		{src: filepath.Join(configHome, "huggingface"), dst: containerHome + "/.config/huggingface", readOnly: true},
-		{src: hfHome, dst: containerHome + "/.cache/huggingface", readOnly: true},
-	}
 
 	found := make([]mountSpec, 0, len(candidates))
 	seenSrc := map[string]struct{}{}
@@ -412,10 +953,11 @@ func discoverHostConfigMounts(homeDir string, lookupEnv func(string) string, exi
 		if err != nil {
 			continue
 		}
-		if _, seen := seenSrc[abs]; seen {
+		key := paths.key(abs)
+		if _, seen := seenSrc[key]; seen {
 			continue
 		}
-		seenSrc[abs] = struct{}{}
+		seenSrc[key] = struct{}{}
 		c.src = abs
 		found = append(found, c)
 	}
@@ -426,31 +968,17 @@ func discoverHostConfigMounts(homeDir string, lookupEnv func(string) string, exi
 	return found
 }
 
-func gatherPassthroughEnvKeys() []string {
-	keys := []string{
-		"TERM",
-		"COLORTERM",
-		"OPENAI_API_KEY",
-		"OPENAI_BASE_URL",
-		"ANTHROPIC_API_KEY",
-		"GEMINI_API_KEY",
-		"AZURE_OPENAI_API_KEY",
-		"AZURE_OPENAI_ENDPOINT",
-		"GITHUB_TOKEN",
-		"GH_TOKEN",
-		"HF_TOKEN",
-		"HUGGINGFACEHUB_API_TOKEN",
-		"HTTP_PROXY",
-		"HTTPS_PROXY",
-		"NO_PROXY",
-	}
-
-	out := make([]string, 0, len(keys))
-	for _, key := range keys {
-		if strings.TrimSpace(os.Getenv(key)) == "" {
-			continue
+// gatherPassthroughEnvKeys lists the env vars of specs that are set on the
+// host.
+func gatherPassthroughEnvKeys(specs []toolSpec) []string {
+	var out []string
+	for _, spec := range specs {
+		for _, key := range spec.Env {
+			if strings.TrimSpace(os.Getenv(key)) == "" || slices.Contains(out, key) {
+				continue
+			}
+			out = append(out, key)
 		}
-		out = append(out, key)
 	}
 	return out
 }
@@ -481,6 +1009,15 @@ func formatMount(m mountSpec) string {
 	return "type=bind,src=" + m.src + ",dst=" + m.dst + mode
 }
 
+// formatVolume renders m as a --volume value with an SELinux relabel option.
+func formatVolume(m mountSpec, label string) string {
+	opts := label
+	if m.readOnly {
+		opts = "ro," + label
+	}
+	return m.src + ":" + m.dst + ":" + opts
+}
+
 func pathExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
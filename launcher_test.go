@@ -17,16 +17,16 @@ func TestDiscoverHostConfigMounts(t *testing.T) {
 	mustMkdirAll(t, filepath.Join(configHome, "gh"))
 	mustMkdirAll(t, filepath.Join(home, ".ssh"))
 	mustMkdirAll(t, filepath.Join(cacheHome, "huggingface"))
-	mustWriteFile(t, filepath.Join(home, ".gitconfig"))
+	mustWriteFile(t, filepath.Join(home, ".gitconfig"), "x")
 
 	env := map[string]string{
 		"XDG_CONFIG_HOME": configHome,
 		"XDG_CACHE_HOME":  cacheHome,
 	}
 
-	mounts := discoverHostConfigMounts(home, func(key string) string {
+	mounts := discoverHostConfigMounts(allToolSpecs(t), home, func(key string) string {
 		return env[key]
-	}, pathExists)
+	}, pathExists, hostPaths{})
 
 	if len(mounts) == 0 {
 		t.Fatal("expected mounts, got none")
@@ -40,7 +40,7 @@ func TestDiscoverHostConfigMounts(t *testing.T) {
 }
 
 func TestBuildDockerArgsIncludesSecurityDefaults(t *testing.T) {
-	args, _, err := buildDockerArgs("repo/image:latest", "/tmp/work", []string{"zsh"}, nil, nil, false)
+	args, err := buildDockerArgs(launchPlan{image: "repo/image:latest", workDir: "/tmp/work", command: []string{"zsh"}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -72,42 +72,25 @@ func TestBuildDockerArgsIncludesSecurityDefaults(t *testing.T) {
 	}
 }
 
-func TestBuildDockerArgsPullAlwaysForDockerxImage(t *testing.T) {
-	args, _, err := buildDockerArgs("wpkpda/dockerx:latest", "/tmp/work", []string{"zsh"}, nil, nil, false)
+func TestBuildDockerArgsNeverPullsAtRun(t *testing.T) {
+	args, err := buildDockerArgs(launchPlan{image: "wpkpda/dockerx:latest", workDir: "/tmp/work", command: []string{"zsh"}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if !containsPair(args, "--pull", "always") {
-		t.Fatalf("expected --pull always in args: %v", args)
-	}
-}
-
-func TestBuildDockerArgsDoesNotForcePullForOtherImages(t *testing.T) {
-	args, _, err := buildDockerArgs("repo/image:latest", "/tmp/work", []string{"zsh"}, nil, nil, false)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	if !containsPair(args, "--pull", "never") {
+		t.Fatalf("expected --pull never in args: %v", args)
 	}
 	if containsPair(args, "--pull", "always") {
 		t.Fatalf("did not expect --pull always in args: %v", args)
 	}
 }
 
-func TestBuildDockerArgsNoPullSkipsAlwaysPolicy(t *testing.T) {
-	args, _, err := buildDockerArgs("wpkpda/dockerx:latest", "/tmp/work", []string{"zsh"}, nil, nil, true)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if containsPair(args, "--pull", "always") {
-		t.Fatalf("did not expect --pull always in args with no-pull: %v", args)
-	}
-}
-
 func TestBuildDockerArgsStagesConfigMounts(t *testing.T) {
 	configMounts := []mountSpec{
 		{src: "/host/.codex", dst: containerHome + "/.codex", readOnly: true},
 	}
 
-	args, _, err := buildDockerArgs("repo/image:latest", "/tmp/work", []string{"zsh"}, configMounts, nil, false)
+	args, err := buildDockerArgs(launchPlan{image: "repo/image:latest", workDir: "/tmp/work", command: []string{"zsh"}, configMounts: configMounts})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -129,8 +112,50 @@ func TestBuildDockerArgsStagesConfigMounts(t *testing.T) {
 	}
 }
 
+func TestMountsMatchDockerArgs(t *testing.T) {
+	plan := launchPlan{
+		image:          "repo/image:latest",
+		workDir:        "/tmp/work",
+		command:        []string{"zsh"},
+		masks:          []maskSpec{{rel: ".env"}, {rel: "secrets", dir: true}},
+		maskFile:       "/tmp/session/mask",
+		protected:      []mountSpec{{src: "/tmp/work/.git/hooks", dst: "/app/.git/hooks", readOnly: true}},
+		systemVolumes:  ephemeralSystemVolumes(),
+		identityMounts: []mountSpec{{src: "/tmp/session/passwd", dst: "/etc/passwd", readOnly: true}},
+		gitCredentials: &gitCredentialPlan{dir: "/tmp/session/git"},
+		browser:        &browserPlan{dir: "/tmp/session/browser"},
+		dockerAccess:   &dockerAccessPlan{dir: "/tmp/session/docker"},
+		configMounts:   []mountSpec{{src: "/host/.codex", dst: containerHome + "/.codex", readOnly: true}},
+	}
+	args, err := buildDockerArgs(plan)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+
+	var targets []string
+	for i, arg := range args[:len(args)-1] {
+		if arg == "--mount" || arg == "--volume" {
+			_, rest, _ := strings.Cut(args[i+1], "dst=")
+			dst, _, _ := strings.Cut(rest, ",")
+			targets = append(targets, dst)
+		}
+	}
+	var recorded []string
+	for _, m := range plannedMountRecords(plan.mounts()) {
+		recorded = append(recorded, m.Target)
+	}
+	if !slices.Equal(recorded, targets) {
+		t.Fatalf("recorded mounts %q, docker run mounts %q", recorded, targets)
+	}
+	for _, want := range []string{"/app/.env", gitBridgeMount, browserShimPath, dockerBridgeMount, systemVolumes("/tmp/work")[0].dst} {
+		if !slices.Contains(recorded, want) {
+			t.Fatalf("recorded mounts lack %s: %q", want, recorded)
+		}
+	}
+}
+
 func TestBuildDockerArgsRejectsCommaInWorkdir(t *testing.T) {
-	_, _, err := buildDockerArgs("repo/image:latest", "/tmp/bad,path", []string{"zsh"}, nil, nil, false)
+	_, err := buildDockerArgs(launchPlan{image: "repo/image:latest", workDir: "/tmp/bad,path", command: []string{"zsh"}})
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -144,7 +169,7 @@ func TestGatherPassthroughEnvKeys(t *testing.T) {
 	t.Setenv("GH_TOKEN", "token")
 	t.Setenv("HF_TOKEN", "")
 
-	keys := gatherPassthroughEnvKeys()
+	keys := gatherPassthroughEnvKeys(allToolSpecs(t))
 	if !slices.Contains(keys, "OPENAI_API_KEY") {
 		t.Fatalf("expected OPENAI_API_KEY in %v", keys)
 	}
@@ -233,12 +258,12 @@ func mustMkdirAll(t *testing.T, path string) {
 	}
 }
 
-func mustWriteFile(t *testing.T, path string) {
+func mustWriteFile(t *testing.T, path, content string) {
 	t.Helper()
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		t.Fatalf("mkdir parent %s: %v", path, err)
 	}
-	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
 		t.Fatalf("write file %s: %v", path, err)
 	}
 }
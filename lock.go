@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const lockFileName = ".dockerx.lock"
+
+type imageLock struct {
+	Image    string    `json:"image"`
+	Digest   string    `json:"digest"`
+	LockedAt time.Time `json:"lockedAt"`
+}
+
+// reference returns the digest-pinned form of the locked image.
+func (l imageLock) reference() string {
+	return imageRepository(l.Image) + "@" + l.Digest
+}
+
+func runLock(args []string) int {
+	flags := flag.NewFlagSet("lock", flag.ContinueOnError)
+	image := flags.String("image", defaultImage(), "Docker image to lock")
+	update := flags.Bool("update", false, "Pull the image and refresh an existing lock")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if err := lockImage(*image, *update); err != nil {
+		fmt.Fprintf(os.Stderr, "dockerx: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func lockImage(image string, update bool) error {
+	if image == "" {
+		return errors.New("image cannot be empty")
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		return errors.New("docker executable not found in PATH")
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("resolve current directory: %w", err)
+	}
+
+	existing, found, err := readImageLock(workDir)
+	if err != nil {
+		return err
+	}
+	if found && !update {
+		return fmt.Errorf("%s already pins %s; use `dockerx lock --update` to refresh it", lockFileName, existing.reference())
+	}
+
+	if update || !imageExists(image) {
+		cmd := exec.Command("docker", "pull", image)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("docker pull failed: %w", err)
+		}
+	}
+
+	digest, err := resolveImageDigest(image)
+	if err != nil {
+		return err
+	}
+	lock := imageLock{Image: image, Digest: digest, LockedAt: time.Now().UTC()}
+	if err := writeImageLock(workDir, lock); err != nil {
+		return err
+	}
+
+	if found && existing.Digest != digest {
+		fmt.Printf("Updated %s: %s -> %s\n", lockFileName, existing.Digest, digest)
+	} else {
+		fmt.Printf("Locked %s to %s\n", image, lock.reference())
+	}
+	return nil
+}
+
+// applyImageLock returns the image reference to launch. When the project has a
+// lock for the requested image it returns the pinned digest, warning (or
+// failing in strict mode) if the local tag has drifted from it.
+func applyImageLock(image, workDir string, strict bool, stderr io.Writer) (string, error) {
+	lock, found, err := readImageLock(workDir)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		if strict {
+			return "", fmt.Errorf("--locked requires %s; run `dockerx lock` first", lockFileName)
+		}
+		return image, nil
+	}
+	if lock.Image != image {
+		if strict {
+			return "", fmt.Errorf("%s pins %s, not %s", lockFileName, lock.Image, image)
+		}
+		fmt.Fprintf(stderr, "warning: %s pins %s; ignoring it for %s\n", lockFileName, lock.Image, image)
+		return image, nil
+	}
+
+	if repoDigests, ok := localRepoDigests(image); ok {
+		if drift := lockDrift(lock, repoDigests); drift != "" {
+			if strict {
+				return "", errors.New(drift)
+			}
+			fmt.Fprintf(stderr, "warning: %s; launching the locked digest\n", drift)
+		}
+	}
+	return lock.reference(), nil
+}
+
+// lockDrift describes how the local tag differs from the lock, or returns an
+// empty string when the tag still resolves to the locked digest.
+func lockDrift(lock imageLock, repoDigests []string) string {
+	current, ok := repoDigestFor(lock.Image, repoDigests)
+	if !ok || current == lock.Digest {
+		return ""
+	}
+	return fmt.Sprintf("local %s is %s but %s pins %s (run `dockerx lock --update` to accept it)", lock.Image, current, lockFileName, lock.Digest)
+}
+
+func readImageLock(dir string) (imageLock, bool, error) {
+	path := filepath.Join(dir, lockFileName)
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return imageLock{}, false, nil
+	}
+	if err != nil {
+		return imageLock{}, false, fmt.Errorf("read %s: %w", lockFileName, err)
+	}
+
+	var lock imageLock
+	if err := json.Unmarshal(content, &lock); err != nil {
+		return imageLock{}, false, fmt.Errorf("parse %s: %w", lockFileName, err)
+	}
+	if lock.Image == "" || !strings.HasPrefix(lock.Digest, "sha256:") {
+		return imageLock{}, false, fmt.Errorf("parse %s: missing image or sha256 digest", lockFileName)
+	}
+	return lock, true, nil
+}
+
+func writeImageLock(dir string, lock imageLock) error {
+	content, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", lockFileName, err)
+	}
+	content = append(content, '\n')
+	if err := os.WriteFile(filepath.Join(dir, lockFileName), content, 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", lockFileName, err)
+	}
+	return nil
+}
+
+func resolveImageDigest(image string) (string, error) {
+	repoDigests, ok := localRepoDigests(image)
+	if !ok {
+		return "", fmt.Errorf("inspect image %s: image not found locally", image)
+	}
+	digest, ok := repoDigestFor(image, repoDigests)
+	if !ok {
+		return "", fmt.Errorf("image %s has no registry digest; only pushed images can be locked", image)
+	}
+	return digest, nil
+}
+
+func localRepoDigests(image string) ([]string, bool) {
+	cmd := exec.Command("docker", "image", "inspect", "--format", "{{json .RepoDigests}}", image)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = io.Discard
+	if err := cmd.Run(); err != nil {
+		return nil, false
+	}
+	var repoDigests []string
+	if err := json.Unmarshal(bytes.TrimSpace(stdout.Bytes()), &repoDigests); err != nil {
+		return nil, false
+	}
+	return repoDigests, true
+}
+
+// repoDigestFor picks the digest recorded for image's repository from the
+// RepoDigests reported by docker image inspect.
+func repoDigestFor(image string, repoDigests []string) (string, bool) {
+	repo := normalizeRepository(imageRepository(image))
+	for _, rd := range repoDigests {
+		name, digest, ok := strings.Cut(rd, "@")
+		if !ok {
+			continue
+		}
+		if normalizeRepository(name) == repo {
+			return digest, true
+		}
+	}
+	return "", false
+}
+
+// imageRepository strips the tag and digest from an image reference.
+func imageRepository(image string) string {
+	ref, _, _ := strings.Cut(strings.TrimSpace(image), "@")
+	lastSlash := strings.LastIndex(ref, "/")
+	if colon := strings.LastIndex(ref, ":"); colon > lastSlash {
+		ref = ref[:colon]
+	}
+	return ref
+}
+
+func normalizeRepository(repo string) string {
+	repo = strings.ToLower(repo)
+	repo = strings.TrimPrefix(repo, "docker.io/")
+	repo = strings.TrimPrefix(repo, "index.docker.io/")
+	return strings.TrimPrefix(repo, "library/")
+}
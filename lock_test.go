@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImageRepository(t *testing.T) {
+	for input, want := range map[string]string{
+		"wpkpda/dockerx":                   "wpkpda/dockerx",
+		"wpkpda/dockerx:latest":            "wpkpda/dockerx",
+		"wpkpda/dockerx@sha256:abc":        "wpkpda/dockerx",
+		"localhost:5000/team/dockerx:1.2":  "localhost:5000/team/dockerx",
+		"localhost:5000/team/dockerx":      "localhost:5000/team/dockerx",
+		"ghcr.io/org/img:tag@sha256:abc":   "ghcr.io/org/img",
+		" docker.io/library/ubuntu:22.04 ": "docker.io/library/ubuntu",
+	} {
+		if got := imageRepository(input); got != want {
+			t.Fatalf("imageRepository(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestRepoDigestFor(t *testing.T) {
+	repoDigests := []string{
+		"ghcr.io/org/dockerx@sha256:1111",
+		"wpkpda/dockerx@sha256:2222",
+	}
+	digest, ok := repoDigestFor("docker.io/wpkpda/dockerx:latest", repoDigests)
+	if !ok || digest != "sha256:2222" {
+		t.Fatalf("unexpected digest %q ok=%t", digest, ok)
+	}
+
+	digest, ok = repoDigestFor("ubuntu:22.04", []string{"ubuntu@sha256:3333"})
+	if !ok || digest != "sha256:3333" {
+		t.Fatalf("unexpected library digest %q ok=%t", digest, ok)
+	}
+
+	if _, ok := repoDigestFor("other/image:latest", repoDigests); ok {
+		t.Fatal("did not expect a digest for an unrelated repository")
+	}
+}
+
+func TestLockDrift(t *testing.T) {
+	lock := imageLock{Image: "wpkpda/dockerx:latest", Digest: "sha256:aaaa"}
+
+	if drift := lockDrift(lock, []string{"wpkpda/dockerx@sha256:aaaa"}); drift != "" {
+		t.Fatalf("did not expect drift: %s", drift)
+	}
+	if drift := lockDrift(lock, nil); drift != "" {
+		t.Fatalf("did not expect drift without a local digest: %s", drift)
+	}
+
+	drift := lockDrift(lock, []string{"wpkpda/dockerx@sha256:bbbb"})
+	if !strings.Contains(drift, "sha256:bbbb") || !strings.Contains(drift, "dockerx lock --update") {
+		t.Fatalf("unexpected drift message: %s", drift)
+	}
+}
+
+func TestImageLockRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if _, found, err := readImageLock(dir); err != nil || found {
+		t.Fatalf("expected no lock, found=%t err=%v", found, err)
+	}
+
+	lock := imageLock{Image: "wpkpda/dockerx:latest", Digest: "sha256:abcd", LockedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	if err := writeImageLock(dir, lock); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+
+	got, found, err := readImageLock(dir)
+	if err != nil || !found {
+		t.Fatalf("expected lock, found=%t err=%v", found, err)
+	}
+	if got != lock {
+		t.Fatalf("unexpected lock: %+v", got)
+	}
+	if got.reference() != "wpkpda/dockerx@sha256:abcd" {
+		t.Fatalf("unexpected reference: %s", got.reference())
+	}
+}
+
+func TestReadImageLockRejectsInvalidDigest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, lockFileName), []byte(`{"image":"wpkpda/dockerx:latest","digest":"latest"}`), 0o644); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	if _, _, err := readImageLock(dir); err == nil {
+		t.Fatal("expected error for invalid digest")
+	}
+}
+
+func TestApplyImageLockWithoutLock(t *testing.T) {
+	dir := t.TempDir()
+
+	image, err := applyImageLock("wpkpda/dockerx:latest", dir, false, &bytes.Buffer{})
+	if err != nil || image != "wpkpda/dockerx:latest" {
+		t.Fatalf("unexpected result %q err=%v", image, err)
+	}
+
+	if _, err := applyImageLock("wpkpda/dockerx:latest", dir, true, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected --locked to require a lock file")
+	}
+}
+
+func TestApplyImageLockIgnoresOtherImages(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeImageLock(dir, imageLock{Image: "wpkpda/dockerx:latest", Digest: "sha256:abcd"}); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+
+	var stderr bytes.Buffer
+	image, err := applyImageLock("repo/other:latest", dir, false, &stderr)
+	if err != nil || image != "repo/other:latest" {
+		t.Fatalf("unexpected result %q err=%v", image, err)
+	}
+	if !strings.Contains(stderr.String(), "ignoring it") {
+		t.Fatalf("expected warning, got %q", stderr.String())
+	}
+
+	if _, err := applyImageLock("repo/other:latest", dir, true, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected --locked to reject a lock for another image")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -13,6 +14,25 @@ func main() {
 }
 
 func run() int {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lock":
+			return runLock(os.Args[2:])
+		case "history":
+			return runHistory(os.Args[2:])
+		case "export":
+			return runExport(os.Args[2:])
+		case "exec":
+			return runExec(os.Args[2:])
+		case "prune":
+			return runPrune(os.Args[2:])
+		case "system":
+			return runSystem(os.Args[2:])
+		case "replay":
+			return runReplay(os.Args[2:])
+		}
+	}
+
 	cfg := parseCLI()
 	if cfg.showVersion {
 		fmt.Println(version)
@@ -20,29 +40,49 @@ func run() int {
 	}
 
 	if err := launchDockerx(cfg); err != nil {
+		var status exitStatusError
+		if errors.As(err, &status) {
+			return status.code
+		}
 		fmt.Fprintf(os.Stderr, "dockerx: %v\n", err)
 		return 1
 	}
 	return 0
 }
 
-func parseCLI() cliConfig {
-	imageDefault := os.Getenv("DOCKERX_IMAGE")
-	if imageDefault == "" {
-		imageDefault = "wpkpda/dockerx:latest"
+func defaultImage() string {
+	if image := os.Getenv("DOCKERX_IMAGE"); image != "" {
+		return image
 	}
+	return "wpkpda/dockerx:latest"
+}
 
+func parseCLI() cliConfig {
 	cfg := cliConfig{
-		image: imageDefault,
+		image: defaultImage(),
 		shell: "zsh",
 	}
 
 	flag.StringVar(&cfg.image, "image", cfg.image, "Docker image to run")
 	flag.StringVar(&cfg.shell, "shell", cfg.shell, "Shell to launch when no command is provided")
-	flag.BoolVar(&cfg.noPull, "no-pull", false, "Disable forced pull policy for dockerx images")
+	flag.Var(&cfg.build, "build", "Build and run Dockerfile.dockerx, or the given Dockerfile path (--build=path)")
+	flag.StringVar(&cfg.pull, "pull", "", "Pull policy: always, missing, never, daily or weekly (default always for dockerx images, missing otherwise)")
+	flag.BoolVar(&cfg.noPull, "no-pull", false, "Shorthand for --pull=missing")
+	flag.BoolVar(&cfg.locked, "locked", false, "Fail instead of warning when the image drifts from .dockerx.lock")
 	flag.BoolVar(&cfg.noConfig, "no-config", false, "Disable automatic host config mounts")
+	flag.Var(&cfg.addDirs, "add-dir", "Mount another host directory at /workspaces/<name>; append :ro for read-only (repeatable)")
+	flag.StringVar(&cfg.selinux, "selinux", selinuxAuto, "SELinux relabeling of bind mounts: auto (when enforcing), off or relabel")
+	flag.StringVar(&cfg.writable, "writable-system", writableOff, "Make /usr/local, /opt and dpkg state writable: off, ephemeral (discarded on exit) or project (kept in per-project volumes)")
+	flag.BoolVar(&cfg.usernsHost, "userns-host", false, "Under userns-remap, run the container in the host user namespace so --user is the host user")
+	flag.BoolVar(&cfg.allowDangerousRoot, "allow-dangerous-root", false, "Allow launching in a home, root or system directory, or one containing ~/.ssh or ~/.aws")
+	flag.StringVar(&cfg.dockerAccess, "docker-access", dockerAccessNone, "Engine API access from the container: none, readonly or filtered")
+	flag.Var(&cfg.record, "record", "Record the session as an asciicast v2 file, by default under the dockerx state dir (--record=file)")
+	flag.BoolVar(&cfg.recordInput, "record-input", false, "Also record keyboard input with --record")
+	flag.BoolVar(&cfg.reuse, "reuse", false, "Keep the project's container warm and run later commands in it")
+	flag.DurationVar(&cfg.idleTimeout, "idle-timeout", defaultIdleTimeout, "Stop a --reuse container after it has been idle this long")
 	flag.BoolVar(&cfg.dryRun, "dry-run", false, "Print docker command without executing it")
 	flag.BoolVar(&cfg.verbose, "verbose", false, "Print resolved mounts and environment passthrough")
+	flag.StringVar(&cfg.format, "format", planFormatText, "Plan output format for --dry-run and --verbose: text, json or shell")
 	flag.BoolVar(&cfg.showVersion, "version", false, "Print dockerx version")
 	flag.Parse()
 
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	planFormatText  = "text"
+	planFormatJSON  = "json"
+	planFormatShell = "shell"
+)
+
+// planRecord is the machine-readable form of a launch plan.
+type planRecord struct {
+	Image        string               `json:"image"`
+	Tool         string               `json:"tool,omitempty"`
+	Workdir      string               `json:"workdir"`
+	AddDirs      []mountRecord        `json:"addDirs,omitempty"`
+	Mounts       []mountRecord        `json:"mounts"`
+	ConfigCopies []configCopyRecord   `json:"configCopies"`
+	EnvKeys      []string             `json:"envKeys"`
+	Command      []string             `json:"command"`
+	Args         []string             `json:"args"`
+	SELinux      string               `json:"selinux,omitempty"`
+	Writable     string               `json:"writableSystem,omitempty"`
+	Volumes      []mountRecord        `json:"systemVolumes,omitempty"`
+	Git          *gitCredentialRecord `json:"gitCredentials,omitempty"`
+	Browser      *browserRecord       `json:"browser,omitempty"`
+	DockerAccess string               `json:"dockerAccess,omitempty"`
+	Masked       []string             `json:"masked,omitempty"`
+	Identity     *identityRecord      `json:"identity,omitempty"`
+	Warnings     []string             `json:"warnings,omitempty"`
+}
+
+// identityRecord explains how the container user was chosen.
+type identityRecord struct {
+	Strategy string   `json:"strategy"`
+	User     string   `json:"user,omitempty"`
+	Reasons  []string `json:"reasons"`
+}
+
+// gitCredentialRecord describes the host git credential bridge.
+type gitCredentialRecord struct {
+	Hosts  []string `json:"hosts"`
+	Prompt bool     `json:"prompt"`
+}
+
+// browserRecord describes the browser-open bridge.
+type browserRecord struct {
+	Domains []string `json:"domains,omitempty"`
+}
+
+// configCopyRecord describes a staged config mount that the entrypoint copies
+// into the container home on startup.
+type configCopyRecord struct {
+	Source string `json:"source"`
+	Staged string `json:"staged"`
+	Target string `json:"target"`
+}
+
+func validatePlanFormat(format string) error {
+	switch format {
+	case "", planFormatText, planFormatJSON, planFormatShell:
+		return nil
+	default:
+		return fmt.Errorf("invalid format %q (want text, json or shell)", format)
+	}
+}
+
+func writePlan(w io.Writer, format string, plan launchPlan, args []string) error {
+	switch format {
+	case "", planFormatText:
+		writePlanText(w, plan, args)
+		return nil
+	case planFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(newPlanRecord(plan, args)); err != nil {
+			return fmt.Errorf("encode plan: %w", err)
+		}
+		return nil
+	case planFormatShell:
+		_, err := fmt.Fprintln(w, shellJoin(append([]string{"docker"}, args...)))
+		return err
+	default:
+		return validatePlanFormat(format)
+	}
+}
+
+func newPlanRecord(plan launchPlan, args []string) planRecord {
+	rec := planRecord{
+		Image:        plan.image,
+		Tool:         plan.tool,
+		Workdir:      plan.workDir,
+		AddDirs:      mountRecords(plan.addDirs),
+		Mounts:       plannedMountRecords(plan.mounts()),
+		ConfigCopies: []configCopyRecord{},
+		EnvKeys:      plan.envKeys,
+		Command:      plan.command,
+		Args:         args,
+		Masked:       maskedPaths(plan.masks),
+	}
+	if rec.EnvKeys == nil {
+		rec.EnvKeys = []string{}
+	}
+	if plan.selinuxRelabel {
+		rec.SELinux = selinuxRelabel
+	}
+	if plan.writableSystem != "" && plan.writableSystem != writableOff {
+		rec.Writable = plan.writableSystem
+		rec.Volumes = mountRecords(plan.systemVolumes)
+	}
+	if plan.identity.strategy != "" {
+		rec.Identity = &identityRecord{
+			Strategy: string(plan.identity.strategy),
+			User:     plan.identity.user,
+			Reasons:  plan.identity.reasons,
+		}
+	}
+	if g := plan.gitCredentials; g != nil {
+		rec.Git = &gitCredentialRecord{Hosts: g.hosts, Prompt: g.prompt}
+	}
+	if d := plan.dockerAccess; d != nil {
+		rec.DockerAccess = d.mode
+	}
+	if b := plan.browser; b != nil {
+		rec.Browser = &browserRecord{Domains: b.domains}
+	}
+	rec.Warnings = planWarnings(plan)
+	for i, m := range plan.configMounts {
+		rec.ConfigCopies = append(rec.ConfigCopies, configCopyRecord{
+			Source: m.src,
+			Staged: fmt.Sprintf("%s/%d", configStageRoot, i),
+			Target: m.dst,
+		})
+	}
+	return rec
+}
+
+func writePlanText(w io.Writer, plan launchPlan, args []string) {
+	fmt.Fprintf(w, "Image: %s\n", plan.image)
+	if plan.tool != "" {
+		fmt.Fprintf(w, "Tool: %s (only its config and env keys are passed)\n", plan.tool)
+	}
+	fmt.Fprintf(w, "Workdir: %s -> /app (rw)\n", plan.workDir)
+	if len(plan.addDirs) > 0 {
+		fmt.Fprintln(w, "Additional dirs:")
+		for _, m := range plan.addDirs {
+			fmt.Fprintf(w, "  - %s -> %s (%s)\n", m.src, m.dst, accessMode(m.readOnly))
+		}
+	}
+	if len(plan.masks) > 0 {
+		fmt.Fprintf(w, "Masked by %s:\n", ignoreFileName)
+		for _, m := range plan.masks {
+			kind := "empty file"
+			if m.dir {
+				kind = "empty tmpfs"
+			}
+			fmt.Fprintf(w, "  - /app/%s (%s)\n", m.rel, kind)
+		}
+	}
+	if len(plan.protected) > 0 {
+		fmt.Fprintln(w, "Read-only in /app:")
+		for _, m := range plan.protected {
+			fmt.Fprintf(w, "  - %s\n", m.dst)
+		}
+	}
+	if plan.identity.strategy != "" {
+		fmt.Fprintf(w, "Identity: %s\n", plan.identity.strategy)
+		for _, reason := range plan.identity.reasons {
+			fmt.Fprintf(w, "  - %s\n", reason)
+		}
+	}
+	if plan.selinuxRelabel {
+		fmt.Fprintln(w, "SELinux: relabel (workspace shared, config and identity private)")
+	}
+	switch plan.writableSystem {
+	case writableEphemeral:
+		fmt.Fprintln(w, "Writable system: ephemeral (discarded on exit)")
+		for _, v := range plan.systemVolumes {
+			fmt.Fprintf(w, "  - %s (rw)\n", v.dst)
+		}
+	case writableProject:
+		fmt.Fprintln(w, "Writable system: project volumes")
+		for _, v := range plan.systemVolumes {
+			fmt.Fprintf(w, "  - %s -> %s (rw)\n", v.src, v.dst)
+		}
+	}
+	if g := plan.gitCredentials; g != nil {
+		mode := "released"
+		if g.prompt {
+			mode = "released after a host prompt"
+		}
+		fmt.Fprintf(w, "Git credentials: host bridge for %s (%s)\n", strings.Join(g.hosts, ", "), mode)
+	}
+	if b := plan.browser; b != nil {
+		domains := "any domain"
+		if len(b.domains) > 0 {
+			domains = strings.Join(b.domains, ", ")
+		}
+		fmt.Fprintf(w, "Browser: host bridge for http(s) URLs on %s\n", domains)
+	}
+	if d := plan.dockerAccess; d != nil {
+		switch d.mode {
+		case dockerAccessReadonly:
+			fmt.Fprintln(w, "Docker access: readonly (GET and HEAD only)")
+		case dockerAccessFiltered:
+			fmt.Fprintln(w, "Docker access: filtered (no privileged containers, host namespaces or binds outside the workspace)")
+		}
+	}
+	for _, warning := range planWarnings(plan) {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+	if len(plan.configMounts) == 0 {
+		fmt.Fprintln(w, "Host config mounts: none")
+	} else {
+		fmt.Fprintln(w, "Host config mounts:")
+		for i, m := range plan.configMounts {
+			stagePath := fmt.Sprintf("%s/%d", configStageRoot, i)
+			fmt.Fprintf(w, "  - %s -> %s (ro), copied to %s (rw)\n", m.src, stagePath, m.dst)
+		}
+	}
+	if len(plan.envKeys) == 0 {
+		fmt.Fprintln(w, "Passthrough env: none")
+	} else {
+		fmt.Fprintf(w, "Passthrough env: %s\n", strings.Join(plan.envKeys, ", "))
+	}
+	fmt.Fprintf(w, "Container command: %s\n", shellJoin(plan.command))
+	fmt.Fprintf(w, "Docker args: %s\n", shellJoin(args))
+}
+
+// planWarnings lists what the user should know before the session starts.
+func planWarnings(plan launchPlan) []string {
+	warnings := slices.Clone(plan.warnings)
+	if warning := systemDirWarning(plan); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
+
+func accessMode(readOnly bool) string {
+	if readOnly {
+		return "ro"
+	}
+	return "rw"
+}
+
+// shellJoin quotes each argument for a POSIX shell and joins them with spaces.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote leaves words made only of safe characters as they are and
+// single-quotes everything else.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !isShellSafe(r) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func isShellSafe(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("@%+=:,./_-", r)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// fixturePlan is the launch plan the plan, export and reuse tests start from:
+// a pinned image in workDir with one config mount, two passthrough env keys
+// and a fixed host user.
+func fixturePlan(workDir string) launchPlan {
+	return launchPlan{
+		image:        "wpkpda/dockerx@sha256:0123abcd",
+		workDir:      workDir,
+		command:      []string{"zsh"},
+		configMounts: []mountSpec{{src: "/home/me/.codex", dst: containerHome + "/.codex", readOnly: true}},
+		envKeys:      []string{"TERM", "OPENAI_API_KEY"},
+		identity:     identityPlan{strategy: identityHostUser, user: "1000:1000"},
+	}
+}
+
+func goldenPlan(t *testing.T) (launchPlan, []string) {
+	t.Helper()
+	plan := fixturePlan("/home/me/My Projects/it's here")
+	plan.command = []string{"sh", "-c", "echo $HOME && make test"}
+	plan.configMounts = append(plan.configMounts, mountSpec{src: "/home/me/.config/gh", dst: containerHome + "/.config/gh", readOnly: true})
+	plan.identityMounts = []mountSpec{{src: "/tmp/dockerx-identity-1/passwd", dst: "/etc/passwd", readOnly: true}}
+	return plan, goldenArgs(t, plan, false)
+}
+
+// goldenArgs builds the docker args for plan as a launch would, so the golden
+// files follow changes to buildDockerArgs. Whether -t is added depends on the
+// terminal the tests run in, so it is set from tty instead.
+func goldenArgs(t *testing.T, plan launchPlan, tty bool) []string {
+	t.Helper()
+	args, err := buildDockerArgs(plan)
+	if err != nil {
+		t.Fatalf("build docker args: %v", err)
+	}
+	args = slices.DeleteFunc(args, func(arg string) bool { return arg == "-t" })
+	if tty {
+		args = slices.Insert(args, slices.Index(args, "never")+1, "-t")
+	}
+	return args
+}
+
+func TestWritePlanGolden(t *testing.T) {
+	plan, args := goldenPlan(t)
+	for _, tt := range []struct {
+		format string
+		file   string
+	}{
+		{planFormatText, "plan.txt"},
+		{planFormatJSON, "plan.json"},
+		{planFormatShell, "plan.sh"},
+	} {
+		var out bytes.Buffer
+		if err := writePlan(&out, tt.format, plan, args); err != nil {
+			t.Fatalf("write %s plan: %v", tt.format, err)
+		}
+		assertGolden(t, filepath.Join("testdata", tt.file), out.Bytes())
+	}
+}
+
+func TestShellPlanRoundTripsThroughShell(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	_, args := goldenPlan(t)
+
+	// Replace docker with printf so the shell echoes back the words it parsed.
+	line := "printf '%s\\n' " + shellJoin(args)
+	out, err := exec.Command(sh, "-c", line).Output()
+	if err != nil {
+		t.Fatalf("run shell: %v", err)
+	}
+	want := joinLines(args)
+	if string(out) != want {
+		t.Fatalf("shell parsed different words:\n got: %q\nwant: %q", out, want)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for input, want := range map[string]string{
+		"":                        "''",
+		"plain":                   "plain",
+		"type=bind,src=/a,dst=/b": "type=bind,src=/a,dst=/b",
+		"with space":              "'with space'",
+		"it's":                    `'it'\''s'`,
+		"$HOME":                   "'$HOME'",
+		"a*b":                     "'a*b'",
+	} {
+		if got := shellQuote(input); got != want {
+			t.Fatalf("shellQuote(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
+
+func TestValidatePlanFormat(t *testing.T) {
+	for _, format := range []string{"", planFormatText, planFormatJSON, planFormatShell} {
+		if err := validatePlanFormat(format); err != nil {
+			t.Fatalf("validatePlanFormat(%q): %v", format, err)
+		}
+	}
+	if err := validatePlanFormat("yaml"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func assertGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("write golden %s: %v", path, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden %s (run go test -update to create it): %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s mismatch (run go test -update to accept):\n got:\n%s\nwant:\n%s", path, got, want)
+	}
+}
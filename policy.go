@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	policyRefuse = "refuse"
+	policyStrip  = "strip"
+)
+
+// imagePolicy restricts which images may receive host config mounts and
+// credentials. Allow entries are image references with * and ? globs, or
+// bare sha256 digests.
+type imagePolicy struct {
+	path        string
+	Allow       []string `yaml:"allow"`
+	OnViolation string   `yaml:"onViolation"`
+}
+
+type policyViolation struct {
+	image  string
+	action string
+	paths  []string
+	allow  []string
+}
+
+func (v policyViolation) Error() string {
+	return fmt.Sprintf("image %s is not allowed by the trusted image policy (%s); allowed: %s",
+		v.image, strings.Join(v.paths, ", "), strings.Join(v.allow, ", "))
+}
+
+// imagePolicyPaths lists the system-wide policy followed by the user policy.
+func imagePolicyPaths(homeDir string, lookupEnv func(string) string) []string {
+	system := "/etc/dockerx/policy.yaml"
+	if runtime.GOOS == "windows" {
+		programData := lookupEnv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		system = filepath.Join(programData, "dockerx", "policy.yaml")
+	}
+
+	configHome := lookupEnv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	return []string{system, filepath.Join(configHome, "dockerx", "policy.yaml")}
+}
+
+func loadImagePolicies(paths []string) ([]imagePolicy, error) {
+	var policies []imagePolicy
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read image policy %s: %w", path, err)
+		}
+
+		var p imagePolicy
+		if err := yaml.Unmarshal(content, &p); err != nil {
+			return nil, fmt.Errorf("parse image policy %s: %w", path, err)
+		}
+		p.path = path
+		switch p.OnViolation {
+		case "":
+			p.OnViolation = policyRefuse
+		case policyRefuse, policyStrip:
+		default:
+			return nil, fmt.Errorf("parse image policy %s: onViolation must be %q or %q", path, policyRefuse, policyStrip)
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// evaluateImagePolicies checks the launched image against every loaded
+// policy. refs lists the names the image is known by (for example the tag and
+// the digest-pinned reference from .dockerx.lock); any of them may match. The
+// image must be allowed by all policies, and refuse wins over strip.
+func evaluateImagePolicies(policies []imagePolicy, refs []string, digest string) *policyViolation {
+	var v *policyViolation
+	for _, p := range policies {
+		if p.allows(refs, digest) {
+			continue
+		}
+		if v == nil {
+			v = &policyViolation{image: refs[0], action: policyStrip}
+		}
+		v.paths = append(v.paths, p.path)
+		v.allow = append(v.allow, p.Allow...)
+		if p.OnViolation == policyRefuse {
+			v.action = policyRefuse
+		}
+	}
+	if v != nil && len(v.allow) == 0 {
+		v.allow = []string{"nothing"}
+	}
+	return v
+}
+
+func (p imagePolicy) allows(refs []string, digest string) bool {
+	for _, entry := range p.Allow {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if strings.HasPrefix(entry, "sha256:") {
+			if digest != "" && globMatch(entry, digest) {
+				return true
+			}
+			continue
+		}
+
+		repo := imageRepository(entry)
+		suffix := entry[len(repo):]
+		repo = normalizeRepository(repo)
+		for _, ref := range refs {
+			ref = normalizeImageReference(ref)
+			// Anything could be in a local build, so only an entry naming
+			// the local repository allows it, not a catch-all glob.
+			if isLocalBuild(ref) && !strings.HasPrefix(repo, buildImageRepo+"/") {
+				continue
+			}
+			// An entry without a tag or digest covers the whole repository.
+			if suffix == "" {
+				if globMatch(repo, imageRepository(ref)) {
+					return true
+				}
+				continue
+			}
+			if globMatch(repo+suffix, ref) {
+				return true
+			}
+			if digest != "" && globMatch(repo+suffix, imageRepository(ref)+"@"+digest) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isLocalBuild reports whether ref names an image built by --build.
+func isLocalBuild(ref string) bool {
+	return strings.HasPrefix(normalizeImageReference(ref), buildImageRepo+"/")
+}
+
+// normalizeImageReference spells Docker Hub references the short way and
+// adds the implicit :latest tag.
+func normalizeImageReference(ref string) string {
+	ref = strings.ToLower(strings.TrimSpace(ref))
+	repo := imageRepository(ref)
+	suffix := ref[len(repo):]
+	if suffix == "" {
+		suffix = ":latest"
+	}
+	return normalizeRepository(repo) + suffix
+}
+
+// globMatch matches s against pattern where * spans any run of characters,
+// including slashes, and ? matches a single character.
+func globMatch(pattern, s string) bool {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	matched, err := regexp.MatchString(b.String(), s)
+	return err == nil && matched
+}
+
+// checkImagePolicies evaluates image against the configured policies. A lock
+// pins the image the user named to a digest, which is still that image, so
+// named is checked as well; it is empty for builds, whose base is not the
+// launched image. A refusal is returned as the error, a strip violation as
+// the result.
+func checkImagePolicies(homeDir, image, named string) (*policyViolation, error) {
+	policies, err := loadImagePolicies(imagePolicyPaths(homeDir, getenv))
+	if err != nil || len(policies) == 0 {
+		return nil, err
+	}
+	refs := []string{image}
+	if named != "" && named != image {
+		refs = append(refs, named)
+	}
+	v := evaluateImagePolicies(policies, refs, imageDigest(image))
+	if v != nil && v.action == policyRefuse {
+		return nil, v
+	}
+	return v, nil
+}
+
+// imageDigest returns the registry digest of a pulled image, if known.
+func imageDigest(image string) string {
+	if _, digest, ok := strings.Cut(image, "@"); ok {
+		return digest
+	}
+	repoDigests, ok := localRepoDigests(image)
+	if !ok {
+		return ""
+	}
+	digest, _ := repoDigestFor(image, repoDigests)
+	return digest
+}
+
+// strippedEnvKeepKeys are the passthrough env vars a stripped launch keeps.
+// Tool presets and user config can pass any key, so everything else is
+// treated as a possible credential.
+var strippedEnvKeepKeys = []string{
+	"TERM",
+	"COLORTERM",
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"NO_PROXY",
+}
+
+func withoutCredentialEnvKeys(keys []string) []string {
+	out := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if slices.Contains(strippedEnvKeepKeys, key) {
+			out = append(out, key)
+		}
+	}
+	return out
+}
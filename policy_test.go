@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestImagePolicyAllows(t *testing.T) {
+	p := imagePolicy{Allow: []string{
+		"wpkpda/dockerx",
+		"ghcr.io/myorg/*",
+		"registry.local:5000/tools/node:2?",
+		"sha256:feedface*",
+	}}
+
+	tests := []struct {
+		refs   []string
+		digest string
+		want   bool
+	}{
+		{[]string{"wpkpda/dockerx:latest"}, "", true},
+		{[]string{"docker.io/wpkpda/dockerx:test"}, "", true},
+		{[]string{"wpkpda/dockerx@sha256:0123"}, "sha256:0123", true},
+		{[]string{"wpkpda/dockerx-evil:latest"}, "", false},
+		{[]string{"ghcr.io/myorg/team/img:1.0"}, "", true},
+		{[]string{"ghcr.io/other/img:1.0"}, "", false},
+		{[]string{"registry.local:5000/tools/node:20"}, "", true},
+		{[]string{"registry.local:5000/tools/node:18"}, "", false},
+		{[]string{"random/image:latest"}, "sha256:feedface0001", true},
+		{[]string{"random/image:latest"}, "sha256:deadbeef", false},
+		{[]string{"random/image@sha256:abcd", "wpkpda/dockerx:latest"}, "sha256:abcd", true},
+	}
+	for _, tt := range tests {
+		if got := p.allows(tt.refs, tt.digest); got != tt.want {
+			t.Fatalf("allows(%v, %q) = %t, want %t", tt.refs, tt.digest, got, tt.want)
+		}
+	}
+}
+
+func TestImagePolicyTaggedEntries(t *testing.T) {
+	p := imagePolicy{Allow: []string{"wpkpda/dockerx:stable", "ubuntu:*"}}
+
+	if !p.allows([]string{"wpkpda/dockerx:stable"}, "") {
+		t.Fatal("expected exact tag to be allowed")
+	}
+	if p.allows([]string{"wpkpda/dockerx:latest"}, "") {
+		t.Fatal("did not expect other tags to be allowed")
+	}
+	if p.allows([]string{"wpkpda/dockerx"}, "") {
+		t.Fatal("did not expect implicit latest tag to be allowed")
+	}
+	if !p.allows([]string{"docker.io/library/ubuntu:24.04"}, "") {
+		t.Fatal("expected library image to match short pattern")
+	}
+}
+
+func TestImagePolicyLocalBuilds(t *testing.T) {
+	local := []string{"dockerx-local/app:0123abcd"}
+	for _, allow := range []string{"*", "*/*", "*:0123abcd"} {
+		if (imagePolicy{Allow: []string{allow}}).allows(local, "") {
+			t.Fatalf("%q allowed a local build", allow)
+		}
+	}
+	for _, allow := range []string{"dockerx-local/*", "dockerx-local/app"} {
+		if !(imagePolicy{Allow: []string{allow}}).allows(local, "") {
+			t.Fatalf("%q did not allow the local build", allow)
+		}
+	}
+}
+
+func TestEvaluateImagePolicies(t *testing.T) {
+	system := imagePolicy{path: "/etc/dockerx/policy.yaml", Allow: []string{"wpkpda/dockerx"}, OnViolation: policyStrip}
+	user := imagePolicy{path: "/home/me/.config/dockerx/policy.yaml", Allow: []string{"wpkpda/*"}, OnViolation: policyRefuse}
+
+	if v := evaluateImagePolicies([]imagePolicy{system, user}, []string{"wpkpda/dockerx:latest"}, ""); v != nil {
+		t.Fatalf("unexpected violation: %v", v)
+	}
+
+	v := evaluateImagePolicies([]imagePolicy{system, user}, []string{"wpkpda/other:latest"}, "")
+	if v == nil || v.action != policyStrip || !slices.Equal(v.paths, []string{system.path}) {
+		t.Fatalf("expected strip violation from system policy, got %+v", v)
+	}
+
+	v = evaluateImagePolicies([]imagePolicy{system, user}, []string{"evil/image:latest"}, "")
+	if v == nil || v.action != policyRefuse || len(v.paths) != 2 {
+		t.Fatalf("expected refuse violation from both policies, got %+v", v)
+	}
+	if !strings.Contains(v.Error(), "evil/image:latest") || !strings.Contains(v.Error(), "wpkpda/*") {
+		t.Fatalf("unexpected violation message: %s", v.Error())
+	}
+
+	if v := evaluateImagePolicies(nil, []string{"evil/image:latest"}, ""); v != nil {
+		t.Fatalf("did not expect a violation without policies: %v", v)
+	}
+}
+
+func TestLoadImagePolicies(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(valid, []byte("onViolation: strip\nallow:\n  - wpkpda/dockerx\n  - \"sha256:abcd\"\n"), 0o644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+
+	policies, err := loadImagePolicies([]string{filepath.Join(dir, "missing.yaml"), valid})
+	if err != nil {
+		t.Fatalf("load policies: %v", err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("expected one policy, got %d", len(policies))
+	}
+	if policies[0].path != valid || policies[0].OnViolation != policyStrip || !slices.Equal(policies[0].Allow, []string{"wpkpda/dockerx", "sha256:abcd"}) {
+		t.Fatalf("unexpected policy: %+v", policies[0])
+	}
+
+	defaulted := filepath.Join(dir, "default.yaml")
+	if err := os.WriteFile(defaulted, []byte("allow: []\n"), 0o644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	policies, err = loadImagePolicies([]string{defaulted})
+	if err != nil || policies[0].OnViolation != policyRefuse {
+		t.Fatalf("expected refuse by default, got %+v err=%v", policies, err)
+	}
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("onViolation: ignore\n"), 0o644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	if _, err := loadImagePolicies([]string{invalid}); err == nil {
+		t.Fatal("expected error for unknown onViolation")
+	}
+}
+
+func TestImagePolicyPaths(t *testing.T) {
+	paths := imagePolicyPaths("/home/me", func(key string) string {
+		if key == "XDG_CONFIG_HOME" {
+			return "/xdg"
+		}
+		return ""
+	})
+	if len(paths) != 2 || paths[1] != filepath.Join("/xdg", "dockerx", "policy.yaml") {
+		t.Fatalf("unexpected policy paths: %v", paths)
+	}
+}
+
+func TestWithoutCredentialEnvKeys(t *testing.T) {
+	got := withoutCredentialEnvKeys([]string{"TERM", "OPENAI_API_KEY", "HTTPS_PROXY", "GH_TOKEN"})
+	if !slices.Equal(got, []string{"TERM", "HTTPS_PROXY"}) {
+		t.Fatalf("unexpected keys: %v", got)
+	}
+
+	// Keys from presets and user config are stripped without being listed.
+	tools, err := loadToolRegistry(nil)
+	if err != nil {
+		t.Fatalf("load tools: %v", err)
+	}
+	_, specs, _ := tools.resolve([]string{"aider"})
+	t.Setenv("OPENROUTER_API_KEY", "sk-test")
+	t.Setenv("TERM", "xterm")
+	keys := gatherPassthroughEnvKeys(specs)
+	if !slices.Contains(keys, "OPENROUTER_API_KEY") {
+		t.Fatalf("preset key not passed through: %v", keys)
+	}
+	if got := withoutCredentialEnvKeys(keys); slices.Contains(got, "OPENROUTER_API_KEY") || !slices.Contains(got, "TERM") {
+		t.Fatalf("stripped keys: %v", got)
+	}
+}
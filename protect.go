@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// defaultProtectedPaths are workspace paths the host executes or trusts:
+// git runs hooks and honours core.fsmonitor or core.hooksPath from the
+// config, and direnv and mise evaluate their files on cd.
+var defaultProtectedPaths = []string{
+	".git/hooks",
+	".git/config",
+	".envrc",
+	".mise.toml",
+	"mise.toml",
+}
+
+// protectedPaths merges the defaults with a project's protect and unprotect
+// lists.
+func protectedPaths(project projectConfig) []string {
+	return mergeWorkspacePaths(defaultProtectedPaths, project.Protect, project.Unprotect)
+}
+
+// mergeWorkspacePaths appends add to defaults and drops remove, comparing
+// paths in their cleaned, slash-separated form.
+func mergeWorkspacePaths(defaults, add, remove []string) []string {
+	normalize := func(p string) string {
+		return strings.Trim(filepath.ToSlash(filepath.Clean(p)), "/")
+	}
+	var removed []string
+	for _, p := range remove {
+		removed = append(removed, normalize(p))
+	}
+	var paths []string
+	for _, p := range append(slices.Clone(defaults), add...) {
+		p = normalize(p)
+		if p == "" || p == "." || slices.Contains(paths, p) || slices.Contains(removed, p) {
+			continue
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// protectedMounts returns read-only binds over the protected paths that exist
+// in workDir, plus warnings for the ones that are symlinks. A missing
+// .git/hooks is created first, since git would run hooks the session put
+// there. In a worktree or submodule .git is a file naming the git directory,
+// which the session could point at hooks and config of its own, so the file
+// itself is protected instead. Paths under a .dockerxignore mask are hidden
+// already and skipped.
+func protectedMounts(workDir string, rels []string, masks []maskSpec) ([]mountSpec, []string, error) {
+	var mounts []mountSpec
+	var warnings []string
+	root := resolveExisting(workDir)
+	if info, err := os.Stat(filepath.Join(workDir, ".git")); err == nil && !info.IsDir() &&
+		slices.ContainsFunc(rels, func(rel string) bool { return strings.HasPrefix(rel, ".git/") }) {
+		rels = append(slices.Clone(rels), ".git")
+	}
+	for _, rel := range rels {
+		if strings.HasPrefix(rel, "../") || rel == ".." {
+			return nil, nil, fmt.Errorf("protected path %q is outside the workspace", rel)
+		}
+		if masked(masks, rel) {
+			continue
+		}
+		host := filepath.Join(workDir, filepath.FromSlash(rel))
+		if rel == ".git/hooks" {
+			if info, err := os.Stat(filepath.Join(workDir, ".git")); err == nil && info.IsDir() && !pathExists(host) {
+				if err := os.Mkdir(host, 0o755); err != nil {
+					return nil, nil, fmt.Errorf("create %s: %w", host, err)
+				}
+			}
+		}
+		if _, err := os.Lstat(host); err != nil {
+			continue
+		}
+		target, err := filepath.EvalSymlinks(host)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s is a dangling symlink; it is not mounted read-only", rel))
+			continue
+		}
+		if target != filepath.Join(root, filepath.FromSlash(rel)) {
+			// The bind would land wherever the link points inside the
+			// container, so protect the resolved target instead.
+			targetRel, err := filepath.Rel(root, target)
+			if err != nil || !pathWithin(target, root) {
+				warnings = append(warnings, fmt.Sprintf("%s is a symlink that leaves the workspace; it is not mounted read-only", rel))
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf("%s is a symlink; protecting its target %s instead", rel, filepath.ToSlash(targetRel)))
+			host, rel = target, filepath.ToSlash(targetRel)
+		}
+		if strings.ContainsAny(rel, ",:") {
+			return nil, nil, fmt.Errorf("cannot protect %q, which contains a comma or colon", rel)
+		}
+		if slices.ContainsFunc(mounts, func(m mountSpec) bool { return m.dst == "/app/"+rel }) {
+			continue
+		}
+		mounts = append(mounts, mountSpec{src: host, dst: "/app/" + rel, readOnly: true})
+	}
+	return mounts, warnings, nil
+}
+
+// masked reports whether rel is a masked path or lies under a masked
+// directory.
+func masked(masks []maskSpec, rel string) bool {
+	for _, m := range masks {
+		if rel == m.rel || m.dir && strings.HasPrefix(rel, m.rel+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestProtectedPathsAppliesProjectConfig(t *testing.T) {
+	got := protectedPaths(projectConfig{Protect: []string{".githooks/", ".git/config"}, Unprotect: []string{"./.envrc"}})
+	want := []string{".git/hooks", ".git/config", ".mise.toml", "mise.toml", ".githooks"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("protectedPaths = %v, want %v", got, want)
+	}
+}
+
+func TestProtectedMounts(t *testing.T) {
+	work := t.TempDir()
+	mustWriteFile(t, filepath.Join(work, ".git", "config"), "[core]\n")
+	mustWriteFile(t, filepath.Join(work, "tools", "envrc"), "export A=1\n")
+	if err := os.Symlink(filepath.Join("tools", "envrc"), filepath.Join(work, ".envrc")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(t.TempDir(), "mise.toml"), filepath.Join(work, "mise.toml")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	mounts, warnings, err := protectedMounts(work, protectedPaths(projectConfig{}), nil)
+	if err != nil {
+		t.Fatalf("protectedMounts: %v", err)
+	}
+	if !pathExists(filepath.Join(work, ".git", "hooks")) {
+		t.Fatal("expected .git/hooks to be created")
+	}
+	var dsts []string
+	for _, m := range mounts {
+		if !m.readOnly {
+			t.Fatalf("mount %s is not read-only", m.dst)
+		}
+		dsts = append(dsts, m.dst)
+	}
+	want := []string{"/app/.git/hooks", "/app/.git/config", "/app/tools/envrc"}
+	if !slices.Equal(dsts, want) {
+		t.Fatalf("mounts = %v, want %v", dsts, want)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], ".envrc is a symlink") || !strings.Contains(warnings[1], "mise.toml") {
+		t.Fatalf("warnings = %v", warnings)
+	}
+}
+
+func TestProtectedMountsProtectsGitFile(t *testing.T) {
+	work := t.TempDir()
+	mustWriteFile(t, filepath.Join(work, ".git"), "gitdir: ../main/.git/worktrees/feature\n")
+
+	mounts, _, err := protectedMounts(work, protectedPaths(projectConfig{}), nil)
+	if err != nil {
+		t.Fatalf("protectedMounts: %v", err)
+	}
+	want := []mountSpec{{src: filepath.Join(work, ".git"), dst: "/app/.git", readOnly: true}}
+	if !slices.Equal(mounts, want) {
+		t.Fatalf("mounts = %v, want %v", mounts, want)
+	}
+	if pathExists(filepath.Join(work, ".git", "hooks")) {
+		t.Fatal("did not expect hooks under a gitfile")
+	}
+
+	mounts, _, err = protectedMounts(work, protectedPaths(projectConfig{Unprotect: []string{".git/hooks", ".git/config"}}), nil)
+	if err != nil || len(mounts) != 0 {
+		t.Fatalf("unprotected git paths = %v, %v; want no mounts", mounts, err)
+	}
+}
+
+func TestProtectedMountsSkipsMaskedPaths(t *testing.T) {
+	work := t.TempDir()
+	mustWriteFile(t, filepath.Join(work, ".envrc"), "export A=1\n")
+	mounts, _, err := protectedMounts(work, []string{".envrc"}, []maskSpec{{rel: ".envrc"}})
+	if err != nil || len(mounts) != 0 {
+		t.Fatalf("protectedMounts = %v, %v; want no mounts", mounts, err)
+	}
+}
+
+func TestProtectedMountsRejectsPathsOutsideWorkspace(t *testing.T) {
+	if _, _, err := protectedMounts(t.TempDir(), []string{"../other"}, nil); err == nil {
+		t.Fatal("expected a path outside the workspace to be rejected")
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, errors.New("--record is not supported on " + runtime.GOOS)
+}
+
+func setPTYSize(f *os.File, cols, rows int) error {
+	return nil
+}
+
+func ptyProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+func notifyResize(ch chan<- os.Signal) {}
+
+func flushInput(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type pullPolicy string
+
+const (
+	pullAlways  pullPolicy = "always"
+	pullMissing pullPolicy = "missing"
+	pullNever   pullPolicy = "never"
+	pullDaily   pullPolicy = "daily"
+	pullWeekly  pullPolicy = "weekly"
+)
+
+func parsePullPolicy(value string) (pullPolicy, error) {
+	switch p := pullPolicy(strings.ToLower(strings.TrimSpace(value))); p {
+	case pullAlways, pullMissing, pullNever, pullDaily, pullWeekly:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid pull policy %q (want always, missing, never, daily or weekly)", value)
+	}
+}
+
+// resolvePullPolicy picks the policy for image. An explicit --pull wins, then
+// --no-pull, and otherwise dockerx images are always refreshed while other
+// images are only pulled when missing.
+func resolvePullPolicy(requested string, noPull bool, image string) (pullPolicy, error) {
+	if requested != "" {
+		return parsePullPolicy(requested)
+	}
+	if noPull {
+		return pullMissing, nil
+	}
+	if shouldAlwaysPull(image) {
+		return pullAlways, nil
+	}
+	return pullMissing, nil
+}
+
+// shouldPull decides whether the pull phase must fetch image. Digest
+// references are immutable, so they are only pulled when missing.
+func shouldPull(policy pullPolicy, image string, present bool, lastPull, now time.Time) bool {
+	if policy == pullNever {
+		return false
+	}
+	if !present {
+		return true
+	}
+	if strings.Contains(image, "@sha256:") {
+		return false
+	}
+	switch policy {
+	case pullAlways:
+		return true
+	case pullDaily:
+		return now.Sub(lastPull) >= 24*time.Hour
+	case pullWeekly:
+		return now.Sub(lastPull) >= 7*24*time.Hour
+	default:
+		return false
+	}
+}
+
+// ensureImage runs the pull phase before anything reads from the image, so
+// identity overlays and the container itself come from the same pull.
+func ensureImage(image string, policy pullPolicy, dryRun bool) error {
+	present := imageExists(image)
+	cachePath := pullCachePath()
+	cache := readPullCache(cachePath)
+	now := time.Now()
+
+	if !shouldPull(policy, image, present, cache[image], now) {
+		if policy == pullNever && !present {
+			return fmt.Errorf("image %s is not available locally and --pull=never is set", image)
+		}
+		return nil
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "dockerx: would pull %s (pull policy: %s, skipped in dry-run)\n", image, policy)
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "dockerx: pulling %s (pull policy: %s)\n", image, policy)
+	cmd := exec.Command("docker", "pull", image)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if present && (policy == pullDaily || policy == pullWeekly) {
+			fmt.Fprintf(os.Stderr, "warning: pull of %s failed, using local image: %v\n", image, err)
+			return nil
+		}
+		return fmt.Errorf("docker pull failed: %w", err)
+	}
+
+	cache[image] = now.UTC()
+	if err := writePullCache(cachePath, cache); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	return nil
+}
+
+func pullCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dockerx", "pulls.json")
+}
+
+func readPullCache(path string) map[string]time.Time {
+	cache := map[string]time.Time{}
+	if path == "" {
+		return cache
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(content, &cache); err != nil {
+		return map[string]time.Time{}
+	}
+	return cache
+}
+
+func writePullCache(path string, cache map[string]time.Time) error {
+	if path == "" {
+		return errors.New("pull cache: no user cache directory")
+	}
+	content, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode pull cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create pull cache dir: %w", err)
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write pull cache: %w", err)
+	}
+	return nil
+}
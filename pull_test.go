@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolvePullPolicy(t *testing.T) {
+	tests := []struct {
+		requested string
+		noPull    bool
+		image     string
+		want      pullPolicy
+	}{
+		{"", false, "wpkpda/dockerx:latest", pullAlways},
+		{"", false, "docker.io/wpkpda/dockerx", pullAlways},
+		{"", false, "repo/image:latest", pullMissing},
+		{"", true, "wpkpda/dockerx:latest", pullMissing},
+		{"weekly", true, "wpkpda/dockerx:latest", pullWeekly},
+		{"Daily", false, "repo/image:latest", pullDaily},
+		{"never", false, "wpkpda/dockerx:latest", pullNever},
+	}
+	for _, tt := range tests {
+		got, err := resolvePullPolicy(tt.requested, tt.noPull, tt.image)
+		if err != nil {
+			t.Fatalf("resolvePullPolicy(%q, %t, %q): %v", tt.requested, tt.noPull, tt.image, err)
+		}
+		if got != tt.want {
+			t.Fatalf("resolvePullPolicy(%q, %t, %q) = %q, want %q", tt.requested, tt.noPull, tt.image, got, tt.want)
+		}
+	}
+
+	if _, err := resolvePullPolicy("hourly", false, "repo/image"); err == nil {
+		t.Fatal("expected error for unknown policy")
+	}
+}
+
+func TestShouldPull(t *testing.T) {
+	now := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		policy   pullPolicy
+		image    string
+		present  bool
+		lastPull time.Time
+		want     bool
+	}{
+		{"never present", pullNever, "repo/image", true, time.Time{}, false},
+		{"never missing", pullNever, "repo/image", false, time.Time{}, false},
+		{"missing present", pullMissing, "repo/image", true, time.Time{}, false},
+		{"missing absent", pullMissing, "repo/image", false, time.Time{}, true},
+		{"always present", pullAlways, "repo/image", true, now, true},
+		{"always digest", pullAlways, "repo/image@sha256:abcd", true, time.Time{}, false},
+		{"always digest absent", pullAlways, "repo/image@sha256:abcd", false, time.Time{}, true},
+		{"daily fresh", pullDaily, "repo/image", true, now.Add(-23 * time.Hour), false},
+		{"daily stale", pullDaily, "repo/image", true, now.Add(-25 * time.Hour), true},
+		{"daily never pulled", pullDaily, "repo/image", true, time.Time{}, true},
+		{"weekly fresh", pullWeekly, "repo/image", true, now.Add(-6 * 24 * time.Hour), false},
+		{"weekly stale", pullWeekly, "repo/image", true, now.Add(-8 * 24 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		if got := shouldPull(tt.policy, tt.image, tt.present, tt.lastPull, now); got != tt.want {
+			t.Fatalf("%s: shouldPull = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPullCacheRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dockerx", "pulls.json")
+	if cache := readPullCache(path); len(cache) != 0 {
+		t.Fatalf("expected empty cache, got %v", cache)
+	}
+
+	when := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+	if err := writePullCache(path, map[string]time.Time{"wpkpda/dockerx:latest": when}); err != nil {
+		t.Fatalf("write cache: %v", err)
+	}
+	cache := readPullCache(path)
+	if !cache["wpkpda/dockerx:latest"].Equal(when) {
+		t.Fatalf("unexpected cache: %v", cache)
+	}
+}
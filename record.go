@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// recordFlag is --record, optionally with the file to write.
+type recordFlag struct {
+	enabled bool
+	path    string
+}
+
+func (f *recordFlag) String() string {
+	if f == nil || !f.enabled {
+		return ""
+	}
+	return f.path
+}
+
+func (f *recordFlag) Set(value string) error {
+	switch value {
+	case "true":
+		f.enabled, f.path = true, ""
+	case "false":
+		f.enabled, f.path = false, ""
+	default:
+		if strings.TrimSpace(value) == "" {
+			return errors.New("recording path cannot be empty")
+		}
+		f.enabled, f.path = true, value
+	}
+	return nil
+}
+
+func (f *recordFlag) IsBoolFlag() bool {
+	return true
+}
+
+// defaultRecordingPath names a recording after the project and start time,
+// next to the session log.
+func defaultRecordingPath(homeDir, workDir string, lookupEnv func(string) string, now time.Time) string {
+	dir := filepath.Join(filepath.Dir(auditLogPath(homeDir, lookupEnv)), "recordings")
+	return filepath.Join(dir, fmt.Sprintf("%s-%s.cast", filepath.Base(workDir), now.Format("20060102-150405")))
+}
+
+// castHeader is the first line of an asciicast v2 file.
+type castHeader struct {
+	Version       int               `json:"version"`
+	Width         int               `json:"width"`
+	Height        int               `json:"height"`
+	Timestamp     int64             `json:"timestamp,omitempty"`
+	IdleTimeLimit float64           `json:"idle_time_limit,omitempty"`
+	Command       string            `json:"command,omitempty"`
+	Title         string            `json:"title,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+}
+
+// castWriter writes asciicast v2 events, one JSON array per line, with the
+// time in seconds since the header.
+type castWriter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	now   func() time.Time
+	err   error
+}
+
+func newCastWriter(w io.Writer, header castHeader, now func() time.Time) (*castWriter, error) {
+	start := now()
+	header.Version = 2
+	header.Timestamp = start.Unix()
+	line, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("encode recording header: %w", err)
+	}
+	if _, err := w.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("write recording: %w", err)
+	}
+	return &castWriter{w: w, start: start, now: now}, nil
+}
+
+// event writes one event. The first write error is kept and later events
+// are dropped, so a full disk does not interrupt the session.
+func (c *castWriter) event(kind, data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	elapsed := strconv.FormatFloat(c.now().Sub(c.start).Seconds(), 'f', 6, 64)
+	text, _ := json.Marshal(data)
+	_, c.err = fmt.Fprintf(c.w, "[%s, %q, %s]\n", elapsed, kind, text)
+}
+
+// failed returns the first write error.
+func (c *castWriter) failed() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *castWriter) resize(cols, rows int) {
+	c.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// castStream records a byte stream as events of one kind. A UTF-8 sequence
+// split across reads is held back until it is complete, since the JSON
+// string would otherwise get replacement characters.
+type castStream struct {
+	cast    *castWriter
+	kind    string
+	pending []byte
+}
+
+func (s *castStream) Write(p []byte) (int, error) {
+	data := append(s.pending, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	if cut > 0 {
+		s.cast.event(s.kind, string(data[:cut]))
+	}
+	s.pending = append([]byte(nil), data[cut:]...)
+	return len(p), nil
+}
+
+func (s *castStream) flush() {
+	if len(s.pending) > 0 {
+		s.cast.event(s.kind, string(s.pending))
+		s.pending = nil
+	}
+}
+
+// recording is a session run on a pty that dockerx owns, so everything the
+// terminal shows passes through dockerx and can be written to a cast file.
+type recording struct {
+	path   string
+	input  bool
+	header castHeader
+}
+
+// run starts cmd on a new pty and proxies the host terminal to it, in raw
+// mode, until cmd exits.
+func (r recording) run(relay *signalRelay, cmd *exec.Cmd) error {
+	stdin, stdout := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	cols, rows, err := term.GetSize(stdout)
+	if err != nil {
+		return fmt.Errorf("--record: terminal size: %w", err)
+	}
+	master, slave, err := openPTY()
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+	defer slave.Close()
+	if err := setPTYSize(master, cols, rows); err != nil {
+		return fmt.Errorf("--record: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o700); err != nil {
+		return fmt.Errorf("create recording dir: %w", err)
+	}
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create recording: %w", err)
+	}
+	defer file.Close()
+	buf := bufio.NewWriter(file)
+	defer buf.Flush()
+	header := r.header
+	header.Width, header.Height = cols, rows
+	cast, err := newCastWriter(buf, header, time.Now)
+	if err != nil {
+		return err
+	}
+
+	state, err := term.MakeRaw(stdin)
+	if err != nil {
+		return fmt.Errorf("--record: raw mode: %w", err)
+	}
+	defer term.Restore(stdin, state)
+
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	defer func() {
+		signal.Stop(resized)
+		close(resized)
+	}()
+	go func() {
+		for range resized {
+			if cols, rows, err := term.GetSize(stdout); err == nil {
+				_ = setPTYSize(master, cols, rows)
+				cast.resize(cols, rows)
+			}
+		}
+	}()
+
+	// The copy from stdin cannot be interrupted; it ends on the first read
+	// after the session, which dockerx is about to exit for anyway.
+	gate := relay.gateInput()
+	go func() {
+		in := gate.reader(os.Stdin)
+		if r.input {
+			in = io.TeeReader(os.Stdin, &castStream{cast: cast, kind: "i"})
+		}
+		_, _ = io.Copy(master, in)
+	}()
+	output := &castStream{cast: cast, kind: "o"}
+	copied := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.MultiWriter(os.Stdout, output), master)
+		close(copied)
+	}()
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = ptyProcAttr()
+	runErr := relay.run(cmd)
+	// With the last slave closed, reads from master drain what is buffered
+	// and then fail, which ends the output copy.
+	slave.Close()
+	<-copied
+	output.flush()
+	if err := cast.failed(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: recording incomplete: %v\r\n", err)
+	}
+	return runErr
+}
+
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	speed := flags.Float64("speed", 1, "Playback speed multiplier")
+	idleLimit := flags.Duration("idle-limit", 0, "Shorten pauses longer than this (default: the recording's idle_time_limit, if any)")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: dockerx replay [--speed N] [--idle-limit D] <file.cast>")
+		return 2
+	}
+	if *speed <= 0 {
+		fmt.Fprintln(os.Stderr, "dockerx: replay: --speed must be positive")
+		return 2
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dockerx: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+	if err := replayCast(f, os.Stdout, *speed, *idleLimit, time.Sleep); err != nil {
+		fmt.Fprintf(os.Stderr, "dockerx: replay: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// replayCast writes the output events of an asciicast v2 recording to w,
+// sleeping between them as recorded. Input and resize events are skipped.
+func replayCast(r io.Reader, w io.Writer, speed float64, idleLimit time.Duration, sleep func(time.Duration)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return errors.New("empty recording")
+	}
+	var header castHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	if header.Version != 2 {
+		return fmt.Errorf("unsupported asciicast version %d", header.Version)
+	}
+	if idleLimit == 0 && header.IdleTimeLimit > 0 {
+		idleLimit = time.Duration(header.IdleTimeLimit * float64(time.Second))
+	}
+
+	var last float64
+	for n := 2; scanner.Scan(); n++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var event [3]any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		at, ok1 := event[0].(float64)
+		kind, ok2 := event[1].(string)
+		data, ok3 := event[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return fmt.Errorf("line %d: malformed event", n)
+		}
+		if kind != "o" {
+			continue
+		}
+		pause := time.Duration((at - last) * float64(time.Second))
+		last = at
+		if idleLimit > 0 && pause > idleLimit {
+			pause = idleLimit
+		}
+		if pause > 0 {
+			sleep(time.Duration(float64(pause) / speed))
+		}
+		if _, err := io.WriteString(w, data); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordFlag(t *testing.T) {
+	var rec recordFlag
+	flags := flag.NewFlagSet("dockerx", flag.ContinueOnError)
+	flags.Var(&rec, "record", "")
+	if err := flags.Parse([]string{"--record", "zsh"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !rec.enabled || rec.path != "" || !slices.Equal(flags.Args(), []string{"zsh"}) {
+		t.Fatalf("--record parsed as %+v, args %v", rec, flags.Args())
+	}
+	if err := flags.Parse([]string{"--record=out.cast"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !rec.enabled || rec.path != "out.cast" {
+		t.Fatalf("--record=out.cast parsed as %+v", rec)
+	}
+}
+
+func TestDefaultRecordingPath(t *testing.T) {
+	env := func(key string) string {
+		if key == "XDG_STATE_HOME" {
+			return "/state"
+		}
+		return ""
+	}
+	got := defaultRecordingPath("/home/me", "/src/app", env, time.Date(2026, 3, 1, 10, 4, 5, 0, time.UTC))
+	want := filepath.Join("/state", "dockerx", "recordings", "app-20260301-100405.cast")
+	if got != want {
+		t.Fatalf("defaultRecordingPath = %q, want %q", got, want)
+	}
+}
+
+func TestCastWriterWritesAsciicastV2(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	clock := start
+	now := func() time.Time { return clock }
+
+	var buf bytes.Buffer
+	cast, err := newCastWriter(&buf, castHeader{Width: 80, Height: 24, Command: "zsh"}, now)
+	if err != nil {
+		t.Fatalf("newCastWriter: %v", err)
+	}
+	out := &castStream{cast: cast, kind: "o"}
+	clock = start.Add(1500 * time.Millisecond)
+	// "é" split across two writes.
+	out.Write([]byte("caf\xc3"))
+	clock = start.Add(2 * time.Second)
+	out.Write([]byte("\xa9\r\n"))
+	cast.resize(100, 30)
+	out.flush()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected header and 3 events, got:\n%s", buf.String())
+	}
+	var header castHeader
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+		t.Fatalf("header: %v", err)
+	}
+	if header.Version != 2 || header.Width != 80 || header.Height != 24 || header.Timestamp != 1700000000 {
+		t.Fatalf("header = %+v", header)
+	}
+	for i, want := range []string{
+		`[1.500000, "o", "caf"]`,
+		`[2.000000, "o", "é\r\n"]`,
+		`[2.000000, "r", "100x30"]`,
+	} {
+		if lines[i+1] != want {
+			t.Fatalf("event %d = %s, want %s", i, lines[i+1], want)
+		}
+	}
+}
+
+func TestReplayCast(t *testing.T) {
+	cast := `{"version": 2, "width": 80, "height": 24, "idle_time_limit": 2}
+[0.5, "o", "hello "]
+[0.7, "i", "x"]
+[1.0, "r", "100x30"]
+[10.0, "o", "world\r\n"]
+`
+	var out bytes.Buffer
+	var pauses []time.Duration
+	sleep := func(d time.Duration) { pauses = append(pauses, d) }
+	if err := replayCast(strings.NewReader(cast), &out, 2, 0, sleep); err != nil {
+		t.Fatalf("replayCast: %v", err)
+	}
+	if out.String() != "hello world\r\n" {
+		t.Fatalf("output = %q", out.String())
+	}
+	want := []time.Duration{250 * time.Millisecond, time.Second}
+	if !slices.Equal(pauses, want) {
+		t.Fatalf("pauses = %v, want %v", pauses, want)
+	}
+
+	if err := replayCast(strings.NewReader(`{"version": 1}`), io.Discard, 1, 0, sleep); err == nil {
+		t.Fatal("expected version 1 to be rejected")
+	}
+}
+
+func TestOpenPTY(t *testing.T) {
+	master, slave, err := openPTY()
+	if err != nil {
+		t.Skipf("no pty: %v", err)
+	}
+	defer master.Close()
+	if err := setPTYSize(master, 123, 45); err != nil {
+		t.Fatalf("setPTYSize: %v", err)
+	}
+
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = ptyProcAttr()
+	if err := cmd.Start(); err != nil {
+		t.Skipf("stty: %v", err)
+	}
+	slave.Close()
+	out, _ := io.ReadAll(master)
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("stty: %v (%s)", err, out)
+	}
+	if !strings.Contains(string(out), "45 123") {
+		t.Fatalf("stty size = %q, want 45 123", out)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// reuseLabel carries the spec hash of a warm container. A container is
+	// only reused by a launch that resolves to the same hash.
+	reuseLabel = "dockerx.reuse"
+
+	defaultIdleTimeout = 30 * time.Minute
+
+	warmReadyFile  = "/tmp/.dockerx-ready"
+	warmConfigFile = "configs.stamp"
+)
+
+// idleKeeperScript keeps a warm container alive until no `docker exec`
+// process has run for the given number of seconds. Exec'd processes have
+// parent PID 0 inside the container, like PID 1 itself.
+const idleKeeperScript = `timeout=$1
+: > ` + warmReadyFile + `
+last=$(date +%s)
+while :; do
+  sleep 5
+  active=$(grep -l '^PPid:[[:space:]]*0$' /proc/[0-9]*/status 2>/dev/null | wc -l)
+  now=$(date +%s)
+  if [ "$active" -gt 1 ]; then
+    last=$now
+  elif [ $((now - last)) -ge "$timeout" ]; then
+    exit 0
+  fi
+done`
+
+// reuseSpec is everything that must match for a warm container to stand in
+// for a fresh one. Env values are passed per exec, so only the keys count.
+type reuseSpec struct {
+	Version      string        `json:"version"`
+	Image        string        `json:"image"`
+	Digest       string        `json:"digest"`
+	Mounts       []mountRecord `json:"mounts"`
+	ConfigMounts []mountRecord `json:"configMounts"`
+	EnvKeys      []string      `json:"envKeys"`
+	User         string        `json:"user"`
+	UsernsHost   bool          `json:"usernsHost"`
+	SELinux      bool          `json:"selinux"`
+	Writable     string        `json:"writableSystem"`
+	GitBridge    bool          `json:"gitBridge"`
+	Browser      bool          `json:"browser"`
+	DockerAccess string        `json:"dockerAccess"`
+	Tool         string        `json:"tool"`
+	ContainerEnv []string      `json:"containerEnv"`
+	Masked       []string      `json:"masked"`
+}
+
+func reuseSpecHash(plan launchPlan, digest string) string {
+	spec := reuseSpec{
+		Version:      version,
+		Image:        plan.image,
+		Digest:       digest,
+		Mounts:       mountRecords(append(append([]mountSpec{{src: plan.workDir, dst: "/app"}}, plan.protected...), plan.addDirs...)),
+		ConfigMounts: mountRecords(plan.configMounts),
+		EnvKeys:      plan.envKeys,
+		User:         plan.identity.user,
+		UsernsHost:   plan.identity.usernsHost,
+		SELinux:      plan.selinuxRelabel,
+		Writable:     plan.writableSystem,
+		GitBridge:    plan.gitCredentials != nil,
+		Browser:      plan.browser != nil,
+		Tool:         plan.tool,
+		ContainerEnv: plan.containerEnv,
+		Masked:       maskedPaths(plan.masks),
+	}
+	if plan.dockerAccess != nil {
+		spec.DockerAccess = plan.dockerAccess.mode
+	}
+	content, _ := json.Marshal(spec)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// warmStateDir holds files a warm container keeps using after the dockerx
+// that started it has exited, such as the identity overlays.
+func warmStateDir(specHash string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve cache dir: %w", err)
+	}
+	return filepath.Join(dir, "dockerx", "warm", specHash), nil
+}
+
+// findWarmContainer returns a running container with the given spec hash.
+// Containers started with a different spec are left to time out on their
+// own, since another terminal may still be using them.
+func findWarmContainer(specHash string) (string, error) {
+	out, err := exec.Command("docker", "ps", "-q", "--filter", "label="+reuseLabel+"="+specHash).Output()
+	if err != nil {
+		return "", fmt.Errorf("list warm containers: %w", err)
+	}
+	ids := splitLines(string(out))
+	if len(ids) == 0 {
+		return "", nil
+	}
+	return ids[0], nil
+}
+
+// warmPlan turns plan into a detached container that idles for idle before
+// exiting.
+func warmPlan(plan launchPlan, specHash string, idle time.Duration) launchPlan {
+	plan.detach = true
+	plan.labels = append(plan.labels, reuseLabel+"="+specHash)
+	seconds := int(idle / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	plan.command = []string{"sh", "-c", idleKeeperScript, "dockerx-idle", strconv.Itoa(seconds)}
+	return plan
+}
+
+// startWarmContainer starts the container and waits until the entrypoint
+// has copied the staged configs.
+func startWarmContainer(args []string, configMounts []mountSpec, stateDir string) (string, error) {
+	out, err := exec.Command("docker", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("start warm container: %w", err)
+	}
+	id := strings.TrimSpace(string(out))
+
+	deadline := time.Now().Add(30 * time.Second)
+	for exec.Command("docker", "exec", id, "test", "-e", warmReadyFile).Run() != nil {
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("warm container %s did not become ready", id)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	writeConfigStamp(stateDir, configFingerprint(configMounts))
+	return id, nil
+}
+
+// refreshWarmConfigs re-runs the entrypoint's config copy when a host config
+// source changed since the container last copied it.
+func refreshWarmConfigs(id, user string, configMounts []mountSpec, stateDir string) error {
+	fingerprint := configFingerprint(configMounts)
+	if fingerprint == readConfigStamp(stateDir) {
+		return nil
+	}
+	args := []string{"exec", "--env", "DOCKERX_CONFIG_REFRESH=1"}
+	if user != "" {
+		args = append(args, "--user", user)
+	}
+	args = append(args, id, "/usr/local/bin/entrypoint.sh")
+	if out, err := exec.Command("docker", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("refresh configs: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	writeConfigStamp(stateDir, fingerprint)
+	return nil
+}
+
+// configFingerprint summarizes the paths, sizes and mtimes under each config
+// source, so edits, additions and deletions all change it.
+func configFingerprint(mounts []mountSpec) string {
+	h := sha256.New()
+	for _, m := range mounts {
+		_ = filepath.WalkDir(m.src, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			fmt.Fprintf(h, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+			return nil
+		})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func readConfigStamp(stateDir string) string {
+	content, err := os.ReadFile(filepath.Join(stateDir, warmConfigFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+func writeConfigStamp(stateDir, fingerprint string) {
+	if err := os.MkdirAll(stateDir, 0o700); err != nil {
+		return
+	}
+	_ = os.WriteFile(filepath.Join(stateDir, warmConfigFile), []byte(fingerprint+"\n"), 0o600)
+}
+
+// sweepWarmState removes state for spec hashes without a running container.
+func sweepWarmState(root string, running func() ([]string, error)) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read warm state: %w", err)
+	}
+	hashes, err := running()
+	if err != nil {
+		return nil, err
+	}
+	live := map[string]bool{}
+	for _, hash := range hashes {
+		live[hash] = true
+	}
+
+	var removed []string
+	for _, entry := range entries {
+		if !entry.IsDir() || live[entry.Name()] {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, fmt.Errorf("remove warm state %s: %w", dir, err)
+		}
+		removed = append(removed, dir)
+	}
+	return removed, nil
+}
+
+func runningWarmSpecs() ([]string, error) {
+	out, err := exec.Command("docker", "ps", "--filter", "label="+reuseLabel, "--format", `{{.Label "`+reuseLabel+`"}}`).Output()
+	if err != nil {
+		return nil, fmt.Errorf("list warm containers: %w", err)
+	}
+	return splitLines(string(out)), nil
+}
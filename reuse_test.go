@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func reuseFixture() launchPlan {
+	plan := fixturePlan("/home/me/app")
+	plan.addDirs = []mountSpec{{src: "/home/me/proto", dst: "/workspaces/proto"}}
+	return plan
+}
+
+func TestReuseSpecHash(t *testing.T) {
+	base := reuseFixture()
+	hash := reuseSpecHash(base, "sha256:aaa")
+	if hash != reuseSpecHash(reuseFixture(), "sha256:aaa") {
+		t.Fatal("expected the same spec to hash the same")
+	}
+
+	command := reuseFixture()
+	command.command = []string{"codex"}
+	if reuseSpecHash(command, "sha256:aaa") != hash {
+		t.Fatal("the command runs per exec and must not change the spec")
+	}
+
+	for name, change := range map[string]func(*launchPlan) (string, bool){
+		"digest":   func(p *launchPlan) (string, bool) { return "sha256:bbb", true },
+		"image":    func(p *launchPlan) (string, bool) { p.image = "other:latest"; return "", false },
+		"workdir":  func(p *launchPlan) (string, bool) { p.workDir = "/home/me/other"; return "", false },
+		"add dirs": func(p *launchPlan) (string, bool) { p.addDirs[0].readOnly = true; return "", false },
+		"config":   func(p *launchPlan) (string, bool) { p.configMounts = nil; return "", false },
+		"env keys": func(p *launchPlan) (string, bool) { p.envKeys = []string{"TERM"}; return "", false },
+		"user":     func(p *launchPlan) (string, bool) { p.identity.user = "0:0"; return "", false },
+		"selinux":  func(p *launchPlan) (string, bool) { p.selinuxRelabel = true; return "", false },
+	} {
+		plan := reuseFixture()
+		digest := "sha256:aaa"
+		if d, ok := change(&plan); ok {
+			digest = d
+		}
+		if reuseSpecHash(plan, digest) == hash {
+			t.Fatalf("changing %s should change the spec hash", name)
+		}
+	}
+}
+
+func TestWarmPlanArgs(t *testing.T) {
+	args, err := buildDockerArgs(warmPlan(reuseFixture(), "abc123", 90*time.Second))
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if args[2] != "-d" || slices.Contains(args, "-i") || slices.Contains(args, "-t") {
+		t.Fatalf("expected a detached container without stdio: %v", args)
+	}
+	if !containsPair(args, "--label", reuseLabel+"=abc123") || !containsPair(args, "--label", projectLabel+"=/home/me/app") {
+		t.Fatalf("missing labels in %v", args)
+	}
+	tail := args[len(args)-5:]
+	if !slices.Equal(tail, []string{"sh", "-c", idleKeeperScript, "dockerx-idle", "90"}) {
+		t.Fatalf("unexpected keeper command %q", tail)
+	}
+}
+
+func TestConfigFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	codex := filepath.Join(dir, ".codex")
+	mustWriteFile(t, filepath.Join(codex, "auth.json"), "{}")
+	mustWriteFile(t, filepath.Join(codex, "config.toml"), "model = 'x'")
+	mounts := []mountSpec{{src: codex}, {src: filepath.Join(dir, "missing")}}
+
+	before := configFingerprint(mounts)
+	if before != configFingerprint(mounts) {
+		t.Fatal("fingerprint should be stable")
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(codex, "auth.json"), later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	touched := configFingerprint(mounts)
+	if touched == before {
+		t.Fatal("an mtime change should change the fingerprint")
+	}
+
+	if err := os.Remove(filepath.Join(codex, "config.toml")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if configFingerprint(mounts) == touched {
+		t.Fatal("a deletion should change the fingerprint")
+	}
+}
+
+func TestConfigStampRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "warm", "abc")
+	if readConfigStamp(dir) != "" {
+		t.Fatal("expected no stamp yet")
+	}
+	writeConfigStamp(dir, "fingerprint")
+	if got := readConfigStamp(dir); got != "fingerprint" {
+		t.Fatalf("readConfigStamp = %q", got)
+	}
+}
+
+func TestSweepWarmState(t *testing.T) {
+	root := t.TempDir()
+	mustMkdirAll(t, filepath.Join(root, "live", "identity"))
+	mustMkdirAll(t, filepath.Join(root, "gone", "identity"))
+
+	removed, err := sweepWarmState(root, func() ([]string, error) { return []string{"live"}, nil })
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if !slices.Equal(removed, []string{filepath.Join(root, "gone")}) {
+		t.Fatalf("removed %v", removed)
+	}
+	if !pathExists(filepath.Join(root, "live")) {
+		t.Fatal("state for a running container was removed")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// defaultRiskyPaths are workspace files that the host runs or trusts outside
+// the container: build files, package scripts, editor tasks, CI workflows,
+// direnv and mise files and git hooks. Directories are watched recursively.
+var defaultRiskyPaths = []string{
+	"Makefile",
+	"GNUmakefile",
+	"makefile",
+	"package.json",
+	".vscode/tasks.json",
+	".vscode/launch.json",
+	".vscode/settings.json",
+	".github/workflows",
+	".envrc",
+	".mise.toml",
+	"mise.toml",
+	".husky",
+	".pre-commit-config.yaml",
+	".git/hooks",
+	".git/config",
+}
+
+const (
+	riskyAdded    = "added"
+	riskyModified = "modified"
+	riskyRemoved  = "removed"
+)
+
+// riskyChange is a watched file the session added, modified or removed.
+type riskyChange struct {
+	Path   string `json:"path"`
+	Change string `json:"change"`
+}
+
+// riskyPaths merges the defaults with the watch and unwatch lists of the
+// config and of the project.
+func riskyPaths(cfg userConfig, project projectConfig) []string {
+	add := append(append([]string{}, cfg.Watch...), project.Watch...)
+	remove := append(append([]string{}, cfg.Unwatch...), project.Unwatch...)
+	return mergeWorkspacePaths(defaultRiskyPaths, add, remove)
+}
+
+// workspaceSnapshot maps the slash-separated path of each watched file to a
+// hash of its content.
+type workspaceSnapshot map[string]string
+
+// snapshotWorkspace hashes the watched files under workDir. Missing paths are
+// skipped, so a file that appears later is reported as added.
+func snapshotWorkspace(workDir string, rels []string) workspaceSnapshot {
+	snap := workspaceSnapshot{}
+	for _, rel := range rels {
+		root := filepath.Join(workDir, filepath.FromSlash(rel))
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			name, err := filepath.Rel(workDir, path)
+			if err != nil {
+				return nil
+			}
+			if sum, ok := hashWatched(path, d); ok {
+				snap[filepath.ToSlash(name)] = sum
+			}
+			return nil
+		})
+	}
+	return snap
+}
+
+// hashWatched hashes a symlink by its target and a regular file by its
+// content. Only the scripts of a package.json run on the host, so dependency
+// bumps there are not reported.
+func hashWatched(path string, d fs.DirEntry) (string, bool) {
+	var content []byte
+	switch {
+	case d.Type()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", false
+		}
+		content = []byte("symlink:" + target)
+	case d.Type().IsRegular():
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false
+		}
+		content = data
+		if d.Name() == "package.json" {
+			var pkg struct {
+				Scripts map[string]string `json:"scripts"`
+			}
+			if json.Unmarshal(data, &pkg) == nil {
+				// Marshal sorts map keys, so reformatting does not count.
+				content, _ = json.Marshal(pkg.Scripts)
+			}
+		}
+	default:
+		return "", false
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// compareSnapshots lists what changed between two snapshots, sorted by path.
+func compareSnapshots(before, after workspaceSnapshot) []riskyChange {
+	var changes []riskyChange
+	for path, sum := range after {
+		switch prev, ok := before[path]; {
+		case !ok:
+			changes = append(changes, riskyChange{Path: path, Change: riskyAdded})
+		case prev != sum:
+			changes = append(changes, riskyChange{Path: path, Change: riskyModified})
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, riskyChange{Path: path, Change: riskyRemoved})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// writeRiskyReport prints the changes after a session, in bold yellow when
+// color is set.
+func writeRiskyReport(w io.Writer, changes []riskyChange, color bool) {
+	if len(changes) == 0 {
+		return
+	}
+	start, end := "", ""
+	if color {
+		start, end = "\x1b[1;33m", "\x1b[0m"
+	}
+	fmt.Fprintf(w, "%sdockerx: this session changed files that run on the host:%s\n", start, end)
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s  %-8s  %s%s\n", start, c.Change, c.Path, end)
+	}
+	fmt.Fprintln(w, "Review them before running make, npm, git or your editor's tasks here.")
+}
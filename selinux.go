@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	selinuxAuto    = "auto"
+	selinuxOff     = "off"
+	selinuxRelabel = "relabel"
+
+	selinuxEnforcePath = "/sys/fs/selinux/enforce"
+
+	// selinuxShared lets several containers use the mount, which suits the
+	// workspace. selinuxPrivate restricts it to this container, so it is only
+	// used on files dockerx created for the session. selinuxNone mounts the
+	// source without relabeling it.
+	selinuxShared  = "z"
+	selinuxPrivate = "Z"
+	selinuxNone    = ""
+)
+
+func validateSELinuxMode(mode string) error {
+	switch mode {
+	case "", selinuxAuto, selinuxOff, selinuxRelabel:
+		return nil
+	default:
+		return fmt.Errorf("invalid --selinux %q (want auto, off or relabel)", mode)
+	}
+}
+
+// selinuxEnforcing probes whether SELinux is enforcing. readFile is
+// os.ReadFile outside tests; a missing file means SELinux is not enabled.
+func selinuxEnforcing(readFile func(string) ([]byte, error)) bool {
+	content, err := readFile(selinuxEnforcePath)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(content)) == "1"
+}
+
+// resolveSELinuxRelabel decides whether bind mounts are relabeled. In auto
+// mode that only happens when SELinux is enforcing; in permissive mode the
+// mounts are readable without it.
+func resolveSELinuxRelabel(mode string, readFile func(string) ([]byte, error)) bool {
+	switch mode {
+	case selinuxRelabel:
+		return true
+	case selinuxOff:
+		return false
+	default:
+		return selinuxEnforcing(readFile)
+	}
+}
+
+// systemDirWarning explains why relabeling the workspace is dangerous when it
+// is a system directory or a whole home directory. Relabeling changes the
+// labels on the host, so host services may lose access to those files.
+func systemDirWarning(plan launchPlan) string {
+	if !plan.selinuxRelabel || !isSystemDir(plan.workDir) {
+		return ""
+	}
+	return fmt.Sprintf("workspace %s is a system directory; relabeling it for SELinux changes its labels on the host (use --selinux=off or run from a project directory)", plan.workDir)
+}
+
+func isSystemDir(path string) bool {
+	path = filepath.Clean(path)
+	switch path {
+	case "/", "/bin", "/boot", "/dev", "/etc", "/home", "/lib", "/lib64", "/media", "/mnt",
+		"/opt", "/proc", "/root", "/run", "/sbin", "/srv", "/sys", "/tmp", "/usr", "/var":
+		return true
+	}
+	for _, root := range []string{"/boot", "/dev", "/etc", "/proc", "/sys", "/usr"} {
+		if pathWithin(path, root) {
+			return true
+		}
+	}
+	// A user's entire home directory holds files such as ~/.ssh that host
+	// services read with their own labels.
+	return filepath.Dir(path) == "/home"
+}
+
+// stageConfigMounts copies each config source to dir/<index>. Relabeling
+// ~/.ssh and the like in place would change labels that host services such as
+// sshd rely on, so under SELinux the container gets copies instead. A stage
+// that already exists is refreshed in place, since a warm container has its
+// entries mounted.
+func stageConfigMounts(mounts []mountSpec, dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create config stage: %w", err)
+	}
+	for i, m := range mounts {
+		if err := copyConfig(m.src, filepath.Join(dir, strconv.Itoa(i))); err != nil {
+			return fmt.Errorf("stage %s: %w", m.src, err)
+		}
+	}
+	return nil
+}
+
+// copyConfig copies a file or directory tree. Symlinks are copied as links
+// and sockets and other special files are skipped, as the entrypoint would.
+func copyConfig(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return copyConfigFile(src, dst, info.Mode().Perm())
+	}
+	if err := os.MkdirAll(dst, 0o700); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, 0o700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return copyConfigFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyConfigFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func fakeEnforce(content string) func(string) ([]byte, error) {
+	return func(path string) ([]byte, error) {
+		if path != selinuxEnforcePath {
+			return nil, fs.ErrNotExist
+		}
+		if content == "" {
+			return nil, fs.ErrNotExist
+		}
+		return []byte(content), nil
+	}
+}
+
+func TestResolveSELinuxRelabel(t *testing.T) {
+	for _, tt := range []struct {
+		mode    string
+		enforce string
+		want    bool
+	}{
+		{selinuxAuto, "1\n", true},
+		{selinuxAuto, "0\n", false},
+		{selinuxAuto, "", false},
+		{"", "1", true},
+		{selinuxOff, "1\n", false},
+		{selinuxRelabel, "", true},
+	} {
+		if got := resolveSELinuxRelabel(tt.mode, fakeEnforce(tt.enforce)); got != tt.want {
+			t.Fatalf("resolveSELinuxRelabel(%q, enforce=%q) = %v, want %v", tt.mode, tt.enforce, got, tt.want)
+		}
+	}
+	if resolveSELinuxRelabel(selinuxAuto, func(string) ([]byte, error) { return nil, errors.New("permission denied") }) {
+		t.Fatal("an unreadable probe should not enable relabeling")
+	}
+}
+
+func TestValidateSELinuxMode(t *testing.T) {
+	for _, mode := range []string{"", selinuxAuto, selinuxOff, selinuxRelabel} {
+		if err := validateSELinuxMode(mode); err != nil {
+			t.Fatalf("validateSELinuxMode(%q): %v", mode, err)
+		}
+	}
+	if err := validateSELinuxMode("enforcing"); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+}
+
+func TestBuildDockerArgsRelabelsMounts(t *testing.T) {
+	plan := launchPlan{
+		image:          "repo/image:latest",
+		workDir:        "/home/me/repo",
+		command:        []string{"zsh"},
+		configMounts:   []mountSpec{{src: "/home/me/.codex", dst: containerHome + "/.codex", readOnly: true}},
+		identityMounts: []mountSpec{{src: "/run/user/1000/dockerx/session-1/identity/passwd", dst: "/etc/passwd", readOnly: true}},
+		selinuxRelabel: true,
+	}
+	args, err := buildDockerArgs(plan)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	for _, want := range []string{
+		"/home/me/repo:/app:z",
+		"/run/user/1000/dockerx/session-1/identity/passwd:/etc/passwd:ro,Z",
+	} {
+		if !containsPair(args, "--volume", want) {
+			t.Fatalf("missing --volume %s in %v", want, args)
+		}
+	}
+	if !containsPair(args, "--mount", "type=bind,src=/home/me/.codex,dst="+configStageRoot+"/0,readonly") || containsSubstring(args, "/home/me/.codex:") {
+		t.Fatalf("config source in the home directory should not be relabeled: %v", args)
+	}
+
+	plan.configStage = "/run/user/1000/dockerx/session-1/config"
+	args, err = buildDockerArgs(plan)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if !containsPair(args, "--volume", plan.configStage+"/0:"+configStageRoot+"/0:ro,Z") || containsSubstring(args, "/home/me/.codex") {
+		t.Fatalf("expected the staged copy to be mounted instead: %v", args)
+	}
+
+	plan.workDir = "/home/me/a:b"
+	if _, err := buildDockerArgs(plan); err == nil {
+		t.Fatal("expected a colon in a relabeled source to be rejected")
+	}
+}
+
+func TestSystemDirWarning(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/":              true,
+		"/usr":           true,
+		"/usr/local/src": true,
+		"/etc/nginx":     true,
+		"/home":          true,
+		"/home/me":       true,
+		"/root":          true,
+		"/home/me/repo":  false,
+		"/srv/app":       false,
+		"/var/www/site":  false,
+	} {
+		plan := launchPlan{workDir: path, selinuxRelabel: true}
+		if got := systemDirWarning(plan) != ""; got != want {
+			t.Fatalf("systemDirWarning(%q) = %v, want %v", path, got, want)
+		}
+	}
+	if systemDirWarning(launchPlan{workDir: "/usr"}) != "" {
+		t.Fatal("did not expect a warning without relabeling")
+	}
+}
+
+func TestWritePlanShowsSystemDirWarning(t *testing.T) {
+	plan := launchPlan{image: "repo/image:latest", workDir: "/etc", command: []string{"zsh"}, selinuxRelabel: true}
+
+	var text bytes.Buffer
+	if err := writePlan(&text, planFormatText, plan, nil); err != nil {
+		t.Fatalf("write text plan: %v", err)
+	}
+	if !strings.Contains(text.String(), "Warning: workspace /etc is a system directory") {
+		t.Fatalf("text plan missing warning:\n%s", text.String())
+	}
+
+	var out bytes.Buffer
+	if err := writePlan(&out, planFormatJSON, plan, nil); err != nil {
+		t.Fatalf("write json plan: %v", err)
+	}
+	var rec planRecord
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil {
+		t.Fatalf("decode plan: %v", err)
+	}
+	if rec.SELinux != selinuxRelabel || len(rec.Warnings) != 1 {
+		t.Fatalf("unexpected json plan: %+v", rec)
+	}
+}
+
+func TestStageConfigMounts(t *testing.T) {
+	home := t.TempDir()
+	ssh := filepath.Join(home, ".ssh")
+	mustWriteFile(t, filepath.Join(ssh, "id_ed25519"), "key\n")
+	mustWriteFile(t, filepath.Join(ssh, "conf.d", "work"), "Host work\n")
+	if err := os.Symlink("id_ed25519", filepath.Join(ssh, "default")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(ssh, "id_ed25519"), 0o600); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	gitconfig := filepath.Join(home, ".gitconfig")
+	mustWriteFile(t, gitconfig, "[user]\n")
+	mounts := []mountSpec{{src: ssh, dst: containerHome + "/.ssh"}, {src: gitconfig, dst: containerHome + "/.gitconfig"}}
+
+	dir := filepath.Join(t.TempDir(), "config")
+	if err := stageConfigMounts(mounts, dir); err != nil {
+		t.Fatalf("stageConfigMounts: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "0", "id_ed25519"))
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("staged key: %v, %v", info, err)
+	}
+	if link, err := os.Readlink(filepath.Join(dir, "0", "default")); err != nil || link != "id_ed25519" {
+		t.Fatalf("staged symlink = %q, %v", link, err)
+	}
+	staged, err := os.Stat(filepath.Join(dir, "0"))
+	if err != nil {
+		t.Fatalf("stat stage: %v", err)
+	}
+
+	// A refresh keeps the mounted entries and mirrors removals.
+	if err := os.RemoveAll(filepath.Join(ssh, "conf.d")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	mustWriteFile(t, gitconfig, "[user]\n\tname = me\n")
+	if err := stageConfigMounts(mounts, dir); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if again, err := os.Stat(filepath.Join(dir, "0")); err != nil || !os.SameFile(staged, again) {
+		t.Fatal("refresh replaced the staged directory")
+	}
+	if pathExists(filepath.Join(dir, "0", "conf.d")) {
+		t.Fatal("removed config still staged")
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "1")); string(content) != "[user]\n\tname = me\n" {
+		t.Fatalf("staged gitconfig = %q", content)
+	}
+}
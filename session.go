@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sessionDirPrefix = "session-"
+	sessionOwnerFile = "owner.pid"
+)
+
+// sessionRoot returns the directory holding per-session state such as the
+// identity overlays. It lives under XDG_RUNTIME_DIR when set, which the
+// system clears on logout, and falls back to a per-user directory in the
+// system temp dir.
+func sessionRoot(lookupEnv func(string) string) string {
+	if dir := lookupEnv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "dockerx")
+	}
+	name := "dockerx"
+	if uid := os.Getuid(); uid >= 0 {
+		name += "-" + strconv.Itoa(uid)
+	}
+	return filepath.Join(os.TempDir(), name)
+}
+
+// ensureSessionRoot creates root as a private directory. In a shared temp dir
+// the path may already exist, so it must not be a symlink and must be ours to
+// chmod.
+func ensureSessionRoot(root string) error {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return fmt.Errorf("create session root: %w", err)
+	}
+	info, err := os.Lstat(root)
+	if err != nil {
+		return fmt.Errorf("stat session root: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("session root %s is not a directory", root)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		if err := os.Chmod(root, 0o700); err != nil {
+			return fmt.Errorf("restrict session root: %w", err)
+		}
+	}
+	return nil
+}
+
+// createSessionDir creates a state directory for this process under root and
+// records the owning PID in it. The owner file stays locked until cleanup, so
+// a later sweep can tell whether the session is still running even after the
+// PID has been reused. The returned cleanup releases the lock and removes the
+// directory.
+func createSessionDir(root string) (string, func(), error) {
+	if err := ensureSessionRoot(root); err != nil {
+		return "", nil, err
+	}
+	dir, err := os.MkdirTemp(root, sessionDirPrefix)
+	if err != nil {
+		return "", nil, fmt.Errorf("create session dir: %w", err)
+	}
+	owner, err := os.OpenFile(filepath.Join(dir, sessionOwnerFile), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("write session owner: %w", err)
+	}
+	cleanup := func() {
+		owner.Close()
+		_ = os.RemoveAll(dir)
+	}
+	// Lock before writing the PID, so a sweep never sees a complete owner
+	// file that is not locked yet.
+	locked, err := tryLockFile(owner)
+	if err == nil && !locked {
+		err = errors.New("held by another process")
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("lock session owner: %w", err)
+	}
+	if _, err := owner.WriteString(strconv.Itoa(os.Getpid()) + "\n"); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("write session owner: %w", err)
+	}
+	return dir, cleanup, nil
+}
+
+// sweepStaleSessions removes session directories under root whose owning
+// process has exited, for example after a SIGKILL or a crash. A directory is
+// only removed when its owner file can be locked, which its owner prevents
+// while it runs, and its PID is not running either. A directory without an
+// owner file is only removed once it is older than a minute, since its
+// creator may still be writing it.
+func sweepStaleSessions(root string, alive func(pid int) bool) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read session root: %w", err)
+	}
+
+	var removed []string
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), sessionDirPrefix) {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		if !sessionIsStale(dir, alive) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, fmt.Errorf("remove stale session %s: %w", dir, err)
+		}
+		removed = append(removed, dir)
+	}
+	return removed, nil
+}
+
+func sessionIsStale(dir string, alive func(pid int) bool) bool {
+	owner, err := os.Open(filepath.Join(dir, sessionOwnerFile))
+	if err != nil {
+		info, statErr := os.Stat(dir)
+		return statErr == nil && time.Since(info.ModTime()) > time.Minute
+	}
+	defer owner.Close()
+	if locked, _ := tryLockFile(owner); !locked {
+		return false
+	}
+	content, err := io.ReadAll(owner)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || pid <= 0 {
+		return true
+	}
+	return !alive(pid)
+}
+
+func runPrune(args []string) int {
+	flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+	temp := flags.Bool("temp", false, "Remove session state left behind by dockerx processes that are no longer running")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if !*temp {
+		fmt.Fprintln(os.Stderr, "dockerx: prune: nothing selected (use --temp)")
+		return 2
+	}
+
+	if err := pruneTemp(os.Stdout, sessionRoot(getenv)); err != nil {
+		fmt.Fprintf(os.Stderr, "dockerx: %v\n", err)
+		return 1
+	}
+	if cache, err := os.UserCacheDir(); err == nil {
+		removed, err := sweepWarmState(filepath.Join(cache, "dockerx", "warm"), runningWarmSpecs)
+		for _, dir := range removed {
+			fmt.Printf("removed %s\n", dir)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dockerx: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+func pruneTemp(w io.Writer, root string) error {
+	removed, err := sweepStaleSessions(root, processAlive)
+	for _, dir := range removed {
+		fmt.Fprintf(w, "removed %s\n", dir)
+	}
+	if err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		fmt.Fprintln(w, "no stale session state")
+	}
+	return nil
+}
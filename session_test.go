@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionRootPrefersRuntimeDir(t *testing.T) {
+	env := map[string]string{"XDG_RUNTIME_DIR": "/run/user/1000"}
+	if got, want := sessionRoot(func(k string) string { return env[k] }), filepath.Join("/run/user/1000", "dockerx"); got != want {
+		t.Fatalf("sessionRoot = %q, want %q", got, want)
+	}
+	got := sessionRoot(func(string) string { return "" })
+	if filepath.Dir(got) != filepath.Clean(os.TempDir()) || !strings.HasPrefix(filepath.Base(got), "dockerx") {
+		t.Fatalf("unexpected fallback session root %q", got)
+	}
+}
+
+func TestCreateSessionDirRecordsOwner(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "dockerx")
+	dir, cleanup, err := createSessionDir(root)
+	if err != nil {
+		t.Fatalf("create session dir: %v", err)
+	}
+	if filepath.Dir(dir) != root {
+		t.Fatalf("session dir %q not under %q", dir, root)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, sessionOwnerFile))
+	if err != nil {
+		t.Fatalf("read owner: %v", err)
+	}
+	if strings.TrimSpace(string(content)) != strconv.Itoa(os.Getpid()) {
+		t.Fatalf("owner file = %q, want pid %d", content, os.Getpid())
+	}
+
+	cleanup()
+	if pathExists(dir) {
+		t.Fatal("expected cleanup to remove the session dir")
+	}
+}
+
+func TestSweepStaleSessions(t *testing.T) {
+	root := t.TempDir()
+	makeSession := func(name, owner string) string {
+		dir := filepath.Join(root, name)
+		mustMkdirAll(t, filepath.Join(dir, "identity"))
+		if owner != "" {
+			mustWriteFile(t, filepath.Join(dir, sessionOwnerFile), owner)
+		}
+		return dir
+	}
+	live := makeSession(sessionDirPrefix+"live", "100\n")
+	dead := makeSession(sessionDirPrefix+"dead", "200\n")
+	garbled := makeSession(sessionDirPrefix+"garbled", "not a pid")
+	fresh := makeSession(sessionDirPrefix+"fresh", "")
+	old := makeSession(sessionDirPrefix+"old", "")
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	other := makeSession("unrelated", "200\n")
+
+	removed, err := sweepStaleSessions(root, func(pid int) bool { return pid == 100 })
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	slices.Sort(removed)
+	want := []string{dead, garbled, old}
+	slices.Sort(want)
+	if !slices.Equal(removed, want) {
+		t.Fatalf("removed %v, want %v", removed, want)
+	}
+	for _, dir := range []string{live, fresh, other} {
+		if !pathExists(dir) {
+			t.Fatalf("expected %s to be kept", dir)
+		}
+	}
+}
+
+func TestSweepStaleSessionsKeepsCurrentProcess(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "dockerx")
+	dir, cleanup, err := createSessionDir(root)
+	if err != nil {
+		t.Fatalf("create session dir: %v", err)
+	}
+	defer cleanup()
+
+	var out bytes.Buffer
+	if err := pruneTemp(&out, root); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if !pathExists(dir) {
+		t.Fatal("prune removed the session of a running process")
+	}
+	if !strings.Contains(out.String(), "no stale session state") {
+		t.Fatalf("unexpected prune output %q", out.String())
+	}
+}
+
+func TestSweepStaleSessionsKeepsLockedOwner(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "dockerx")
+	dir, cleanup, err := createSessionDir(root)
+	if err != nil {
+		t.Fatalf("create session dir: %v", err)
+	}
+	defer cleanup()
+
+	// Even when the recorded PID looks dead, as after PID reuse in another
+	// namespace, the owner's lock keeps the directory.
+	removed, err := sweepStaleSessions(root, func(int) bool { return false })
+	if err != nil || len(removed) != 0 || !pathExists(dir) {
+		t.Fatalf("sweep removed a locked session: %v, %v", removed, err)
+	}
+
+	cleanup()
+	mustMkdirAll(t, dir)
+	mustWriteFile(t, filepath.Join(dir, sessionOwnerFile), "1\n")
+	removed, err = sweepStaleSessions(root, func(int) bool { return false })
+	if err != nil || !slices.Equal(removed, []string{dir}) {
+		t.Fatalf("sweep of an unlocked session = %v, %v", removed, err)
+	}
+}
+
+func TestSweepStaleSessionsMissingRoot(t *testing.T) {
+	removed, err := sweepStaleSessions(filepath.Join(t.TempDir(), "missing"), processAlive)
+	if err != nil || len(removed) != 0 {
+		t.Fatalf("sweep missing root = %v, %v", removed, err)
+	}
+}
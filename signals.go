@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// exitStatusError carries the container's exit status up to main so dockerx
+// exits with exactly the same code.
+type exitStatusError struct {
+	code int
+}
+
+func (e exitStatusError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// signalRelay forwards signals received by dockerx to the docker CLI. Signals
+// that arrive before docker has started are remembered so the launch can be
+// abandoned with the usual cleanup instead of being killed mid-setup.
+type signalRelay struct {
+	ch      chan os.Signal
+	done    chan struct{}
+	mu      sync.Mutex
+	proc    *os.Process
+	pending os.Signal
+	skip    map[os.Signal]bool
+	isolate bool
+	// input is set while a recorded session copies the terminal to docker.
+	input *inputGate
+	// deliver, when set, delivers terminating signals in place of docker,
+	// which does not pass them on for docker exec.
+	deliver func(os.Signal)
+}
+
+// startSignalRelay starts relaying forwardedSignals. Signals in skip are
+// still caught, so they do not kill dockerx, but are not forwarded because
+// docker receives them directly from the terminal.
+func startSignalRelay(skip ...os.Signal) *signalRelay {
+	r := &signalRelay{
+		ch:   make(chan os.Signal, 8),
+		done: make(chan struct{}),
+		skip: map[os.Signal]bool{},
+	}
+	for _, sig := range skip {
+		r.skip[sig] = true
+	}
+	signal.Notify(r.ch, forwardedSignals...)
+	go r.loop()
+	return r
+}
+
+// startTerminalRelay starts a relay for a docker command sharing this
+// process's stdio. When stdin is not a terminal the command is moved out of
+// the terminal's process group, so Ctrl-C reaches it once, via the relay.
+func startTerminalRelay() *signalRelay {
+	stdinTTY := term.IsTerminal(int(os.Stdin.Fd()))
+	ttyMode := stdinTTY && term.IsTerminal(int(os.Stdout.Fd()))
+	var skip []os.Signal
+	if terminalDeliversInterrupt(stdinTTY, ttyMode) {
+		skip = append(skip, os.Interrupt)
+	}
+	r := startSignalRelay(skip...)
+	r.isolate = !stdinTTY
+	return r
+}
+
+func (r *signalRelay) loop() {
+	for {
+		select {
+		case sig := <-r.ch:
+			r.mu.Lock()
+			switch {
+			case r.proc != nil:
+				switch {
+				case r.skip[sig]:
+				case r.deliver != nil && isTerminatingSignal(sig):
+					go r.deliver(sig)
+				default:
+					_ = r.proc.Signal(sig)
+				}
+			case isTerminatingSignal(sig) && r.pending == nil:
+				r.pending = sig
+			}
+			r.mu.Unlock()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// attach starts forwarding to proc.
+func (r *signalRelay) attach(proc *os.Process) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.proc = proc
+}
+
+// deliverWith makes the relay hand terminating signals to deliver instead of
+// the docker process.
+func (r *signalRelay) deliverWith(deliver func(os.Signal)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliver = deliver
+}
+
+// interrupted returns the exit status for a terminating signal received
+// before docker was attached.
+func (r *signalRelay) interrupted() (exitStatusError, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending == nil {
+		return exitStatusError{}, false
+	}
+	return exitStatusError{code: signalExitCode(r.pending)}, true
+}
+
+// run starts cmd, forwards signals to it and waits for it to exit.
+func (r *signalRelay) run(cmd *exec.Cmd) error {
+	if r.isolate {
+		isolateFromTerminalSignals(cmd)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	r.attach(cmd.Process)
+	return cmd.Wait()
+}
+
+func (r *signalRelay) stop() {
+	signal.Stop(r.ch)
+	close(r.done)
+}
+
+// confirm asks question on the terminal and reports whether the answer was
+// yes. The session must not see the answer, and keys typed for the session
+// must not answer it, so its input is held for the prompt: a recorded
+// session's copy loop hands keys to the prompt, and otherwise docker is
+// stopped so it cannot read the terminal. Input that was typed before the
+// prompt appeared is discarded.
+func (r *signalRelay) confirm(question string) bool {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	defer tty.Close()
+
+	r.mu.Lock()
+	gate, proc := r.input, r.proc
+	r.mu.Unlock()
+	var read func() ([]byte, error)
+	switch {
+	case gate != nil:
+		keys := gate.open()
+		defer gate.close()
+		read = func() ([]byte, error) { return <-keys, nil }
+	default:
+		if proc != nil {
+			defer pauseProcess(proc)()
+		}
+		buf := make([]byte, 64)
+		read = func() ([]byte, error) {
+			n, err := tty.Read(buf)
+			return buf[:n], err
+		}
+	}
+	_ = flushInput(tty)
+	if gate != nil {
+		gate.drain()
+	}
+
+	fmt.Fprintf(tty, "\r\ndockerx: %s [y/N] ", question)
+	answer := readAnswer(read)
+	fmt.Fprint(tty, "\r\n")
+	reply := strings.ToLower(strings.TrimSpace(answer))
+	return reply == "y" || reply == "yes"
+}
+
+// readAnswer reads one line. The terminal may be in raw mode while a session
+// runs, so the line ends at either \r or \n.
+func readAnswer(read func() ([]byte, error)) string {
+	var answer []byte
+	for {
+		chunk, err := read()
+		for _, c := range chunk {
+			if c == '\r' || c == '\n' {
+				return string(answer)
+			}
+			answer = append(answer, c)
+		}
+		if err != nil {
+			return string(answer)
+		}
+	}
+}
+
+// inputGate sits in a recorded session's copy from the terminal to docker
+// and hands the keys to a prompt while one is open.
+type inputGate struct {
+	mu     sync.Mutex
+	prompt chan []byte
+}
+
+// gateInput installs a gate for the relay's prompts to use.
+func (r *signalRelay) gateInput() *inputGate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.input = &inputGate{}
+	return r.input
+}
+
+func (g *inputGate) open() <-chan []byte {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prompt = make(chan []byte, 64)
+	return g.prompt
+}
+
+func (g *inputGate) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prompt = nil
+}
+
+// drain drops keys that reached the gate before the prompt was shown.
+func (g *inputGate) drain() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for len(g.prompt) > 0 {
+		<-g.prompt
+	}
+}
+
+// divert hands p to an open prompt and reports whether it did.
+func (g *inputGate) divert(p []byte) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.prompt == nil {
+		return false
+	}
+	select {
+	case g.prompt <- bytes.Clone(p):
+	default:
+	}
+	return true
+}
+
+// reader wraps the terminal so reads skip whatever a prompt took.
+func (g *inputGate) reader(src io.Reader) io.Reader {
+	return gatedReader{src: src, gate: g}
+}
+
+type gatedReader struct {
+	src  io.Reader
+	gate *inputGate
+}
+
+func (r gatedReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.src.Read(p)
+		if n > 0 && r.gate.divert(p[:n]) {
+			n = 0
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// signalExitCode follows the shell convention of 128+N for a signal exit.
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
@@ -0,0 +1,219 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestExitCodePassesThroughStatus(t *testing.T) {
+	for script, want := range map[string]int{
+		"exit 0":        0,
+		"exit 2":        2,
+		"exit 125":      125,
+		"kill -TERM $$": 128 + int(syscall.SIGTERM),
+		"kill -INT $$":  128 + int(syscall.SIGINT),
+	} {
+		err := exec.Command("sh", "-c", script).Run()
+		if got := exitCode(err); got != want {
+			t.Fatalf("exitCode(%q) = %d, want %d", script, got, want)
+		}
+	}
+	if got := exitCode(exec.ErrNotFound); got != -1 {
+		t.Fatalf("exitCode(non-exit error) = %d, want -1", got)
+	}
+}
+
+func TestSignalRelayForwardsToChild(t *testing.T) {
+	relay := startSignalRelay()
+	defer relay.stop()
+
+	cmd := exec.Command("sh", "-c", `trap 'exit 7' TERM; echo ready; while :; do sleep 0.05; done`)
+	isolateFromTerminalSignals(cmd)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("stdout pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	relay.attach(cmd.Process)
+	if _, err := stdout.Read(make([]byte, 6)); err != nil {
+		t.Fatalf("wait for child: %v", err)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("signal self: %v", err)
+	}
+	if got := exitCode(cmd.Wait()); got != 7 {
+		t.Fatalf("child exit code = %d, want 7 from its TERM trap", got)
+	}
+}
+
+func TestSignalRelayRemembersSignalBeforeAttach(t *testing.T) {
+	relay := startSignalRelay()
+	defer relay.stop()
+
+	if _, ok := relay.interrupted(); ok {
+		t.Fatal("did not expect an interrupt yet")
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGWINCH); err != nil {
+		t.Fatalf("signal self: %v", err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("signal self: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if status, ok := relay.interrupted(); ok {
+			if status.code != 128+int(syscall.SIGHUP) {
+				t.Fatalf("interrupted code = %d, want %d", status.code, 128+int(syscall.SIGHUP))
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("signal before attach was not recorded")
+}
+
+func TestTerminalDeliversInterrupt(t *testing.T) {
+	if !terminalDeliversInterrupt(true, false) {
+		t.Fatal("cooked terminal should deliver ^C to docker directly")
+	}
+	if terminalDeliversInterrupt(true, true) || terminalDeliversInterrupt(false, false) {
+		t.Fatal("raw terminals and pipes rely on the relay for SIGINT")
+	}
+}
+
+func TestInputGateHandsKeysToPrompt(t *testing.T) {
+	gate := &inputGate{}
+	src, typed := io.Pipe()
+	in := gate.reader(src)
+	forwarded := make(chan string, 4)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				close(forwarded)
+				return
+			}
+			forwarded <- string(buf[:n])
+		}
+	}()
+
+	io.WriteString(typed, "ls")
+	if got := <-forwarded; got != "ls" {
+		t.Fatalf("forwarded %q before the prompt", got)
+	}
+
+	keys := gate.open()
+	io.WriteString(typed, "y\r")
+	answer := readAnswer(func() ([]byte, error) { return <-keys, nil })
+	gate.close()
+	if answer != "y" {
+		t.Fatalf("prompt read %q", answer)
+	}
+
+	io.WriteString(typed, "pwd")
+	typed.Close()
+	if got := <-forwarded; got != "pwd" {
+		t.Fatalf("forwarded %q after the prompt, want the prompt's keys kept from the session", got)
+	}
+}
+
+func TestReadAnswer(t *testing.T) {
+	chunks := [][]byte{[]byte("ye"), []byte("s\rmore")}
+	read := func() ([]byte, error) {
+		chunk := chunks[0]
+		chunks = chunks[1:]
+		return chunk, nil
+	}
+	if got := readAnswer(read); got != "yes" {
+		t.Fatalf("readAnswer = %q", got)
+	}
+	if got := readAnswer(func() ([]byte, error) { return []byte("n"), io.EOF }); got != "n" {
+		t.Fatalf("readAnswer at EOF = %q", got)
+	}
+}
+
+func TestEntrypointForwardsTermToCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	dir := t.TempDir()
+	ready, got := filepath.Join(dir, "ready"), filepath.Join(dir, "got")
+	script := `trap 'echo term > "$2"; exit 3' TERM; : > "$1"; while :; do sleep 0.05; done`
+	cmd := exec.Command("sh", "entrypoint.sh", "sh", "-c", script, "cmd", ready, got)
+	cmd.Env = append(os.Environ(), "HOME="+filepath.Join(dir, "home"), "DOCKERX_CONFIG_COUNT=0")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer cmd.Process.Kill()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !pathExists(ready) {
+		if time.Now().After(deadline) {
+			t.Fatal("command did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("signal: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if code := exitCode(err); code != 3 {
+			t.Fatalf("entrypoint exit = %d (%v), want the command's 3", code, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("entrypoint did not exit after SIGTERM")
+	}
+	if content, err := os.ReadFile(got); err != nil || string(content) != "term\n" {
+		t.Fatalf("command did not receive SIGTERM: %q, %v", content, err)
+	}
+}
+
+func TestExecScriptsDeliverSignalToCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	dir := t.TempDir()
+	pidFile, ready := filepath.Join(dir, "cmd.pid"), filepath.Join(dir, "ready")
+	script := `trap 'exit 3' TERM; : > "$1"; while :; do sleep 0.05; done`
+	cmd := exec.Command("sh", "-c", execPIDScript, pidFile, "sh", "-c", script, "cmd", ready)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer cmd.Process.Kill()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !pathExists(ready) {
+		if time.Now().After(deadline) {
+			t.Fatal("command did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if out, err := exec.Command("sh", "-c", execKillScript, pidFile, signalName(syscall.SIGTERM)).CombinedOutput(); err != nil {
+		t.Fatalf("kill script: %v\n%s", err, out)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if code := exitCode(err); code != 3 {
+			t.Fatalf("command exit = %d (%v), want 3 from its TERM trap", code, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command did not exit after the kill script")
+	}
+}
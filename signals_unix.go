@@ -0,0 +1,47 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGWINCH}
+
+func isTerminatingSignal(sig os.Signal) bool {
+	return sig != syscall.SIGWINCH
+}
+
+// isolateFromTerminalSignals moves cmd into its own process group so signals
+// from the terminal reach it once, through the relay. This is only safe when
+// it does not read from the terminal; a background process group reading a
+// tty would be stopped with SIGTTIN.
+func isolateFromTerminalSignals(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalName is the name kill -s takes for sig.
+func signalName(sig os.Signal) string {
+	if s, ok := sig.(syscall.Signal); ok {
+		return strings.TrimPrefix(unix.SignalName(s), "SIG")
+	}
+	return "TERM"
+}
+
+// pauseProcess stops p until the returned func continues it.
+func pauseProcess(p *os.Process) func() {
+	_ = p.Signal(syscall.SIGSTOP)
+	return func() { _ = p.Signal(syscall.SIGCONT) }
+}
+
+// terminalDeliversInterrupt reports whether Ctrl-C on the terminal already
+// reaches docker as SIGINT. In tty mode the terminal is raw and ^C is sent
+// as input instead.
+func terminalDeliversInterrupt(stdinTTY, ttyMode bool) bool {
+	return stdinTTY && !ttyMode
+}
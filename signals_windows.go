@@ -0,0 +1,35 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+func isTerminatingSignal(sig os.Signal) bool {
+	return true
+}
+
+// isolateFromTerminalSignals is a no-op on Windows, where console control
+// events are delivered to every process attached to the console.
+func isolateFromTerminalSignals(cmd *exec.Cmd) {}
+
+// signalName is the name kill -s takes for sig. os.Interrupt is the only
+// signal relayed on Windows.
+func signalName(sig os.Signal) string {
+	return "INT"
+}
+
+// pauseProcess does nothing on Windows, which has no prompts that need it.
+func pauseProcess(p *os.Process) func() {
+	return func() {}
+}
+
+// terminalDeliversInterrupt reports whether Ctrl-C already reaches docker.
+// Console control events go to every process on the console.
+func terminalDeliversInterrupt(stdinTTY, ttyMode bool) bool {
+	return true
+}
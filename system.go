@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	writableOff       = "off"
+	writableEphemeral = "ephemeral"
+	writableProject   = "project"
+
+	// systemVolumeLabel marks volumes holding a project's system paths.
+	systemVolumeLabel = "dockerx.system"
+	digestLabel       = "dockerx.digest"
+)
+
+// systemVolumePaths are made writable by --writable-system: where pip, npm
+// and hand-installed tools go, and dpkg's state. /usr and /etc stay
+// read-only, so a session cannot replace the image's binaries or its
+// config, the identity overlays included.
+var systemVolumePaths = []string{"/usr/local", "/opt", "/var/lib/dpkg"}
+
+// systemWriteCaps are the capabilities dpkg needs as root to unpack files
+// and set their owners and modes.
+var systemWriteCaps = []string{"CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID"}
+
+func validateWritableSystem(mode string) error {
+	switch mode {
+	case "", writableOff, writableEphemeral, writableProject:
+		return nil
+	default:
+		return fmt.Errorf("invalid --writable-system %q (want off, ephemeral or project)", mode)
+	}
+}
+
+// systemVolumes lists the named volumes for workDir. Docker fills an empty
+// named volume with the image's files on first mount, so installed tools sit
+// alongside the image's own instead of hiding them as a tmpfs would.
+func systemVolumes(workDir string) []mountSpec {
+	sum := sha256.Sum256([]byte(workDir))
+	prefix := "dockerx-system-" + hex.EncodeToString(sum[:])[:12]
+	mounts := make([]mountSpec, 0, len(systemVolumePaths))
+	for _, path := range systemVolumePaths {
+		name := prefix + "-" + strings.ReplaceAll(strings.TrimPrefix(path, "/"), "/", "-")
+		mounts = append(mounts, mountSpec{src: name, dst: path})
+	}
+	return mounts
+}
+
+// ephemeralSystemVolumes are anonymous volumes over the system paths, which
+// --rm removes with the container. Docker fills them from the image like the
+// named ones; a tmpfs would start empty and hide the image's files there,
+// the entrypoint in /usr/local/bin included.
+func ephemeralSystemVolumes() []mountSpec {
+	mounts := make([]mountSpec, 0, len(systemVolumePaths))
+	for _, path := range systemVolumePaths {
+		mounts = append(mounts, mountSpec{dst: path})
+	}
+	return mounts
+}
+
+// ensureSystemVolumes creates missing volumes, labeled with the project and
+// image digest. Existing volumes keep the files of the image they were first
+// filled from, so a newer image is reported rather than silently shadowed.
+func ensureSystemVolumes(volumes []mountSpec, workDir, digest string, w io.Writer) error {
+	stale := false
+	for _, v := range volumes {
+		out, err := exec.Command("docker", "volume", "inspect", "--format", `{{index .Labels "`+digestLabel+`"}}`, v.src).Output()
+		if err == nil {
+			if created := strings.TrimSpace(string(out)); digest != "" && created != "" && created != digest {
+				stale = true
+			}
+			continue
+		}
+		args := []string{"volume", "create",
+			"--label", systemVolumeLabel + "=1",
+			"--label", projectLabel + "=" + workDir,
+			"--label", digestLabel + "=" + digest,
+			v.src,
+		}
+		if out, err := exec.Command("docker", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("create volume %s: %w: %s", v.src, err, strings.TrimSpace(string(out)))
+		}
+	}
+	if stale {
+		fmt.Fprintln(w, "warning: the image changed since this project's system volumes were created; they still hold the old image's files (run dockerx system reset to start over)")
+	}
+	return nil
+}
+
+func runSystem(args []string) int {
+	if len(args) == 0 || args[0] != "reset" {
+		fmt.Fprintln(os.Stderr, "usage: dockerx system reset [--all]")
+		return 2
+	}
+	flags := flag.NewFlagSet("system reset", flag.ContinueOnError)
+	all := flags.Bool("all", false, "Remove system volumes for every project, not just the current directory")
+	if err := flags.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if err := resetSystemVolumes(os.Stdout, *all); err != nil {
+		fmt.Fprintf(os.Stderr, "dockerx: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func resetSystemVolumes(w io.Writer, all bool) error {
+	filters := []string{"--filter", "label=" + systemVolumeLabel}
+	if !all {
+		workDir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("resolve current directory: %w", err)
+		}
+		workDir, err = filepath.Abs(workDir)
+		if err != nil {
+			return fmt.Errorf("resolve current directory: %w", err)
+		}
+		filters = append(filters, "--filter", "label="+projectLabel+"="+workDir)
+	}
+
+	out, err := exec.Command("docker", append([]string{"volume", "ls", "-q"}, filters...)...).Output()
+	if err != nil {
+		return fmt.Errorf("list system volumes: %w", err)
+	}
+	names := splitLines(string(out))
+	if len(names) == 0 {
+		fmt.Fprintln(w, "no system volumes to remove")
+		return nil
+	}
+	if out, err := exec.Command("docker", append([]string{"volume", "rm"}, names...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("remove system volumes (is a session still running?): %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	for _, name := range names {
+		fmt.Fprintf(w, "removed %s\n", name)
+	}
+	return nil
+}
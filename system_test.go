@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateWritableSystem(t *testing.T) {
+	for _, mode := range []string{"", writableOff, writableEphemeral, writableProject} {
+		if err := validateWritableSystem(mode); err != nil {
+			t.Fatalf("validateWritableSystem(%q): %v", mode, err)
+		}
+	}
+	if err := validateWritableSystem("on"); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+}
+
+func TestSystemVolumes(t *testing.T) {
+	volumes := systemVolumes("/home/me/repo")
+	if len(volumes) != len(systemVolumePaths) {
+		t.Fatalf("got %d volumes, want %d", len(volumes), len(systemVolumePaths))
+	}
+	prefix := strings.TrimSuffix(volumes[0].src, "-usr-local")
+	for i, v := range volumes {
+		if v.dst != systemVolumePaths[i] {
+			t.Fatalf("volume %d target = %q, want %q", i, v.dst, systemVolumePaths[i])
+		}
+		if !strings.HasPrefix(v.src, "dockerx-system-") || !strings.HasPrefix(v.src, prefix+"-") {
+			t.Fatalf("unexpected volume name %q", v.src)
+		}
+	}
+	if got := volumes[len(volumes)-1].src; got != prefix+"-var-lib-dpkg" {
+		t.Fatalf("/var/lib/dpkg volume = %q", got)
+	}
+	for _, path := range systemVolumePaths {
+		if path == "/usr" || path == "/etc" {
+			t.Fatalf("%s should stay read-only", path)
+		}
+	}
+	if other := systemVolumes("/home/me/other"); other[0].src == volumes[0].src {
+		t.Fatalf("projects should not share volumes: %q", other[0].src)
+	}
+}
+
+func TestBuildDockerArgsWritableSystem(t *testing.T) {
+	base := launchPlan{image: "repo/image:latest", workDir: "/home/me/repo", command: []string{"zsh"}}
+
+	args, err := buildDockerArgs(base)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if !containsSubstring(args, "--read-only") || containsPair(args, "--cap-add", "CHOWN") {
+		t.Fatalf("off mode should keep the defaults: %v", args)
+	}
+
+	ephemeral := base
+	ephemeral.writableSystem = writableEphemeral
+	ephemeral.systemVolumes = ephemeralSystemVolumes()
+	args, err = buildDockerArgs(ephemeral)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if !containsSubstring(args, "--read-only") {
+		t.Fatalf("ephemeral mode should keep --read-only: %v", args)
+	}
+	for _, path := range systemVolumePaths {
+		if !containsPair(args, "--mount", "type=volume,dst="+path) {
+			t.Fatalf("missing anonymous volume over %s in %v", path, args)
+		}
+	}
+	for _, c := range systemWriteCaps {
+		if !containsPair(args, "--cap-add", c) {
+			t.Fatalf("missing --cap-add %s in %v", c, args)
+		}
+	}
+
+	project := base
+	project.writableSystem = writableProject
+	project.systemVolumes = systemVolumes(base.workDir)
+	args, err = buildDockerArgs(project)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if !containsSubstring(args, "--read-only") {
+		t.Fatalf("project mode should keep --read-only: %v", args)
+	}
+	for _, v := range project.systemVolumes {
+		want := "type=volume,src=" + v.src + ",dst=" + v.dst
+		if !containsPair(args, "--mount", want) {
+			t.Fatalf("missing --mount %s in %v", want, args)
+		}
+	}
+	if !containsPair(args, "--cap-add", "DAC_OVERRIDE") {
+		t.Fatalf("project mode should add the dpkg caps: %v", args)
+	}
+}
+
+func TestWritePlanShowsWritableSystem(t *testing.T) {
+	plan := launchPlan{
+		image:          "repo/image:latest",
+		workDir:        "/home/me/repo",
+		command:        []string{"zsh"},
+		writableSystem: writableProject,
+		systemVolumes:  systemVolumes("/home/me/repo"),
+	}
+
+	var text bytes.Buffer
+	if err := writePlan(&text, planFormatText, plan, []string{"run"}); err != nil {
+		t.Fatalf("write text plan: %v", err)
+	}
+	if !strings.Contains(text.String(), "Writable system: project volumes") ||
+		!strings.Contains(text.String(), plan.systemVolumes[0].src+" -> /usr/local (rw)") {
+		t.Fatalf("text plan missing writable system:\n%s", text.String())
+	}
+
+	var out bytes.Buffer
+	if err := writePlan(&out, planFormatJSON, plan, []string{"run"}); err != nil {
+		t.Fatalf("write json plan: %v", err)
+	}
+	var rec planRecord
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil {
+		t.Fatalf("decode plan: %v", err)
+	}
+	if rec.Writable != writableProject || len(rec.Volumes) != len(systemVolumePaths) {
+		t.Fatalf("json plan writable system = %q %v", rec.Writable, rec.Volumes)
+	}
+}
@@ -0,0 +1,48 @@
+#!/bin/sh
+# Generated by dockerx export. Run from the project directory.
+#
+# Host-specific settings:
+#   - Identity overlays for /etc/passwd, /etc/group and /etc/shadow are generated per host at launch and are not exported; sudo may not resolve the runtime user.
+#   - Config mount /opt/shared/gitconfig is outside the home directory and is exported as an absolute host path.
+#
+set -eu
+
+tty_flag=
+if [ -t 0 ] && [ -t 1 ]; then
+  tty_flag=-t
+fi
+
+# shellcheck disable=SC2086
+exec docker run \
+  --rm \
+  -i \
+  --pull missing \
+  $tty_flag \
+  --label dockerx.project="$PWD" \
+  --label dockerx.env=TERM,OPENAI_API_KEY \
+  --read-only \
+  --cap-drop ALL \
+  --cap-add SETUID \
+  --cap-add SETGID \
+  --cap-add AUDIT_WRITE \
+  --mount type=bind,src="$PWD",dst=/app \
+  --mount type=bind,src="$HOME"/.codex,dst=/tmp/dockerx-config/0,readonly \
+  --mount type=bind,src=/opt/shared/gitconfig,dst=/tmp/dockerx-config/1,readonly \
+  --tmpfs /tmp:mode=1777 \
+  --tmpfs /run:mode=755 \
+  --tmpfs /var/tmp:mode=1777 \
+  --tmpfs /var/lib/apt/lists:mode=755 \
+  --tmpfs /var/cache/apt:mode=755 \
+  --tmpfs /home/dev:mode=755,uid="$(id -u)",gid="$(id -g)" \
+  --workdir /app \
+  --env HOME=/home/dev \
+  --env USER=dev \
+  --user "$(id -u):$(id -g)" \
+  --env DOCKERX_CONFIG_SRC_0=/tmp/dockerx-config/0 \
+  --env DOCKERX_CONFIG_DST_0=/home/dev/.codex \
+  --env DOCKERX_CONFIG_SRC_1=/tmp/dockerx-config/1 \
+  --env DOCKERX_CONFIG_DST_1=/home/dev/.gitconfig \
+  --env DOCKERX_CONFIG_COUNT=2 \
+  --env TERM \
+  --env OPENAI_API_KEY \
+  wpkpda/dockerx@sha256:0123abcd sh -c 'echo $HOME'
@@ -0,0 +1 @@
+docker run --rm -i --pull never --label 'dockerx.project=/home/me/My Projects/it'\''s here' --label dockerx.env=TERM,OPENAI_API_KEY --read-only --cap-drop ALL --cap-add SETUID --cap-add SETGID --cap-add AUDIT_WRITE --mount 'type=bind,src=/home/me/My Projects/it'\''s here,dst=/app' --mount type=bind,src=/tmp/dockerx-identity-1/passwd,dst=/etc/passwd,readonly --mount type=bind,src=/home/me/.codex,dst=/tmp/dockerx-config/0,readonly --mount type=bind,src=/home/me/.config/gh,dst=/tmp/dockerx-config/1,readonly --tmpfs /tmp:mode=1777 --tmpfs /run:mode=755 --tmpfs /var/tmp:mode=1777 --tmpfs /var/lib/apt/lists:mode=755 --tmpfs /var/cache/apt:mode=755 --tmpfs /home/dev:mode=755,uid=1000,gid=1000 --workdir /app --env HOME=/home/dev --env USER=dev --user 1000:1000 --env DOCKERX_CONFIG_SRC_0=/tmp/dockerx-config/0 --env DOCKERX_CONFIG_DST_0=/home/dev/.codex --env DOCKERX_CONFIG_SRC_1=/tmp/dockerx-config/1 --env DOCKERX_CONFIG_DST_1=/home/dev/.config/gh --env DOCKERX_CONFIG_COUNT=2 --env TERM --env OPENAI_API_KEY wpkpda/dockerx@sha256:0123abcd sh -c 'echo $HOME && make test'
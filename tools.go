@@ -0,0 +1,160 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed tools.yaml
+var builtinToolsYAML []byte
+
+// reservedToolNames are dockerx subcommands, which a tool cannot shadow.
+var reservedToolNames = []string{"lock", "history", "export", "exec", "prune", "system", "replay"}
+
+// toolSpec is what a tool needs from the host.
+type toolSpec struct {
+	// Command runs when the tool is launched; arguments after the tool name
+	// are appended.
+	Command []string `yaml:"command"`
+	// Config lists host paths staged into the container home.
+	Config []toolConfigPath `yaml:"config"`
+	// Env lists host env vars passed through when set.
+	Env []string `yaml:"env"`
+	// ContainerEnv is set in the container; values may start with ~ for the
+	// container home.
+	ContainerEnv map[string]string `yaml:"containerEnv"`
+}
+
+// toolConfigPath is a config path under the home directory. It is staged at
+// the same path under the container home.
+type toolConfigPath struct {
+	Path string `yaml:"path"`
+	// Env names a host variable that overrides the host path when set.
+	Env string `yaml:"env"`
+}
+
+// UnmarshalYAML accepts a plain path as well as the mapping form.
+func (p *toolConfigPath) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		p.Path = node.Value
+		return nil
+	}
+	type plain toolConfigPath
+	return node.Decode((*plain)(p))
+}
+
+type toolRegistry struct {
+	common toolSpec
+	tools  map[string]toolSpec
+}
+
+// loadToolRegistry reads the built-in presets and lays the user's entries
+// over them; a user entry replaces a built-in one of the same name.
+func loadToolRegistry(user map[string]toolSpec) (toolRegistry, error) {
+	var builtin struct {
+		Common toolSpec            `yaml:"common"`
+		Tools  map[string]toolSpec `yaml:"tools"`
+	}
+	if err := yaml.Unmarshal(builtinToolsYAML, &builtin); err != nil {
+		return toolRegistry{}, fmt.Errorf("parse built-in tools: %w", err)
+	}
+	reg := toolRegistry{common: builtin.Common, tools: builtin.Tools}
+	for name, spec := range user {
+		if err := validateToolSpec(name, spec); err != nil {
+			return toolRegistry{}, err
+		}
+		reg.tools[name] = spec
+	}
+	return reg, nil
+}
+
+func validateToolSpec(name string, spec toolSpec) error {
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, `/\ `) {
+		return fmt.Errorf("invalid tool name %q", name)
+	}
+	if slices.Contains(reservedToolNames, name) {
+		return fmt.Errorf("tool %q would shadow the dockerx %s command", name, name)
+	}
+	if len(spec.Command) == 0 {
+		return fmt.Errorf("tool %q has no command", name)
+	}
+	for _, c := range spec.Config {
+		if !strings.HasPrefix(c.Path, "~/") {
+			return fmt.Errorf("tool %q: config path %q must start with ~/", name, c.Path)
+		}
+	}
+	return nil
+}
+
+// resolve picks the specs for command. A command naming a tool gets the
+// common spec and that tool's, with the tool's command in front of the rest
+// of the arguments; any other command gets every tool.
+func (r toolRegistry) resolve(command []string) (string, []toolSpec, []string) {
+	if len(command) > 0 {
+		if spec, ok := r.tools[command[0]]; ok {
+			return command[0], []toolSpec{r.common, spec}, append(slices.Clone(spec.Command), command[1:]...)
+		}
+	}
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	specs := []toolSpec{r.common}
+	for _, name := range names {
+		specs = append(specs, r.tools[name])
+	}
+	return "", specs, command
+}
+
+// hostPath maps a ~/ config path to the host.
+func (c toolConfigPath) hostPath(homeDir string, lookupEnv func(string) string) string {
+	if c.Env != "" {
+		if override := lookupEnv(c.Env); override != "" {
+			return override
+		}
+	}
+	rest := strings.TrimPrefix(c.Path, "~/")
+	for _, xdg := range []struct{ dir, env string }{{".config/", "XDG_CONFIG_HOME"}, {".cache/", "XDG_CACHE_HOME"}} {
+		if sub, ok := strings.CutPrefix(rest, xdg.dir); ok {
+			if base := lookupEnv(xdg.env); base != "" {
+				return filepath.Join(base, filepath.FromSlash(sub))
+			}
+		}
+	}
+	return filepath.Join(homeDir, filepath.FromSlash(rest))
+}
+
+// containerPath maps a ~/ config path to the container home.
+func (c toolConfigPath) containerPath() string {
+	return containerHome + "/" + strings.TrimPrefix(c.Path, "~/")
+}
+
+// toolContainerEnv lists KEY=VALUE pairs set in the container, sorted by key.
+func toolContainerEnv(specs []toolSpec) []string {
+	values := map[string]string{}
+	for _, spec := range specs {
+		for key, value := range spec.ContainerEnv {
+			if rest, ok := strings.CutPrefix(value, "~/"); ok {
+				value = containerHome + "/" + rest
+			}
+			values[key] = value
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	env := make([]string, 0, len(keys))
+	for _, key := range keys {
+		env = append(env, key+"="+values[key])
+	}
+	return env
+}
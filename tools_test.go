@@ -0,0 +1,165 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// allToolSpecs returns the specs a plain dockerx session gets.
+func allToolSpecs(t *testing.T) []toolSpec {
+	t.Helper()
+	reg, err := loadToolRegistry(nil)
+	if err != nil {
+		t.Fatalf("load tools: %v", err)
+	}
+	_, specs, _ := reg.resolve(nil)
+	return specs
+}
+
+func TestBuiltinToolsAreValid(t *testing.T) {
+	reg, err := loadToolRegistry(nil)
+	if err != nil {
+		t.Fatalf("load tools: %v", err)
+	}
+	for _, name := range []string{"codex", "claude", "gemini", "aider"} {
+		spec, ok := reg.tools[name]
+		if !ok {
+			t.Fatalf("missing built-in tool %s", name)
+		}
+		if err := validateToolSpec(name, spec); err != nil {
+			t.Fatalf("built-in %s: %v", name, err)
+		}
+	}
+}
+
+func TestToolRegistryResolve(t *testing.T) {
+	reg, err := loadToolRegistry(map[string]toolSpec{
+		"mytool": {Command: []string{"python", "-m", "mytool"}, Env: []string{"MYTOOL_TOKEN"}},
+	})
+	if err != nil {
+		t.Fatalf("load tools: %v", err)
+	}
+
+	name, specs, command := reg.resolve([]string{"claude", "--continue"})
+	if name != "claude" || len(specs) != 2 || !slices.Equal(command, []string{"claude", "--continue"}) {
+		t.Fatalf("resolve claude = %q, %d specs, %v", name, len(specs), command)
+	}
+	name, specs, command = reg.resolve([]string{"mytool", "run"})
+	if name != "mytool" || !slices.Equal(command, []string{"python", "-m", "mytool", "run"}) || !slices.Contains(specs[1].Env, "MYTOOL_TOKEN") {
+		t.Fatalf("resolve mytool = %q, %v, %v", name, specs, command)
+	}
+	name, specs, command = reg.resolve([]string{"make", "test"})
+	if name != "" || len(specs) != len(reg.tools)+1 || !slices.Equal(command, []string{"make", "test"}) {
+		t.Fatalf("resolve make = %q, %d specs, %v", name, len(specs), command)
+	}
+}
+
+func TestToolRegistryRejectsBadUserEntries(t *testing.T) {
+	for name, spec := range map[string]toolSpec{
+		"exec":   {Command: []string{"sh"}},
+		"replay": {Command: []string{"sh"}},
+		"nocmd":  {},
+		"-flag":  {Command: []string{"x"}},
+		"abspth": {Command: []string{"x"}, Config: []toolConfigPath{{Path: "/etc/shadow"}}},
+	} {
+		if _, err := loadToolRegistry(map[string]toolSpec{name: spec}); err == nil {
+			t.Fatalf("expected tool %q to be rejected", name)
+		}
+	}
+}
+
+func TestToolSelectionIsLeastPrivilege(t *testing.T) {
+	home := t.TempDir()
+	mustMkdirAll(t, filepath.Join(home, ".codex"))
+	mustMkdirAll(t, filepath.Join(home, ".claude"))
+	mustWriteFile(t, filepath.Join(home, ".claude.json"), "x")
+	mustMkdirAll(t, filepath.Join(home, ".gemini"))
+	mustWriteFile(t, filepath.Join(home, ".gitconfig"), "x")
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+	t.Setenv("GH_TOKEN", "gh-test")
+
+	reg, err := loadToolRegistry(nil)
+	if err != nil {
+		t.Fatalf("load tools: %v", err)
+	}
+	_, specs, _ := reg.resolve([]string{"claude"})
+	lookup := func(string) string { return "" }
+	mounts := discoverHostConfigMounts(specs, home, lookup, pathExists, hostPaths{})
+	assertMount(t, mounts, filepath.Join(home, ".claude"), containerHome+"/.claude", true)
+	assertMount(t, mounts, filepath.Join(home, ".claude.json"), containerHome+"/.claude.json", true)
+	assertMount(t, mounts, filepath.Join(home, ".gitconfig"), containerHome+"/.gitconfig", true)
+	for _, m := range mounts {
+		if strings.Contains(m.src, ".codex") || strings.Contains(m.src, ".gemini") {
+			t.Fatalf("claude session got another tool's config: %+v", mounts)
+		}
+	}
+
+	keys := gatherPassthroughEnvKeys(specs)
+	if !slices.Contains(keys, "ANTHROPIC_API_KEY") || !slices.Contains(keys, "GH_TOKEN") || slices.Contains(keys, "OPENAI_API_KEY") {
+		t.Fatalf("claude env keys = %v", keys)
+	}
+	if env := toolContainerEnv(specs); len(env) != 0 {
+		t.Fatalf("claude container env = %v", env)
+	}
+
+	_, specs, _ = reg.resolve([]string{"codex"})
+	if env := toolContainerEnv(specs); !slices.Equal(env, []string{"CODEX_HOME=" + containerHome + "/.codex"}) {
+		t.Fatalf("codex container env = %v", env)
+	}
+}
+
+func TestToolConfigHostPath(t *testing.T) {
+	env := map[string]string{"XDG_CONFIG_HOME": "/xdg", "CODEX_HOME": "/opt/codex"}
+	lookup := func(k string) string { return env[k] }
+	for _, tt := range []struct {
+		path toolConfigPath
+		want string
+	}{
+		{toolConfigPath{Path: "~/.config/codex"}, filepath.Join("/xdg", "codex")},
+		{toolConfigPath{Path: "~/.cache/huggingface"}, filepath.Join("/home/me", ".cache", "huggingface")},
+		{toolConfigPath{Path: "~/.codex", Env: "CODEX_HOME"}, "/opt/codex"},
+		{toolConfigPath{Path: "~/.gemini", Env: "GEMINI_HOME"}, filepath.Join("/home/me", ".gemini")},
+	} {
+		if got := tt.path.hostPath("/home/me", lookup); got != tt.want {
+			t.Fatalf("hostPath(%+v) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestUserConfigTools(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	mustWriteFile(t, path, "tools:\n  opencode:\n    command: [opencode]\n    config:\n      - ~/.config/opencode\n      - {path: ~/.opencode, env: OPENCODE_HOME}\n    env: [OPENCODE_API_KEY]\n")
+	cfg, err := loadUserConfig(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	spec := cfg.Tools["opencode"]
+	if len(spec.Config) != 2 || spec.Config[0].Path != "~/.config/opencode" || spec.Config[1].Env != "OPENCODE_HOME" {
+		t.Fatalf("unexpected tool config: %+v", spec)
+	}
+}
+
+func TestBuildDockerArgsToolLabelAndEnv(t *testing.T) {
+	plan := launchPlan{
+		image:        "repo/image:latest",
+		workDir:      "/home/me/repo",
+		command:      []string{"codex"},
+		tool:         "codex",
+		containerEnv: []string{"CODEX_HOME=" + containerHome + "/.codex"},
+	}
+	args, err := buildDockerArgs(plan)
+	if err != nil {
+		t.Fatalf("build args: %v", err)
+	}
+	if !containsPair(args, "--label", toolLabel+"=codex") || !containsPair(args, "--env", "CODEX_HOME="+containerHome+"/.codex") {
+		t.Fatalf("missing tool label or env in %v", args)
+	}
+
+	plan.tool, plan.containerEnv = "", nil
+	if args, _ = buildDockerArgs(plan); containsSubstring(args, "CODEX_HOME") || containsSubstring(args, toolLabel) {
+		t.Fatalf("plain session should not carry tool settings: %v", args)
+	}
+}